@@ -0,0 +1,222 @@
+package modbus
+
+import (
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rolfl/modbus/serial"
+)
+
+type ascii struct {
+	name string
+	// the largest PDU that is framed
+	pduLimit
+	// The serial port we talk over.
+	serial *serial.Port
+	// the longest allowed gap between characters in a frame
+	tout time.Duration
+	// whether this is open or not.
+	isopen bool
+	// a channel that is closed if we are not open ;)
+	closed chan bool
+	// Things we have received from the modbus, but need to send to the demuxer
+	toDemux chan adu
+	// Things that need to be sent to the modbus
+	toTX chan adu
+	// ID to use for uncorrelated calls
+	txid uint16
+	// check whether incoming packets are associated with outgoing calls.
+	pending map[byte]uint16
+	plock   sync.Mutex
+	wlog    wireLog
+	log     logSink
+	diag    *busDiagnosticManager
+}
+
+/*
+NewASCII establishes a Modbus ASCII connection to a local COM port (windows) or serial device (others). Modbus ASCII
+frames start with a ':' character, have the unit, function, data, and LRC checksum encoded as hexadecimal characters, and
+end with a CR LF pair. The tout is the longest gap allowed between the characters of a frame (the specification
+suggests 1 second), a partial frame is discarded after a longer gap. As required by the specification, the serial
+device uses 7 data bits.
+*/
+func NewASCII(device string, baud int, parity int, stopbits int, tout time.Duration) (Modbus, error) {
+	port, err := openSerial(device, baud, 7, parity, stopbits, false)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &ascii{}
+	a.name = device
+	a.serial = port
+	a.tout = tout
+	a.isopen = true
+	a.closed = make(chan bool)
+	a.toTX = make(chan adu, 5)
+	a.toDemux = make(chan adu, 5)
+	a.pending = make(map[byte]uint16)
+	a.diag = newBusDiagnosticManager()
+
+	// start a go routine that reads and frames bytes off the serial device
+	go a.wireReader()
+	// start a go routine that writes bytes to the serial device
+	go a.wireWriter()
+
+	return newModbus(a.toTX, a.toDemux, a, a.diag), nil
+}
+
+func (a *ascii) close() error {
+	if !a.isopen {
+		return nil
+	}
+	a.isopen = false
+	// closing this channel means that anyone reading from the channel is auto-selected in a Select statement
+	close(a.closed)
+	a.serial.Close()
+	return nil
+}
+
+func (a *ascii) setWireLogger(logger WireLogger) {
+	a.wlog.setLogger(logger, a.closed)
+}
+
+func (a *ascii) setLogger(logger Logger) {
+	a.log.set(logger)
+}
+
+// wireReader takes characters off the wire, collects them in to frames, and handles complete frames.
+func (a *ascii) wireReader() {
+	alive := true
+	buffer := make([]byte, 256)
+	// the hex characters of the unit ID, the PDU, and the LRC, and the CR
+	frame := make([]byte, 0, 2*(maxPDUSizeLimit+2)+1)
+	limit := 0
+	inframe := false
+	last := time.Now()
+	for alive {
+		n, err := a.serial.Read(buffer)
+		if err != nil {
+			a.log.Errorf("Error reading from serial line %s: %s", a.name, err)
+			n = 0
+		}
+		now := time.Now()
+		if inframe && n == 0 && now.Sub(last) > a.tout {
+			a.log.Errorf("Timeout in partial frame on %s, discarding %d characters", a.name, len(frame))
+			a.diag.commError()
+			inframe = false
+		}
+		for _, ch := range buffer[:n] {
+			last = now
+			switch {
+			case ch == ':':
+				// a start character always begins a new frame, even if the previous one was incomplete
+				inframe = true
+				frame = frame[:0]
+				limit = 2*(a.maxPDUSize()+2) + 1
+			case !inframe:
+				// noise between frames
+			case ch == '\n' && len(frame) > 0 && frame[len(frame)-1] == '\r':
+				a.wlog.log(Received, append(append([]byte{':'}, frame...), '\n'))
+				a.handleFrame(frame[:len(frame)-1])
+				inframe = false
+			case len(frame) < limit:
+				frame = append(frame, ch)
+			default:
+				a.log.Errorf("Too large of a frame on %s, exceeds %d characters", a.name, limit)
+				a.diag.overrun()
+				inframe = false
+			}
+		}
+		// Some channel magic, if the closed channel is closed, it's automatically selected.
+		select {
+		case <-a.closed:
+			alive = false
+		default:
+			// Nothing to see here, move along.
+		}
+	}
+	a.log.Debugf("Terminating serial line reader %s: closed", a.name)
+}
+
+func (a *ascii) handleFrame(encoded []byte) {
+	frame, err := hex.DecodeString(string(encoded))
+	if err != nil {
+		a.log.Errorf("Invalid hex characters in frame on %s: %v", a.name, err)
+		a.diag.commError()
+		return
+	}
+	if len(frame) < 3 {
+		a.log.Errorf("Too small of a frame on %s, just %d bytes", a.name, len(frame))
+		a.diag.commError()
+		return
+	}
+
+	xlrc := LRC(frame[:len(frame)-1])
+	glrc := frame[len(frame)-1]
+	if xlrc != glrc {
+		a.log.Errorf("LRC Mismatch on %s. Expected %d but got %d", a.name, xlrc, glrc)
+		a.diag.commError()
+		return
+	}
+
+	// OK, we have a frame, send it to the respective client.
+	unit := frame[0]
+	function := frame[1]
+	data := frame[2 : len(frame)-1]
+
+	a.diag.message(unit == 0)
+
+	p := pdu{function, data}
+	ad := adu{false, 0, unit, p}
+	a.plock.Lock()
+	if txid, ok := a.pending[unit]; ok {
+		ad.txid = txid
+		delete(a.pending, unit)
+	} else {
+		a.txid++
+		ad.txid = a.txid
+	}
+	a.plock.Unlock()
+
+	a.toDemux <- ad
+}
+
+// wireWriter takes frames that are ready to send and transmits them.
+func (a *ascii) wireWriter() {
+	alive := true
+	for alive {
+		select {
+		case <-a.closed:
+			alive = false
+		case f := <-a.toTX:
+			if f.request {
+				// a broadcast to unit 0 gets no response, unless unit 0 is not a broadcast (see SetUnitZeroBroadcast)
+				a.plock.Lock()
+				a.pending[f.unit] = f.txid
+				a.plock.Unlock()
+			} else {
+				a.diag.response(f.pdu)
+			}
+			frame := buildASCIIFrame(f)
+			a.wlog.log(Sent, frame)
+			for len(frame) > 0 {
+				if n, err := a.serial.Write(frame); err != nil {
+					frame = frame[:0]
+				} else {
+					frame = frame[n:]
+				}
+			}
+		}
+	}
+	a.log.Debugf("Terminating serial line writer %s: closed", a.name)
+}
+
+func buildASCIIFrame(f adu) []byte {
+	data := make([]byte, 0, len(f.pdu.data)+3)
+	data = append(data, f.unit, f.pdu.function)
+	data = append(data, f.pdu.data...)
+	data = append(data, LRC(data))
+	return []byte(":" + strings.ToUpper(hex.EncodeToString(data)) + "\r\n")
+}
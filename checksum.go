@@ -0,0 +1,48 @@
+package modbus
+
+import "fmt"
+
+// CRC16 calculates the Modbus RTU CRC of the data. In an RTU frame the CRC follows the unit, function, and data bytes,
+// with the low byte first (see AppendCRC16 and FrameCRC16).
+func CRC16(data []byte) (crc uint16) {
+	crc = 0xFFFF
+	for _, d := range data {
+		crc ^= uint16(d)
+		for b := 0; b < 8; b++ {
+			if crc&0x1 == 1 {
+				crc >>= 1
+				crc ^= 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return
+}
+
+// LRC calculates the Longitudinal Redundancy Check used by Modbus ASCII, the two's complement of the sum of the bytes.
+// The LRC is calculated on the unit, function, and data bytes before they are encoded as hexadecimal characters.
+func LRC(data []byte) byte {
+	sum := byte(0)
+	for _, b := range data {
+		sum += b
+	}
+	return -sum
+}
+
+// AppendCRC16 returns the RTU frame for the unit, function, and data bytes: the bytes with their CRC appended, low
+// byte first.
+func AppendCRC16(data []byte) []byte {
+	crc := CRC16(data)
+	return append(data, byte(crc), byte(crc>>8))
+}
+
+// FrameCRC16 returns the CRC at the end of an RTU frame (the last 2 bytes, low byte first), and the CRC calculated
+// from the rest of the frame. The frame is valid if they are the same. An error is returned if the frame is too short
+// to have a CRC.
+func FrameCRC16(frame []byte) (got uint16, expect uint16, err error) {
+	if len(frame) < 3 {
+		return 0, 0, fmt.Errorf("Too small of a frame, just %d bytes", len(frame))
+	}
+	return getWordLE(frame, len(frame)-2), CRC16(frame[:len(frame)-2]), nil
+}
@@ -1,54 +1,156 @@
 package modbus
 
 import (
-	"errors"
 	"fmt"
+	"sync"
 	"time"
 )
 
 type client struct {
-	unit  byte
-	trans *modbus
-	rx    chan pdu
+	unit    byte
+	trans   *modbus
+	lock    sync.Mutex
+	limits  Limits
+	poll    time.Duration
+	timeout time.Duration
+	lenient bool
+	// on a serial transport, holds the one request for the unit that can wait for a response
+	turn chan bool
 }
 
+// Limits are the largest number of values that a client will request in a single PDU. Larger requests are
+// automatically split in to multiple PDUs.
+type Limits struct {
+	// ReadBits is the most coils or discretes to read at once
+	ReadBits int
+	// ReadRegisters is the most inputs or holding registers to read at once
+	ReadRegisters int
+	// WriteBits is the most coils to write at once
+	WriteBits int
+	// WriteRegisters is the most holding registers to write at once
+	WriteRegisters int
+}
+
+// DefaultLimits are the Limits given to each new client. The defaults are the maximum values allowed by the Modbus
+// specification, but some devices have smaller limits.
+var DefaultLimits = Limits{
+	ReadBits:       2000,
+	ReadRegisters:  125,
+	WriteBits:      1968,
+	WriteRegisters: 123,
+}
+
+// DefaultTimeout is the timeout given to each new client for the methods that do not have a timeout parameter. See
+// Client.SetDefaultTimeout
+var DefaultTimeout = time.Second
+
 // Client is able to drive a single modbus server (Send functions and get responses)
 type Client interface {
 	// UnitID retrieves the remote unitID we are communicating with
 	UnitID() int
+	// SetLimits changes the largest number of values that are requested in a single PDU. The initial limits are the
+	// DefaultLimits at the time the client was created.
+	SetLimits(limits Limits)
+	// SetAcknowledgePolling controls what happens when the remote unit responds with the Acknowledge exception (code 5),
+	// which means it accepted the request but needs a long time to process it. With an interval greater than 0 the
+	// request is re-issued every interval until it succeeds, fails with a different error, or the timeout expires.
+	// An interval of 0 (the default) returns the Acknowledge exception as an error.
+	SetAcknowledgePolling(interval time.Duration)
+	// SetDefaultTimeout sets the timeout for the ...Default methods, which are the same as the methods of the same name
+	// without the Default suffix, but use this timeout instead of one given with each call. The initial timeout is the
+	// DefaultTimeout at the time the client was created.
+	SetDefaultTimeout(tout time.Duration)
+	// SetLenientWriteValidation controls how the responses to WriteMultipleCoils and WriteMultipleHoldings are checked.
+	// By default (strict) the address and count that the remote unit echoes have to match the request. Some devices
+	// return a different count, or an empty response, when the write succeeds. With lenient validation any response
+	// that is not an exception is a successful write, and the result has the address and count of the request.
+	SetLenientWriteValidation(lenient bool)
+	// Read reads count values of any kind of register from the address, with the same request as ReadDiscretes,
+	// ReadCoils, ReadInputs, or ReadHoldings. It is for code that handles all kinds of register the same way.
+	Read(kind RegisterKind, from int, count int, tout time.Duration) (ReadResult, error)
+	// Batch starts a sequence of requests that are sent in order by Batch.Execute, and that share the timeout.
+	Batch(tout time.Duration) Batch
+	ReadDiscretesDefault(from int, count int) (*X02xReadDiscretes, error)
+	ReadCoilsDefault(from int, count int) (*X01xReadCoils, error)
+	WriteSingleCoilDefault(address int, value bool) (*X05xWriteSingleCoil, error)
+	WriteMultipleCoilsDefault(address int, values []bool) (*X0FxWriteMultipleCoils, error)
+	ReadInputsDefault(from int, count int) (*X04xReadInputs, error)
+	ReadHoldingsDefault(from int, count int) (*X03xReadHolding, error)
+	WriteSingleHoldingDefault(address int, value int) (*X06xWriteSingleHolding, error)
+	WriteMultipleHoldingsDefault(address int, values []int) (*X10xWriteMultipleHoldings, error)
 
-	// ReadDiscretes reads read-only discrete values from the remote unit
+	// ReadDiscretes reads read-only discrete values from the remote unit. Requests for more than the ReadBits limit are
+	// split in to multiple requests, and if a later request fails the error is a *PartialError.
 	ReadDiscretes(from int, count int, tout time.Duration) (*X02xReadDiscretes, error)
+	// ReadDiscrete reads a single discrete value from the remote unit
+	ReadDiscrete(address int, tout time.Duration) (bool, error)
 
-	// ReadDiscretes reads coil values from the remote unit
+	// ReadCoils reads coil values from the remote unit. Requests for more than the ReadBits limit are split in to
+	// multiple requests, and if a later request fails the error is a *PartialError.
 	ReadCoils(from int, count int, tout time.Duration) (*X01xReadCoils, error)
+	// ReadCoil reads a single coil value from the remote unit
+	ReadCoil(address int, tout time.Duration) (bool, error)
 	// WriteSingleCoil writes a single coil values to the remote unit
 	WriteSingleCoil(address int, value bool, tout time.Duration) (*X05xWriteSingleCoil, error)
-	// WriteMultipleCoils writes multiple coil values to the remote unit
+	// WriteMultipleCoils writes multiple coil values to the remote unit. Writes of more than the WriteBits limit are
+	// split in to multiple requests. If a later request fails the error is a *PartialError, and the coils that were
+	// written by the earlier requests remain changed.
 	WriteMultipleCoils(address int, values []bool, tout time.Duration) (*X0FxWriteMultipleCoils, error)
 
-	// ReadInputs reads multiple input values from the remote unit
+	// ReadInputs reads multiple input values from the remote unit. Requests for more than the ReadRegisters limit are
+	// split in to multiple requests, and if a later request fails the error is a *PartialError.
 	ReadInputs(from int, count int, tout time.Duration) (*X04xReadInputs, error)
+	// ReadInput reads a single input value from the remote unit
+	ReadInput(address int, tout time.Duration) (int, error)
 
-	// ReadHoldings reads multipls holding register values from a remote unit
+	// ReadHoldings reads multipls holding register values from a remote unit. Requests for more than the ReadRegisters
+	// limit are split in to multiple requests, and if a later request fails the error is a *PartialError.
 	ReadHoldings(from int, count int, tout time.Duration) (*X03xReadHolding, error)
+	// ReadHolding reads a single holding register value from the remote unit
+	ReadHolding(address int, tout time.Duration) (int, error)
+	// ReadHoldingsMap reads each of the ranges of holding registers from a remote unit and returns the values keyed by
+	// their address
+	ReadHoldingsMap(ranges []AddressRange, tout time.Duration) (map[int]int, error)
+	// ReadHoldingFloat32s reads count IEEE-754 32-bit floats from pairs of holding registers (2*count registers in total)
+	// on the remote unit, combining the register pairs using the word order
+	ReadHoldingFloat32s(from int, count int, order WordOrder, tout time.Duration) ([]float32, error)
 	// WriteSingleHolding writes a single holding register to the remote unit
 	WriteSingleHolding(from int, value int, tout time.Duration) (*X06xWriteSingleHolding, error)
-	// WriteMultipleHoldings writes multiple holding registers to the remote unit
+	// WriteSingleHoldingVerify writes a single holding register like WriteSingleHolding, then reads it back, within the
+	// tout for both requests. It fails if the register does not have the value that was written, for example when the
+	// remote unit clamps the value to a range.
+	WriteSingleHoldingVerify(address int, value int, tout time.Duration) (*X06xWriteSingleHolding, error)
+	// WriteMultipleHoldings writes multiple holding registers to the remote unit. Writes of more than the WriteRegisters
+	// limit are split in to multiple requests. If a later request fails the error is a *PartialError, and the registers
+	// that were written by the earlier requests remain changed.
 	WriteMultipleHoldings(address int, values []int, tout time.Duration) (*X10xWriteMultipleHoldings, error)
+	// WriteHoldingFloat32s writes the values as IEEE-754 32-bit floats to pairs of holding registers on the remote unit,
+	// splitting each value in to a register pair using the word order
+	WriteHoldingFloat32s(from int, values []float32, order WordOrder, tout time.Duration) (*X10xWriteMultipleHoldings, error)
+	// WriteHoldingString packs the string in to holding registers on the remote unit, 2 characters per register using the
+	// byte order. If the string has an odd length the last register is padded with a null.
+	WriteHoldingString(from int, s string, order ByteOrder, tout time.Duration) (*X10xWriteMultipleHoldings, error)
+	// WriteHoldingBCD writes the values to holding registers on the remote unit as 4 binary-coded-decimal digits per
+	// register (1234 is 0x1234). The values must be from 0 to 9999.
+	WriteHoldingBCD(from int, values []int, tout time.Duration) (*X10xWriteMultipleHoldings, error)
 	// WriteReadMultipleHoldings initially writes one set of holding registers to the remote unit, then in the same
-	// operation reads multiple values from the remote unit. The addresses being written and then read do not need to overlap
+	// operation reads multiple values from the remote unit. The addresses being written and then read do not need to overlap,
+	// but if they do, the values read are the values after the write. At most 125 registers can be read, and 121 written.
 	WriteReadMultipleHoldings(read int, count int, write int, values []int, tout time.Duration) (*X17xWriteReadHoldings, error)
 	// MaskWriteHolding applies an AND mask and an OR mask to a register on the remote unit. The logic is:
 	// Result = (Current Contents AND And_Mask) OR (Or_Mask AND (NOT And_Mask))
 	MaskWriteHolding(address int, andmask int, ormask int, tout time.Duration) (*X16xMaskWriteHolding, error)
 	// Reads a variable number of values from the remote unit's holding register. At most 31 values can be retrieved
 	// and the count of values depends on the value at the specified address (if the value at address is 3, it will return the three
-	// values that are in address+1, address+2, address+3)
+	// values that are in address+1, address+2, address+3). When the queue is empty (the count is 0) the Values are empty,
+	// and a count of more than 31 from the remote unit is an error.
 	ReadFIFOQueue(from int, tout time.Duration) (*X18xReadFIFOQueue, error)
 
 	// ReadMultiFileRecords retrieves multiple sequences of File records from the remote unit
 	ReadMultiFileRecords(requests []X14xReadRecordRequest, tout time.Duration) (*X14xReadMultiFileRecord, error)
+	// ReadMultiFileRecordsTolerant is like ReadMultiFileRecords, but if the request fails, each record is requested
+	// individually, and the records that fail have the Err set in the result instead of failing the whole request
+	ReadMultiFileRecordsTolerant(requests []X14xReadRecordRequest, tout time.Duration) (*X14xReadMultiFileRecord, error)
 	// ReadFileRecords retrieves a sequence of records from a file on a remote unit
 	ReadFileRecords(file int, record int, length int, tout time.Duration) (*X14xReadFileRecordResult, error)
 	// WriteMultiFileRecords writes sequences of records to multiple files on a remote unit
@@ -63,87 +165,244 @@ type Client interface {
 	ServerID(tout time.Duration) (*X11xServerID, error)
 	// DiagnosticRegister retrieves the diagnostic sub-function 2 register. The value is device-specific.
 	DiagnosticRegister(tout time.Duration) (*X08xDiagnosticRegister, error)
-	// DiagnosticEcho responds with the exact same content that was sent.
+	// DiagnosticEcho responds with the exact same content that was sent. At most 125 words (0 to 65535) can be sent.
 	DiagnosticEcho(data []int, tout time.Duration) (*X08xDiagnosticEcho, error)
+	// PingDevice sends a one-word DiagnosticEcho to check that the remote unit is responding, and returns the time it
+	// took to get the echo back.
+	PingDevice(tout time.Duration) (time.Duration, error)
+	// Ping checks that the remote unit is alive, and returns the time it took to respond. It sends the same request as
+	// PingDevice, but an exception response counts as alive (the remote unit answered, even if it does not support
+	// the Diagnostic Echo). A timeout, a failure of the connection, or a gateway exception (0x0A or 0x0B, the unit behind
+	// the gateway did not respond) is an error.
+	Ping(tout time.Duration) (time.Duration, error)
 	// DiagnosticClear resets all counters and logs on the remote unit
 	DiagnosticClear(tout time.Duration) error
 	// DiagnosticCount retrieves a specific diagnostic counter from the remote unit. See the Diagnostic constants for valid
 	// Diagnostic values.
 	DiagnosticCount(counter Diagnostic, tout time.Duration) (*X08xDiagnosticCount, error)
+	// AllDiagnosticCounts retrieves all the Diagnostic counters from the remote unit, one request per counter, within
+	// the tout for all of them. It stops at the first counter that fails.
+	AllDiagnosticCounts(tout time.Duration) (map[Diagnostic]int, error)
 	// DiagnosticOverrunClear resets the overrun counter
 	DiagnosticOverrunClear(echo int, tout time.Duration) (*X08xDiagnosticOverrunClear, error)
+	// ForceListenOnly puts the remote unit in listen only mode, where it does not respond to any request except a
+	// Restart Communications request. The remote unit does not respond to this request either, so it completes once it
+	// is sent.
+	ForceListenOnly(tout time.Duration) error
+	// RestartComm restarts the communications of the remote unit, which clears its counters, and its event log if
+	// clearLog is true, and takes it out of listen only mode. A remote unit that was in listen only mode does not
+	// respond, so the request times out (with ErrTimeout) even though it succeeded.
+	RestartComm(clearLog bool, tout time.Duration) error
 	// CommEventCounter returns the number of "regular" operations on the remote unit. Regular operations access
 	// discretes, coils, inputs, registers, and/or files
 	CommEventCounter(tout time.Duration) (*X0BxCommEventCounter, error)
 	// CommEventLog retrieves the basic details of the most recent 64 messages on the remote unit
 	CommEventLog(tout time.Duration) (*X0CxCommEventLog, error)
+	// StreamCommEventLog polls the remote unit's CommEventLog every interval and emits only the events that were not
+	// seen in a previous poll (oldest first). Polls that fail are skipped. Call the returned function to stop polling,
+	// after which the channel is closed.
+	StreamCommEventLog(interval time.Duration, tout time.Duration) (<-chan CommEvent, func())
 	// DeviceIdentification retrieves all the remote unit's device labels.
 	DeviceIdentification(tout time.Duration) (*X2BxDeviceIdentification, error)
 	// DeviceIdentification retrieves a remote unit's specific device label.
 	DeviceIdentificationObject(objectID int, tout time.Duration) (*X2BxDeviceIdentificationObject, error)
+	// DeviceIdentificationRange retrieves the remote unit's device labels for the Read Device ID code (1 basic, 2
+	// regular, 3 extended, or 4 for one specific object), starting at the object ID from. All the objects are returned,
+	// even if the remote unit needs several responses to send them.
+	DeviceIdentificationRange(code int, from int, tout time.Duration) (*X2BxDeviceIdentificationRange, error)
+	// EncapsulatedInterface sends the data using the Encapsulated Interface Transport (0x2B) with the MEI type, for
+	// example 0x0D for the CANopen General Reference, and returns the response data after the MEI type. Use
+	// DeviceIdentification and DeviceIdentificationObject for the Read Device Identification MEI type (0x0E).
+	EncapsulatedInterface(meiType int, data []int, tout time.Duration) ([]int, error)
 
-	// DebugRaw(function byte, payload []byte, tout time.Duration) (*X00xDebugRaw, error)
+	// DebugRaw sends the payload verbatim as a request for any function (1 to 127), and returns the raw response data.
+	// This is useful for vendor-specific functions that are not otherwise supported. Exception responses are still
+	// returned as an error.
+	DebugRaw(function int, payload []int, tout time.Duration) (*X00xDebugRaw, error)
 }
 
 func (c *client) UnitID() int {
 	return int(c.unit)
 }
 
+func (c *client) SetLimits(limits Limits) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.limits = limits
+}
+
+// getLimits returns the limits, reduced where needed so that the requests and responses fit in the largest PDU of the
+// Modbus
+func (c *client) getLimits() Limits {
+	c.lock.Lock()
+	limits := c.limits
+	c.lock.Unlock()
+	max := c.trans.MaxPDUSize()
+	// a read response has the function code and byte count, a write request the function code, address, count, and
+	// byte count
+	limits.ReadBits = minInt(limits.ReadBits, (max-2)*8)
+	limits.ReadRegisters = minInt(limits.ReadRegisters, (max-2)/2)
+	limits.WriteBits = minInt(limits.WriteBits, (max-6)*8)
+	limits.WriteRegisters = minInt(limits.WriteRegisters, (max-6)/2)
+	return limits
+}
+
+func (c *client) SetAcknowledgePolling(interval time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.poll = interval
+}
+
+func (c *client) getAcknowledgePolling() time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.poll
+}
+
+func (c *client) SetDefaultTimeout(tout time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.timeout = tout
+}
+
+func (c *client) getDefaultTimeout() time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.timeout
+}
+
+func (c *client) SetLenientWriteValidation(lenient bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.lenient = lenient
+}
+
+func (c *client) lenientWrites() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.lenient
+}
+
 type readDecoder func(*dataReader) error
 
 // query is a reuable function that all client-operations uses to coordinate the communication
-// with the remote server.
+// with the remote server. A nil callback is used for requests that the remote server does not respond to, they
+// complete once they are sent.
 func (c *client) query(tout time.Duration, tx pdu, callback readDecoder) <-chan error {
 	errc := make(chan error, 0)
 	go func() {
-		ticker := time.NewTimer(tout)
-		c.trans.txid++
-		a := adu{true, c.trans.txid, byte(c.unit), tx}
-		select {
-		case <-ticker.C:
-			errc <- fmt.Errorf("Timeout exceeded waiting to send: %v", tout)
+		if size, max := len(tx.data)+1, c.trans.MaxPDUSize(); size > max {
+			errc <- fmt.Errorf("Request of %v bytes exceeds the maximum PDU size of %v bytes", size, max)
+			close(errc)
 			return
-		case c.trans.tx <- a:
-			// great, sent the data.....
 		}
-		select {
-		case <-ticker.C:
-			errc <- fmt.Errorf("Timeout exceeded waiting to receive: %v", tout)
-			return
-		case rx := <-c.rx:
-			// great, received the data.....
-			var err error
-			if rx.function >= 128 {
-				// error condition
-				ec := byte(0)
-				if len(rx.data) > 0 {
-					ec = rx.data[0]
+		ticker := time.NewTimer(tout)
+		poll := c.getAcknowledgePolling()
+		// the request duration is measured from when the first request is sent
+		start := time.Now()
+		sent := false
+		observe := func(err error) error {
+			c.trans.observe(c.unit, tx.function, time.Since(start), err)
+			return err
+		}
+		if c.turn != nil {
+			// the response on a serial transport is matched by unit, so wait for the unit's earlier requests to complete
+			select {
+			case <-ticker.C:
+				errc <- observe(fmt.Errorf("%w waiting to send: %v", ErrTimeout, tout))
+				return
+			case c.turn <- true:
+				defer func() { <-c.turn }()
+			}
+		}
+		for {
+			// each request gets its own transaction id, and its response is correlated to it, so many requests can be
+			// waiting for responses at the same time.
+			response := make(chan reply, 1)
+			txid, err := c.trans.register(c.unit, response)
+			if err != nil {
+				errc <- observe(err)
+				close(errc)
+				return
+			}
+			a := adu{true, txid, byte(c.unit), tx}
+			select {
+			case <-ticker.C:
+				c.trans.release(txid)
+				errc <- observe(fmt.Errorf("%w waiting to send: %v", ErrTimeout, tout))
+				return
+			case c.trans.tx <- a:
+				// great, sent the data.....
+			}
+			if !sent {
+				start = time.Now()
+				sent = true
+			}
+			if c.trans.broadcast(c.unit) {
+				// a broadcast, there is no response. Give the remote units time to process it.
+				observe(nil)
+				time.Sleep(c.trans.broadcastDelay())
+				errc <- nil
+				close(errc)
+				return
+			}
+			if callback == nil {
+				// no response is expected
+				c.trans.release(txid)
+				errc <- observe(nil)
+				close(errc)
+				return
+			}
+			select {
+			case <-ticker.C:
+				c.trans.release(txid)
+				errc <- observe(fmt.Errorf("%w waiting to receive: %v", ErrTimeout, tout))
+				return
+			case rep := <-response:
+				if rep.err != nil {
+					errc <- observe(rep.err)
+					close(errc)
+					return
 				}
-				switch ec {
-				case 1:
-					err = errors.New("Modbus Illegal Function")
-				case 2:
-					err = errors.New("Modbus Illegal Data Address")
-				case 3:
-					err = errors.New("Modbus Illegal Data Value")
-				case 4:
-					err = errors.New("Modbus Server Device Failure")
-				case 5:
-					err = errors.New("Modbus ACK Only")
-				case 6:
-					err = errors.New("Modbus Server Busy")
-				default:
-					err = fmt.Errorf("Modbus Unknown error code: %v", ec)
+				// great, received the data.....
+				rx := rep.pdu
+				if poll > 0 && rx.function >= 128 && len(rx.data) > 0 && rx.data[0] == 5 {
+					// Acknowledged, but still processing. Wait, then ask again.
+					select {
+					case <-ticker.C:
+						errc <- observe(fmt.Errorf("%w waiting for acknowledged request to complete: %v", ErrTimeout, tout))
+						return
+					case <-time.After(poll):
+					}
+					continue
 				}
-			} else {
-				reader := getReader(rx.data)
-				err = callback(&reader)
-				if err == nil {
-					err = reader.remaining()
+				var err error
+				if rx.function&0x7f != tx.function {
+					// the response is for a different request, its data cannot be decoded for this one
+					raw := append([]byte{rx.function}, rx.data...)
+					err = &DecodeError{int(rx.function), raw, fmt.Errorf("Response function mismatch: expected 0x%02x but got 0x%02x", tx.function, rx.function)}
+				} else if rx.function >= 128 {
+					// error condition
+					ec := byte(0)
+					if len(rx.data) > 0 {
+						ec = rx.data[0]
+					}
+					err = exceptionError(ec)
+				} else {
+					reader := getReader(rx.data)
+					err = callback(&reader)
+					if err == nil {
+						err = reader.remaining()
+					}
+					if err != nil {
+						raw := append([]byte{rx.function}, rx.data...)
+						err = &DecodeError{int(rx.function), raw, err}
+					}
 				}
+				errc <- observe(err)
+				close(errc)
+				return
 			}
-			errc <- err
-			close(errc)
 		}
 	}()
 	return errc
@@ -0,0 +1,196 @@
+package modbus
+
+import (
+	"fmt"
+	"time"
+)
+
+/*
+Batch accumulates requests to a remote unit that are then sent, in order, by Execute. The requests share a single
+timeout: each request gets the time that remains of it. The results of the requests are returned when they are added,
+and are filled in when Execute succeeds:
+
+	batch := client.Batch(time.Second)
+	holdings := batch.ReadHoldings(0, 10)
+	batch.WriteSingleCoil(3, true)
+	err := batch.Execute()
+	// error handling
+	fmt.Println(holdings.Values)
+
+A Batch is not safe to use from multiple go-routines.
+*/
+type Batch interface {
+	// ReadDiscretes adds a ReadDiscretes request to the batch
+	ReadDiscretes(from int, count int) *X02xReadDiscretes
+	// ReadCoils adds a ReadCoils request to the batch
+	ReadCoils(from int, count int) *X01xReadCoils
+	// WriteSingleCoil adds a WriteSingleCoil request to the batch
+	WriteSingleCoil(address int, value bool) *X05xWriteSingleCoil
+	// WriteMultipleCoils adds a WriteMultipleCoils request to the batch
+	WriteMultipleCoils(address int, values []bool) *X0FxWriteMultipleCoils
+	// ReadInputs adds a ReadInputs request to the batch
+	ReadInputs(from int, count int) *X04xReadInputs
+	// ReadHoldings adds a ReadHoldings request to the batch
+	ReadHoldings(from int, count int) *X03xReadHolding
+	// WriteSingleHolding adds a WriteSingleHolding request to the batch
+	WriteSingleHolding(address int, value int) *X06xWriteSingleHolding
+	// WriteMultipleHoldings adds a WriteMultipleHoldings request to the batch
+	WriteMultipleHoldings(address int, values []int) *X10xWriteMultipleHoldings
+	// Execute sends the requests in the order they were added. It stops at the first request that fails, and returns
+	// a *BatchError that identifies it. The requests before it have completed (writes have changed the remote unit),
+	// and the requests after it are not sent.
+	Execute() error
+}
+
+// BatchError is returned by Batch.Execute when a request fails.
+type BatchError struct {
+	// Index is the position of the failed request in the batch, starting at 0
+	Index int
+	// Operation is the name of the failed request, e.g. "ReadHoldings"
+	Operation string
+	// Err is the reason the request failed
+	Err error
+}
+
+func (err *BatchError) Error() string {
+	return fmt.Sprintf("Batch request %v (%v) failed: %v", err.Index, err.Operation, err.Err)
+}
+
+// Unwrap returns the reason the request failed
+func (err *BatchError) Unwrap() error {
+	return err.Err
+}
+
+type batchOp struct {
+	name string
+	run  func(tout time.Duration) error
+}
+
+type batch struct {
+	client Client
+	tout   time.Duration
+	ops    []batchOp
+}
+
+func newBatch(client Client, tout time.Duration) *batch {
+	return &batch{client: client, tout: tout}
+}
+
+func (c *client) Batch(tout time.Duration) Batch {
+	return newBatch(c, tout)
+}
+
+func (b *batch) add(name string, run func(tout time.Duration) error) {
+	b.ops = append(b.ops, batchOp{name, run})
+}
+
+func (b *batch) ReadDiscretes(from int, count int) *X02xReadDiscretes {
+	ret := &X02xReadDiscretes{}
+	b.add("ReadDiscretes", func(tout time.Duration) error {
+		got, err := b.client.ReadDiscretes(from, count, tout)
+		if err == nil {
+			*ret = *got
+		}
+		return err
+	})
+	return ret
+}
+
+func (b *batch) ReadCoils(from int, count int) *X01xReadCoils {
+	ret := &X01xReadCoils{}
+	b.add("ReadCoils", func(tout time.Duration) error {
+		got, err := b.client.ReadCoils(from, count, tout)
+		if err == nil {
+			*ret = *got
+		}
+		return err
+	})
+	return ret
+}
+
+func (b *batch) WriteSingleCoil(address int, value bool) *X05xWriteSingleCoil {
+	ret := &X05xWriteSingleCoil{}
+	b.add("WriteSingleCoil", func(tout time.Duration) error {
+		got, err := b.client.WriteSingleCoil(address, value, tout)
+		if err == nil {
+			*ret = *got
+		}
+		return err
+	})
+	return ret
+}
+
+func (b *batch) WriteMultipleCoils(address int, values []bool) *X0FxWriteMultipleCoils {
+	ret := &X0FxWriteMultipleCoils{}
+	b.add("WriteMultipleCoils", func(tout time.Duration) error {
+		got, err := b.client.WriteMultipleCoils(address, values, tout)
+		if err == nil {
+			*ret = *got
+		}
+		return err
+	})
+	return ret
+}
+
+func (b *batch) ReadInputs(from int, count int) *X04xReadInputs {
+	ret := &X04xReadInputs{}
+	b.add("ReadInputs", func(tout time.Duration) error {
+		got, err := b.client.ReadInputs(from, count, tout)
+		if err == nil {
+			*ret = *got
+		}
+		return err
+	})
+	return ret
+}
+
+func (b *batch) ReadHoldings(from int, count int) *X03xReadHolding {
+	ret := &X03xReadHolding{}
+	b.add("ReadHoldings", func(tout time.Duration) error {
+		got, err := b.client.ReadHoldings(from, count, tout)
+		if err == nil {
+			*ret = *got
+		}
+		return err
+	})
+	return ret
+}
+
+func (b *batch) WriteSingleHolding(address int, value int) *X06xWriteSingleHolding {
+	ret := &X06xWriteSingleHolding{}
+	b.add("WriteSingleHolding", func(tout time.Duration) error {
+		got, err := b.client.WriteSingleHolding(address, value, tout)
+		if err == nil {
+			*ret = *got
+		}
+		return err
+	})
+	return ret
+}
+
+func (b *batch) WriteMultipleHoldings(address int, values []int) *X10xWriteMultipleHoldings {
+	ret := &X10xWriteMultipleHoldings{}
+	b.add("WriteMultipleHoldings", func(tout time.Duration) error {
+		got, err := b.client.WriteMultipleHoldings(address, values, tout)
+		if err == nil {
+			*ret = *got
+		}
+		return err
+	})
+	return ret
+}
+
+func (b *batch) Execute() error {
+	deadline := time.Now().Add(b.tout)
+	for i, op := range b.ops {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return &BatchError{i, op.name, fmt.Errorf("%w before the request was sent: %v", ErrTimeout, b.tout)}
+		}
+		err := op.run(remaining)
+		if err != nil {
+			return &BatchError{i, op.name, err}
+		}
+	}
+	return nil
+}
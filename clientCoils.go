@@ -25,10 +25,34 @@ func (s X01xReadCoils) String() string {
 }
 
 func (c *client) ReadCoils(from int, count int, tout time.Duration) (*X01xReadCoils, error) {
-	p := dataBuilder{}
-	p.word(from)
-	p.word(count)
-	tx := pdu{0x01, p.payload()}
+	ret := &X01xReadCoils{Address: from}
+	err := chunked(from, count, c.getLimits().ReadBits, func(from int, count int) error {
+		res, err := c.readCoils(from, count, tout)
+		if err != nil {
+			return err
+		}
+		ret.Coils = append(ret.Coils, res.Coils...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (c *client) ReadCoil(address int, tout time.Duration) (bool, error) {
+	res, err := c.ReadCoils(address, 1, tout)
+	if err != nil {
+		return false, err
+	}
+	if len(res.Coils) != 1 {
+		return false, fmt.Errorf("Expected 1 coil from %05d, but got %v", address, len(res.Coils))
+	}
+	return res.Coils[0], nil
+}
+
+func (c *client) readCoils(from int, count int, tout time.Duration) (*X01xReadCoils, error) {
+	tx := encodeAddressCount(0x01, from, count)
 	ret := &X01xReadCoils{}
 	decode := func(r *dataReader) error {
 		coils, err := r.bits(count)
@@ -61,14 +85,7 @@ func (s X05xWriteSingleCoil) String() string {
 }
 
 func (c *client) WriteSingleCoil(address int, value bool, tout time.Duration) (*X05xWriteSingleCoil, error) {
-	p := dataBuilder{}
-	p.word(address)
-	if value {
-		p.word(0xFF00)
-	} else {
-		p.word(0x0000)
-	}
-	tx := pdu{0x05, p.payload()}
+	tx := encodeWriteSingleCoil(address, value)
 	ret := &X05xWriteSingleCoil{}
 	decode := func(r *dataReader) error {
 		err := r.canRead(4)
@@ -99,20 +116,48 @@ func (s X0FxWriteMultipleCoils) String() string {
 }
 
 func (c *client) WriteMultipleCoils(address int, values []bool, tout time.Duration) (*X0FxWriteMultipleCoils, error) {
-	p := dataBuilder{}
-	p.word(address)
-	p.nbits(values...)
-	tx := pdu{0x0F, p.payload()}
+	ret := &X0FxWriteMultipleCoils{Address: address}
+	err := chunked(address, len(values), c.getLimits().WriteBits, func(from int, count int) error {
+		res, err := c.writeMultipleCoils(from, values[from-address:from-address+count], tout)
+		if err != nil {
+			return err
+		}
+		ret.Count += res.Count
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (c *client) writeMultipleCoils(address int, values []bool, tout time.Duration) (*X0FxWriteMultipleCoils, error) {
+	tx := encodeWriteMultipleCoils(address, values)
 	ret := &X0FxWriteMultipleCoils{}
 	decode := func(r *dataReader) error {
-		err := r.canRead(4)
+		if c.lenientWrites() {
+			// the response is not an exception, so the write succeeded, whatever the response contains
+			r.bytesRaw(len(r.data) - r.cursor)
+			ret.Address = address
+			ret.Count = len(values)
+			return nil
+		}
+		got, err := r.word()
 		if err != nil {
 			return err
 		}
-		a, _ := r.word()
-		c, _ := r.word()
-		ret.Address = a
-		ret.Count = c
+		if got != address {
+			return fmt.Errorf("Expect Write Multiple Coils response to for the same address %v, not %v", address, got)
+		}
+		set, err := r.word()
+		if err != nil {
+			return err
+		}
+		if set != len(values) {
+			return fmt.Errorf("Expect Write Multiple Coils response to for the same coil count %v, not %v", len(values), set)
+		}
+		ret.Address = address
+		ret.Count = set
 		return nil
 	}
 	err := <-c.query(tout, tx, decode)
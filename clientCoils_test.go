@@ -0,0 +1,102 @@
+package modbus
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteMultipleCoilsEcho(t *testing.T) {
+	client, server := newTestServer(t)
+	// the server echoes the address, but with one coil more than was written
+	server.RegisterFunctionHandler(0x0f, 5, func(mb Modbus, request []byte) ([]byte, error) {
+		response := append([]byte{}, request[:4]...)
+		response[3]++
+		return response, nil
+	})
+
+	_, err := client.WriteMultipleCoils(4, []bool{true, false, true}, time.Second)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("Expected a DecodeError for the wrong count in strict mode, not %v", err)
+	}
+
+	client.SetLenientWriteValidation(true)
+	got, err := client.WriteMultipleCoils(4, []bool{true, false, true}, time.Second)
+	if err != nil {
+		t.Fatalf("Expected the wrong count to be accepted in lenient mode: %v", err)
+	}
+	if got.Address != 4 || got.Count != 3 {
+		t.Fatalf("Expected the address and count of the request, not %v", got)
+	}
+}
+
+func TestWriteMultipleCoilsWrongAddress(t *testing.T) {
+	client, server := newTestServer(t)
+	// the server echoes the count, but with a different address
+	server.RegisterFunctionHandler(0x0f, 5, func(mb Modbus, request []byte) ([]byte, error) {
+		response := append([]byte{}, request[:4]...)
+		response[1]++
+		return response, nil
+	})
+	_, err := client.WriteMultipleCoils(4, []bool{true, false, true}, time.Second)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("Expected a DecodeError for the wrong address, not %v", err)
+	}
+}
+
+func TestReadBitsChunked(t *testing.T) {
+	clientSide, serverSide := NewLoopback()
+	defer clientSide.Close()
+	server, _ := NewServer([]byte{1}, []string{"a", "b", "c"})
+	server.RegisterCoils(4100, acceptCoils)
+	server.RegisterDiscretes(4100)
+	values := make([]bool, 4100)
+	for i := range values {
+		values[i] = i%3 == 0 || i%7 == 0
+	}
+	if err := server.WriteCoilsAtomic(0, values); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.WriteDiscretesAtomic(0, values); err != nil {
+		t.Fatal(err)
+	}
+	serverSide.SetServer(1, server)
+	client := clientSide.GetClient(1)
+
+	lock := sync.Mutex{}
+	requests := make(map[int]int)
+	clientSide.SetRequestObserver(func(unit int, function int, dur time.Duration, err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		requests[function]++
+	})
+
+	coils, err := client.ReadCoils(0, 4100, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	discretes, err := client.ReadDiscretes(0, 4100, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	// at most 2000 bits are read in a request
+	if requests[0x01] != 3 || requests[0x02] != 3 {
+		t.Fatalf("Expected 3 requests for each of the coils and discretes, not %v", requests)
+	}
+	for name, got := range map[string][]bool{"coils": coils.Coils, "discretes": discretes.Discretes} {
+		if len(got) != len(values) {
+			t.Fatalf("Expected %v %v, not %v", len(values), name, len(got))
+		}
+		for i, v := range values {
+			if got[i] != v {
+				t.Fatalf("Expected %v %v to be %v, not %v", name, i, v, got[i])
+			}
+		}
+	}
+}
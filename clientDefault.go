@@ -0,0 +1,35 @@
+package modbus
+
+// The ...Default methods use the client's default timeout, see SetDefaultTimeout
+
+func (c *client) ReadDiscretesDefault(from int, count int) (*X02xReadDiscretes, error) {
+	return c.ReadDiscretes(from, count, c.getDefaultTimeout())
+}
+
+func (c *client) ReadCoilsDefault(from int, count int) (*X01xReadCoils, error) {
+	return c.ReadCoils(from, count, c.getDefaultTimeout())
+}
+
+func (c *client) WriteSingleCoilDefault(address int, value bool) (*X05xWriteSingleCoil, error) {
+	return c.WriteSingleCoil(address, value, c.getDefaultTimeout())
+}
+
+func (c *client) WriteMultipleCoilsDefault(address int, values []bool) (*X0FxWriteMultipleCoils, error) {
+	return c.WriteMultipleCoils(address, values, c.getDefaultTimeout())
+}
+
+func (c *client) ReadInputsDefault(from int, count int) (*X04xReadInputs, error) {
+	return c.ReadInputs(from, count, c.getDefaultTimeout())
+}
+
+func (c *client) ReadHoldingsDefault(from int, count int) (*X03xReadHolding, error) {
+	return c.ReadHoldings(from, count, c.getDefaultTimeout())
+}
+
+func (c *client) WriteSingleHoldingDefault(address int, value int) (*X06xWriteSingleHolding, error) {
+	return c.WriteSingleHolding(address, value, c.getDefaultTimeout())
+}
+
+func (c *client) WriteMultipleHoldingsDefault(address int, values []int) (*X10xWriteMultipleHoldings, error) {
+	return c.WriteMultipleHoldings(address, values, c.getDefaultTimeout())
+}
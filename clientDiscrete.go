@@ -25,10 +25,34 @@ func (s X02xReadDiscretes) String() string {
 }
 
 func (c *client) ReadDiscretes(from int, count int, tout time.Duration) (*X02xReadDiscretes, error) {
-	p := dataBuilder{}
-	p.word(from)
-	p.word(count)
-	tx := pdu{0x02, p.payload()}
+	ret := &X02xReadDiscretes{Address: from}
+	err := chunked(from, count, c.getLimits().ReadBits, func(from int, count int) error {
+		res, err := c.readDiscretes(from, count, tout)
+		if err != nil {
+			return err
+		}
+		ret.Discretes = append(ret.Discretes, res.Discretes...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (c *client) ReadDiscrete(address int, tout time.Duration) (bool, error) {
+	res, err := c.ReadDiscretes(address, 1, tout)
+	if err != nil {
+		return false, err
+	}
+	if len(res.Discretes) != 1 {
+		return false, fmt.Errorf("Expected 1 discrete from %05d, but got %v", address, len(res.Discretes))
+	}
+	return res.Discretes[0], nil
+}
+
+func (c *client) readDiscretes(from int, count int, tout time.Duration) (*X02xReadDiscretes, error) {
+	tx := encodeAddressCount(0x02, from, count)
 	ret := &X02xReadDiscretes{}
 	decode := func(r *dataReader) error {
 		bools, err := r.bits(count)
@@ -0,0 +1,79 @@
+package modbus
+
+import (
+	"sync"
+	"time"
+)
+
+func (c *client) StreamCommEventLog(interval time.Duration, tout time.Duration) (<-chan CommEvent, func()) {
+	events := make(chan CommEvent)
+	done := make(chan bool)
+	var once sync.Once
+	stop := func() {
+		once.Do(func() { close(done) })
+	}
+
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var previous *X0CxCommEventLog
+		for {
+			log, err := c.CommEventLog(tout)
+			if err == nil {
+				fresh := newCommEvents(previous, log)
+				previous = log
+				// the log is most-recent-first, emit the oldest new event first
+				for i := fresh - 1; i >= 0; i-- {
+					select {
+					case events <- decodeCommEvent(log.Events[i], log.MessageCount):
+					case <-done:
+						return
+					}
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return events, stop
+}
+
+// newCommEvents returns how many of the (most-recent-first) events in the current log were not in the previous log.
+func newCommEvents(previous *X0CxCommEventLog, current *X0CxCommEventLog) int {
+	if previous == nil {
+		return len(current.Events)
+	}
+	// the message counter is a 16-bit value that wraps around
+	delta := (current.MessageCount - previous.MessageCount) & 0xffff
+	if delta == 0 {
+		return 0
+	}
+	// Each new message adds at least one event, so the log has shifted by at least delta events. Periodic logs (the
+	// same receive and send events for each poll) overlap at smaller shifts too, so the search starts at delta. Find
+	// the smallest shift from there where the remaining events overlap with what we saw before. If nothing overlaps
+	// then all the events are new (and we may have missed some).
+	for shift := minInt(delta, len(current.Events)); shift < len(current.Events); shift++ {
+		if commEventsOverlap(current.Events[shift:], previous.Events) {
+			return shift
+		}
+	}
+	return len(current.Events)
+}
+
+func commEventsOverlap(current []int, previous []int) bool {
+	if len(current) > len(previous) {
+		current = current[:len(previous)]
+	}
+	for i, e := range current {
+		if previous[i] != e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,29 @@
+package modbus
+
+import "testing"
+
+func TestNewCommEventsPeriodic(t *testing.T) {
+	// each poll adds a receive (0x80) and a send (0x40) event, so the log overlaps itself at every even shift
+	previous := &X0CxCommEventLog{MessageCount: 10, Events: []int{0x40, 0x80, 0x40, 0x80, 0x40, 0x80}}
+	current := &X0CxCommEventLog{MessageCount: 14, Events: []int{0x40, 0x80, 0x40, 0x80, 0x40, 0x80}}
+	if got := newCommEvents(previous, current); got != 4 {
+		t.Fatalf("Expected 4 new events, not %v", got)
+	}
+}
+
+func TestNewCommEventsWrapAround(t *testing.T) {
+	previous := &X0CxCommEventLog{MessageCount: 0xfffe, Events: []int{0x40, 0x80, 0x40, 0x80}}
+	current := &X0CxCommEventLog{MessageCount: 0x0000, Events: []int{0x40, 0x80, 0x40, 0x80}}
+	if got := newCommEvents(previous, current); got != 2 {
+		t.Fatalf("Expected 2 new events across the counter wrap, not %v", got)
+	}
+	unchanged := &X0CxCommEventLog{MessageCount: 0xfffe, Events: []int{0x40, 0x80, 0x40, 0x80}}
+	if got := newCommEvents(previous, unchanged); got != 0 {
+		t.Fatalf("Expected no new events, not %v", got)
+	}
+	// more new messages than the log holds
+	current = &X0CxCommEventLog{MessageCount: 0x0010, Events: []int{0x40, 0x80, 0x40, 0x80}}
+	if got := newCommEvents(previous, current); got != 4 {
+		t.Fatalf("Expected all 4 events to be new, not %v", got)
+	}
+}
@@ -23,9 +23,14 @@ type X14xReadFileRecordResult struct {
 	File   int
 	Record int
 	Values []int
+	// Err is only set by ReadMultiFileRecordsTolerant, when this record could not be read
+	Err error
 }
 
 func (s X14xReadFileRecordResult) String() string {
+	if s.Err != nil {
+		return fmt.Sprintf("X14xReadFileRecordResult 0x%04x->0x%04x: failed: %v", s.File, s.Record, s.Err)
+	}
 	parts := make([]string, len(s.Values))
 	for i, v := range s.Values {
 		parts[i] = fmt.Sprintf("      0x%04x", v)
@@ -46,27 +51,25 @@ func (s X14xReadMultiFileRecord) String() string {
 	return fmt.Sprintf("X14xReadMultiFileRecord:\n%s", strings.Join(parts, "\n"))
 }
 
-func (c client) ReadMultiFileRecords(requests []X14xReadRecordRequest, tout time.Duration) (*X14xReadMultiFileRecord, error) {
+func (c *client) ReadMultiFileRecords(requests []X14xReadRecordRequest, tout time.Duration) (*X14xReadMultiFileRecord, error) {
 	expect := 1 + len(requests)*2
 	for _, r := range requests {
+		if err := clientCheckFileRecord(r.File, r.Record, r.Length); err != nil {
+			return nil, err
+		}
 		expect += r.Length * 2
 	}
-	if expect > 253 {
-		return nil, fmt.Errorf("Request will result in response of %v bytes which exceeds the limit of 253", expect)
+	// the request and response PDUs are the function code and the payload, and their byte counts are single bytes,
+	// even with a larger maximum PDU size
+	max := minInt(c.trans.MaxPDUSize(), 0xff+1)
+	if expect+1 > max {
+		return nil, fmt.Errorf("Request will result in response of %v bytes which exceeds the limit of %v", expect+1, max)
 	}
 	sz := 1 + 7*len(requests)
-	if sz > 253 {
-		return nil, fmt.Errorf("Too many record requests since the request will be too large: %v bytes exceeds limit of 253", sz)
-	}
-	p := dataBuilder{}
-	p.beacon() // set a byte counter here...
-	for _, req := range requests {
-		p.byte(6) // from spec: The reference type: 1 byte (must be specified as 6)
-		p.word(req.File)
-		p.word(req.Record)
-		p.word(req.Length)
-	}
-	tx := pdu{0x14, p.payload()}
+	if sz+1 > max {
+		return nil, fmt.Errorf("Too many record requests since the request will be too large: %v bytes exceeds limit of %v", sz+1, max)
+	}
+	tx := encodeReadFileRecords(requests)
 	ret := &X14xReadMultiFileRecord{Records: make([]X14xReadFileRecordResult, 0)}
 	decode := func(r *dataReader) error {
 		_, err := r.byte()
@@ -94,7 +97,7 @@ func (c client) ReadMultiFileRecords(requests []X14xReadRecordRequest, tout time
 			if err != nil {
 				return err
 			}
-			resp := X14xReadFileRecordResult{req.File, req.Record, wds}
+			resp := X14xReadFileRecordResult{req.File, req.Record, wds, nil}
 			ret.Records = append(ret.Records, resp)
 		}
 
@@ -107,8 +110,36 @@ func (c client) ReadMultiFileRecords(requests []X14xReadRecordRequest, tout time
 	return ret, nil
 }
 
+func (c *client) ReadMultiFileRecordsTolerant(requests []X14xReadRecordRequest, tout time.Duration) (*X14xReadMultiFileRecord, error) {
+	for _, r := range requests {
+		if err := clientCheckFileRecord(r.File, r.Record, r.Length); err != nil {
+			// the requests are invalid, not the remote files
+			return nil, err
+		}
+	}
+	ret, err := c.ReadMultiFileRecords(requests, tout)
+	if err == nil || len(requests) == 0 {
+		return ret, err
+	}
+	ret = &X14xReadMultiFileRecord{Records: make([]X14xReadFileRecordResult, 0, len(requests))}
+	if len(requests) == 1 {
+		r := requests[0]
+		ret.Records = append(ret.Records, X14xReadFileRecordResult{r.File, r.Record, nil, err})
+		return ret, nil
+	}
+	// The remote unit fails the whole request if any one record fails, so read each record individually instead
+	for _, r := range requests {
+		rec, err := c.ReadFileRecords(r.File, r.Record, r.Length, tout)
+		if err != nil {
+			rec = &X14xReadFileRecordResult{r.File, r.Record, nil, err}
+		}
+		ret.Records = append(ret.Records, *rec)
+	}
+	return ret, nil
+}
+
 // X14xReadFileRecord server response to a Write Multiple Holding Registers request
-func (c client) ReadFileRecords(file int, record int, length int, tout time.Duration) (*X14xReadFileRecordResult, error) {
+func (c *client) ReadFileRecords(file int, record int, length int, tout time.Duration) (*X14xReadFileRecordResult, error) {
 	req := X14xReadRecordRequest{File: file, Record: record, Length: length}
 	parm := []X14xReadRecordRequest{req}
 	resp, err := c.ReadMultiFileRecords(parm, tout)
@@ -160,29 +191,31 @@ func (s X15xMultiWriteFileRecord) String() string {
 	return fmt.Sprintf("X15xMultiWriteFileRecord:\n%s", strings.Join(parts, "\n"))
 }
 
-func (c client) WriteMultiFileRecords(requests []X15xWriteFileRecordRequest, tout time.Duration) (*X15xMultiWriteFileRecord, error) {
+func (c *client) WriteMultiFileRecords(requests []X15xWriteFileRecordRequest, tout time.Duration) (*X15xMultiWriteFileRecord, error) {
 	sz := 1 + len(requests)*7
 	for _, r := range requests {
+		if err := clientCheckFileRecord(r.File, r.Record, len(r.Values)); err != nil {
+			return nil, err
+		}
+		for i, v := range r.Values {
+			if v < 0 || v > 0xffff {
+				return nil, fmt.Errorf("Value %v at index %v for file %v record %v is not a valid 16-bit value", v, i, r.File, r.Record)
+			}
+		}
 		sz += len(r.Values) * 2
 	}
-	if sz > 253 {
-		return nil, fmt.Errorf("Request will result in a payload of %v bytes which exceeds the limit of 253", sz)
+	// the request PDU is the function code and the payload, and the byte count is a single byte, even with a larger
+	// maximum PDU size
+	if max := minInt(c.trans.MaxPDUSize(), 0xff+1); sz+1 > max {
+		return nil, fmt.Errorf("Request will result in a PDU of %v bytes which exceeds the limit of %v", sz+1, max)
 	}
 
-	p := dataBuilder{}
-	p.byte(sz - 1)
-
 	// let's be optimistic and assume we "win" with the write, and we'll prepare the response as well.
 	ret := &X15xMultiWriteFileRecord{Results: make([]X15xWriteFileRecordResult, len(requests))}
 	for i, r := range requests {
-		p.byte(6) // from spec: The reference type: 1 byte (must be specified as 6)
-		p.word(r.File)
-		p.word(r.Record)
-		p.word(len(r.Values))
-		p.words(r.Values...)
 		ret.Results[i] = X15xWriteFileRecordResult{File: r.File, Record: r.Record, Length: len(r.Values)}
 	}
-	tx := pdu{0x15, p.payload()}
+	tx := encodeWriteFileRecords(requests)
 	decode := func(r *dataReader) error {
 		r.cursor = len(r.data)
 		if !bytes.Equal(tx.data, r.data) {
@@ -198,7 +231,7 @@ func (c client) WriteMultiFileRecords(requests []X15xWriteFileRecordRequest, tou
 }
 
 // X15xWriteFileRecord server response to a Write Multiple Holding Registers request
-func (c client) WriteFileRecords(file int, record int, values []int, tout time.Duration) (*X15xWriteFileRecordResult, error) {
+func (c *client) WriteFileRecords(file int, record int, values []int, tout time.Duration) (*X15xWriteFileRecordResult, error) {
 	rec := X15xWriteFileRecordRequest{file, record, values}
 	req := []X15xWriteFileRecordRequest{rec}
 
@@ -0,0 +1,42 @@
+package modbus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFileRecordArguments(t *testing.T) {
+	client, server := newTestServer(t)
+	server.RegisterFiles(2, func(server Server, atomic Atomic, file int, address int, values []int, current []int) ([]int, error) {
+		return values, nil
+	})
+	server.PadFileReads(true)
+
+	// the largest read fits in the default PDU, and one more record overflows it
+	if _, err := client.ReadFileRecords(1, 0, 124, time.Second); err != nil {
+		t.Fatalf("Expected the largest read to succeed: %v", err)
+	}
+	if _, err := client.ReadFileRecords(1, 0, 125, time.Second); err == nil {
+		t.Fatalf("Expected a read that overflows the PDU to be rejected")
+	}
+	if _, err := client.ReadFileRecords(1, 9999, 1, time.Second); err != nil {
+		t.Fatalf("Expected a read of the last record to succeed: %v", err)
+	}
+	if _, err := client.ReadFileRecords(1, 10000, 1, time.Second); err == nil {
+		t.Fatalf("Expected a read beyond the last record to be rejected")
+	}
+
+	// the largest write fits in the default PDU, and one more record overflows it
+	if _, err := client.WriteFileRecords(1, 0, make([]int, 122), time.Second); err != nil {
+		t.Fatalf("Expected the largest write to succeed: %v", err)
+	}
+	if _, err := client.WriteFileRecords(1, 0, make([]int, 123), time.Second); err == nil {
+		t.Fatalf("Expected a write that overflows the PDU to be rejected")
+	}
+	for _, v := range []int{-1, 0x10000} {
+		requests := []X15xWriteFileRecordRequest{{File: 1, Record: 0, Values: []int{0, v}}}
+		if _, err := client.WriteMultiFileRecords(requests, time.Second); err == nil {
+			t.Fatalf("Expected a write of the value %v to be rejected", v)
+		}
+	}
+}
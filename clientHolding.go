@@ -12,6 +12,37 @@ type X03xReadHolding struct {
 	Values  []int
 }
 
+// AsInt16 reinterprets each value as a signed 16-bit integer
+func (s X03xReadHolding) AsInt16() []int16 {
+	return wordsToInt16s(s.Values)
+}
+
+// AsInt32s combines each pair of values in to a signed 32-bit integer using the word order
+func (s X03xReadHolding) AsInt32s(order WordOrder) ([]int32, error) {
+	return wordsToInt32s(s.Values, order)
+}
+
+// AsUint32s combines each pair of values in to an unsigned 32-bit integer using the word order
+func (s X03xReadHolding) AsUint32s(order WordOrder) ([]uint32, error) {
+	return wordsToUint32s(s.Values, order)
+}
+
+// AsInt64s combines each group of 4 values in to a signed 64-bit integer using the word order
+func (s X03xReadHolding) AsInt64s(order WordOrder) ([]int64, error) {
+	return wordsToInt64s(s.Values, order)
+}
+
+// AsString unpacks 2 characters from each value using the byte order. Trailing null characters are removed.
+func (s X03xReadHolding) AsString(order ByteOrder) string {
+	return wordsToString(s.Values, order)
+}
+
+// AsBCD unpacks each value as 4 binary-coded-decimal digits (0x1234 is 1234). An error is returned if any digit is
+// not 0 to 9.
+func (s X03xReadHolding) AsBCD() ([]int, error) {
+	return wordsToBCD(s.Values)
+}
+
 func (s X03xReadHolding) String() string {
 	cnt := len(s.Values)
 	txt := make([]string, cnt)
@@ -21,12 +52,36 @@ func (s X03xReadHolding) String() string {
 	return fmt.Sprintf("X03xReadHolding %05d -> %05d (count %v)\n", s.Address, s.Address+cnt-1, cnt) + strings.Join(txt, "")
 }
 
-func (c client) ReadHoldings(from int, count int, tout time.Duration) (*X03xReadHolding, error) {
-	p := dataBuilder{}
-	p.word(from)
-	p.word(count)
+func (c *client) ReadHoldings(from int, count int, tout time.Duration) (*X03xReadHolding, error) {
+	ret := &X03xReadHolding{Address: from}
+	err := chunked(from, count, c.getLimits().ReadRegisters, func(from int, count int) error {
+		res, err := c.readHoldings(from, count, tout)
+		if err != nil {
+			return err
+		}
+		ret.Values = append(ret.Values, res.Values...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (c *client) ReadHolding(address int, tout time.Duration) (int, error) {
+	res, err := c.ReadHoldings(address, 1, tout)
+	if err != nil {
+		return 0, err
+	}
+	if len(res.Values) != 1 {
+		return 0, fmt.Errorf("Expected 1 holding register from %05d, but got %v", address, len(res.Values))
+	}
+	return res.Values[0], nil
+}
+
+func (c *client) readHoldings(from int, count int, tout time.Duration) (*X03xReadHolding, error) {
 	ret := &X03xReadHolding{}
-	tx := pdu{0x03, p.payload()}
+	tx := encodeAddressCount(0x03, from, count)
 	decode := func(r *dataReader) error {
 		l, err := r.byte()
 		if err != nil {
@@ -50,6 +105,38 @@ func (c client) ReadHoldings(from int, count int, tout time.Duration) (*X03xRead
 	return ret, nil
 }
 
+// AddressRange identifies a block of count sequential addresses starting at Address
+type AddressRange struct {
+	Address int
+	Count   int
+}
+
+func (r AddressRange) String() string {
+	return fmt.Sprintf("%05d -> %05d (count %v)", r.Address, r.Address+r.Count-1, r.Count)
+}
+
+func (c *client) ReadHoldingsMap(ranges []AddressRange, tout time.Duration) (map[int]int, error) {
+	ret := make(map[int]int)
+	for _, r := range ranges {
+		res, err := c.ReadHoldings(r.Address, r.Count, tout)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range res.Values {
+			ret[res.Address+i] = v
+		}
+	}
+	return ret, nil
+}
+
+func (c *client) ReadHoldingFloat32s(from int, count int, order WordOrder, tout time.Duration) ([]float32, error) {
+	res, err := c.ReadHoldings(from, count*2, tout)
+	if err != nil {
+		return nil, err
+	}
+	return wordsToFloat32s(res.Values, order)
+}
+
 // X06xWriteSingleHolding server response to a Read Multiple Holding Registers request
 type X06xWriteSingleHolding struct {
 	Address int
@@ -60,12 +147,9 @@ func (s X06xWriteSingleHolding) String() string {
 	return fmt.Sprintf("X06xWriteSingleHolding 0x%04x:   0x%04x  % 6d", s.Address, s.Value, s.Value)
 }
 
-func (c client) WriteSingleHolding(address int, value int, tout time.Duration) (*X06xWriteSingleHolding, error) {
-	p := dataBuilder{}
-	p.word(address)
-	p.word(value)
+func (c *client) WriteSingleHolding(address int, value int, tout time.Duration) (*X06xWriteSingleHolding, error) {
 	ret := &X06xWriteSingleHolding{}
-	tx := pdu{0x06, p.payload()}
+	tx := encodeAddressCount(0x06, address, value)
 	decode := func(r *dataReader) error {
 		got, err := r.word()
 		if err != nil {
@@ -92,6 +176,22 @@ func (c client) WriteSingleHolding(address int, value int, tout time.Duration) (
 	return ret, nil
 }
 
+func (c *client) WriteSingleHoldingVerify(address int, value int, tout time.Duration) (*X06xWriteSingleHolding, error) {
+	deadline := time.Now().Add(tout)
+	ret, err := c.WriteSingleHolding(address, value, tout)
+	if err != nil {
+		return nil, err
+	}
+	got, err := c.ReadHolding(address, time.Until(deadline))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to verify Write Single Holding Register %v: %w", address, err)
+	}
+	if got != value {
+		return nil, fmt.Errorf("Holding Register %v has the value %v after %v was written to it", address, got, value)
+	}
+	return ret, nil
+}
+
 // X10xWriteMultipleHoldings server response to a Write Multiple Holding Registers request
 type X10xWriteMultipleHoldings struct {
 	Address int
@@ -102,15 +202,33 @@ func (s X10xWriteMultipleHoldings) String() string {
 	return fmt.Sprintf("X10xWriteMultipleHoldings 0x%04x: count %d", s.Address, s.Count)
 }
 
-func (c client) WriteMultipleHoldings(address int, values []int, tout time.Duration) (*X10xWriteMultipleHoldings, error) {
-	p := dataBuilder{}
-	p.word(address)
-	p.word(len(values))
-	p.byte(len(values) * 2)
-	p.words(values...)
-	tx := pdu{0x10, p.payload()}
+func (c *client) WriteMultipleHoldings(address int, values []int, tout time.Duration) (*X10xWriteMultipleHoldings, error) {
+	ret := &X10xWriteMultipleHoldings{Address: address}
+	err := chunked(address, len(values), c.getLimits().WriteRegisters, func(from int, count int) error {
+		res, err := c.writeMultipleHoldings(from, values[from-address:from-address+count], tout)
+		if err != nil {
+			return err
+		}
+		ret.Count += res.Count
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (c *client) writeMultipleHoldings(address int, values []int, tout time.Duration) (*X10xWriteMultipleHoldings, error) {
+	tx := encodeWriteMultipleHoldings(address, values)
 	ret := &X10xWriteMultipleHoldings{}
 	decode := func(r *dataReader) error {
+		if c.lenientWrites() {
+			// the response is not an exception, so the write succeeded, whatever the response contains
+			r.bytesRaw(len(r.data) - r.cursor)
+			ret.Address = address
+			ret.Count = len(values)
+			return nil
+		}
 		got, err := r.word()
 		if err != nil {
 			return err
@@ -136,6 +254,22 @@ func (c client) WriteMultipleHoldings(address int, values []int, tout time.Durat
 	return ret, nil
 }
 
+func (c *client) WriteHoldingFloat32s(from int, values []float32, order WordOrder, tout time.Duration) (*X10xWriteMultipleHoldings, error) {
+	return c.WriteMultipleHoldings(from, float32sToWords(values, order), tout)
+}
+
+func (c *client) WriteHoldingString(from int, s string, order ByteOrder, tout time.Duration) (*X10xWriteMultipleHoldings, error) {
+	return c.WriteMultipleHoldings(from, stringToWords(s, order), tout)
+}
+
+func (c *client) WriteHoldingBCD(from int, values []int, tout time.Duration) (*X10xWriteMultipleHoldings, error) {
+	words, err := bcdToWords(values)
+	if err != nil {
+		return nil, err
+	}
+	return c.WriteMultipleHoldings(from, words, tout)
+}
+
 // X17xWriteReadHoldings server response to a Write/Read Multiple Holding Registers request
 type X17xWriteReadHoldings struct {
 	Address int
@@ -151,15 +285,22 @@ func (s X17xWriteReadHoldings) String() string {
 	return fmt.Sprintf("X17xReadWriteHoldings %05d -> %05d (count %v)\n", s.Address, s.Address+cnt-1, cnt) + strings.Join(txt, "")
 }
 
-func (c client) WriteReadMultipleHoldings(read int, count int, write int, values []int, tout time.Duration) (*X17xWriteReadHoldings, error) {
-	p := dataBuilder{}
-	p.word(read)
-	p.word(count)
-	p.word(write)
-	p.word(len(values))
-	p.byte(len(values) * 2)
-	p.words(values...)
-	tx := pdu{0x17, p.payload()}
+func (c *client) WriteReadMultipleHoldings(read int, count int, write int, values []int, tout time.Duration) (*X17xWriteReadHoldings, error) {
+	if read < 0 || read > 0xffff || write < 0 || write > 0xffff {
+		return nil, fmt.Errorf("Illegal Read/Write Holding Registers addresses %v and %v, must be from 0 to 65535", read, write)
+	}
+	if count < 1 || count > 125 {
+		return nil, fmt.Errorf("Illegal Read/Write Holding Registers read count %v, must be from 1 to 125", count)
+	}
+	if len(values) < 1 || len(values) > 121 {
+		return nil, fmt.Errorf("Illegal Read/Write Holding Registers write count %v, must be from 1 to 121", len(values))
+	}
+	for i, v := range values {
+		if v < 0 || v > 0xffff {
+			return nil, fmt.Errorf("Illegal Read/Write Holding Registers value %v at %v, must be from 0 to 65535", v, write+i)
+		}
+	}
+	tx := encodeWriteReadMultipleHoldings(read, count, write, values)
 	ret := &X17xWriteReadHoldings{}
 	decode := func(r *dataReader) error {
 		l, err := r.byte()
@@ -198,12 +339,8 @@ func (s X16xMaskWriteHolding) String() string {
 	return fmt.Sprintf("X16xMaskWriteHolding 0x%04x:  AND 0x%04x  OR  0x%04x", s.Address, s.ANDMask, s.ORMask)
 }
 
-func (c client) MaskWriteHolding(address int, andmask int, ormask int, tout time.Duration) (*X16xMaskWriteHolding, error) {
-	p := dataBuilder{}
-	p.word(address)
-	p.word(andmask)
-	p.word(ormask)
-	tx := pdu{0x16, p.payload()}
+func (c *client) MaskWriteHolding(address int, andmask int, ormask int, tout time.Duration) (*X16xMaskWriteHolding, error) {
+	tx := encodeMaskWriteHolding(address, andmask, ormask)
 	ret := &X16xMaskWriteHolding{}
 	decode := func(r *dataReader) error {
 		if len(r.data) != 6 {
@@ -229,7 +366,7 @@ func (c client) MaskWriteHolding(address int, andmask int, ormask int, tout time
 		if err != nil {
 			return err
 		}
-		if amask != andmask {
+		if omask != ormask {
 			return fmt.Errorf("Expect Mask Holding Register response to be for the same OR mask %v, not %v", ormask, omask)
 		}
 
@@ -245,7 +382,7 @@ func (c client) MaskWriteHolding(address int, andmask int, ormask int, tout time
 	return ret, nil
 }
 
-// X18xReadFIFOQueue server response to a Read FIFO Queue request
+// X18xReadFIFOQueue server response to a Read FIFO Queue request. The Values are empty if the queue is empty.
 type X18xReadFIFOQueue struct {
 	Address int
 	Values  []int
@@ -253,6 +390,9 @@ type X18xReadFIFOQueue struct {
 
 func (s X18xReadFIFOQueue) String() string {
 	cnt := len(s.Values)
+	if cnt == 0 {
+		return fmt.Sprintf("X18xReadFIFOQueue %05d empty\n", s.Address)
+	}
 	txt := make([]string, cnt)
 	for i, v := range s.Values {
 		txt[i] = fmt.Sprintf("    0x%04x:   0x%04x  % 6d\n", s.Address+i, v, v)
@@ -260,10 +400,8 @@ func (s X18xReadFIFOQueue) String() string {
 	return fmt.Sprintf("X18xReadFIFOQueue %05d -> %05d (count %v)\n", s.Address, s.Address+cnt-1, cnt) + strings.Join(txt, "")
 }
 
-func (c client) ReadFIFOQueue(from int, tout time.Duration) (*X18xReadFIFOQueue, error) {
-	p := dataBuilder{}
-	p.word(from)
-	tx := pdu{0x18, p.payload()}
+func (c *client) ReadFIFOQueue(from int, tout time.Duration) (*X18xReadFIFOQueue, error) {
+	tx := encodeReadFIFOQueue(from)
 
 	ret := &X18xReadFIFOQueue{}
 	decode := func(r *dataReader) error {
@@ -282,12 +420,19 @@ func (c client) ReadFIFOQueue(from int, tout time.Duration) (*X18xReadFIFOQueue,
 		if count*2+2 != sz {
 			return fmt.Errorf("Expect Read FIFO Queue response to have corroborating internal count and length, %v*2 + 2 != %v", count, sz)
 		}
+		if count > 31 {
+			return fmt.Errorf("Expect Read FIFO Queue response to have at most 31 values, not %v", count)
+		}
+		ret.Address = from
+		if count == 0 {
+			// an empty queue
+			ret.Values = []int{}
+			return nil
+		}
 		v, err := r.words(count)
 		if err != nil {
 			return err
 		}
-
-		ret.Address = from
 		ret.Values = v
 		return nil
 	}
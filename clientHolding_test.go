@@ -0,0 +1,162 @@
+package modbus
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMaskWriteHoldingWrongORMask(t *testing.T) {
+	client, server := newTestServer(t)
+	// the server echoes the request, but with a different OR mask
+	server.RegisterFunctionHandler(0x16, 6, func(mb Modbus, request []byte) ([]byte, error) {
+		response := append([]byte{}, request...)
+		response[5] ^= 0x01
+		return response, nil
+	})
+	_, err := client.MaskWriteHolding(4, 0x00f2, 0x0025, time.Second)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("Expected a DecodeError for the wrong OR mask, not %v", err)
+	}
+}
+
+func TestMaskWriteHolding(t *testing.T) {
+	client, server := newTestServer(t)
+	server.RegisterHoldings(10, acceptHoldings)
+	if _, err := client.WriteSingleHolding(4, 0x0012, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.MaskWriteHolding(4, 0x00f2, 0x0025, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// the example from the specification: (0x12 AND 0xf2) OR (0x25 AND NOT 0xf2) = 0x17
+	got, err := client.ReadHolding(4, time.Second)
+	if err != nil || got != 0x17 {
+		t.Fatalf("Expected the masked value 0x17, not 0x%02x (%v)", got, err)
+	}
+}
+
+func TestReadFIFOQueueCounts(t *testing.T) {
+	client, server := newTestServer(t)
+	server.RegisterHoldings(40, acceptHoldings)
+	values := make([]int, 31)
+	for i := range values {
+		values[i] = 100 + i
+	}
+	if _, err := client.WriteMultipleHoldings(1, values, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	for _, count := range []int{0, 31} {
+		if _, err := client.WriteSingleHolding(0, count, time.Second); err != nil {
+			t.Fatal(err)
+		}
+		fifo, err := client.ReadFIFOQueue(0, time.Second)
+		if err != nil {
+			t.Fatalf("Expected a FIFO count of %v to succeed: %v", count, err)
+		}
+		if len(fifo.Values) != count {
+			t.Fatalf("Expected %v values, not %v", count, fifo.Values)
+		}
+		for i, v := range fifo.Values {
+			if v != values[i] {
+				t.Fatalf("Expected value %v to be %v, not %v", i, values[i], v)
+			}
+		}
+	}
+	for _, count := range []int{32, 0x8000} {
+		if _, err := client.WriteSingleHolding(0, count, time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.ReadFIFOQueue(0, time.Second); exceptionCode(err) != 3 {
+			t.Fatalf("Expected an Illegal Data Value exception for a FIFO count of %v, not %v", count, err)
+		}
+	}
+}
+
+func TestReadFIFOQueueTooLong(t *testing.T) {
+	client, server := newTestServer(t)
+	// the server reports a consistent response, but with 32 values
+	server.RegisterFunctionHandler(0x18, 2, func(mb Modbus, request []byte) ([]byte, error) {
+		response := []byte{0x00, 32*2 + 2, 0x00, 32}
+		return append(response, make([]byte, 32*2)...), nil
+	})
+	_, err := client.ReadFIFOQueue(0, time.Second)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("Expected a DecodeError for a FIFO count of 32, not %v", err)
+	}
+}
+
+func TestWriteReadMultipleHoldingsOverlap(t *testing.T) {
+	client, server := newTestServer(t)
+	server.RegisterHoldings(10, acceptHoldings)
+	if _, err := client.WriteMultipleHoldings(0, []int{1, 2, 3, 4, 5, 6}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// write 3 and 4, and read 2 to 5: the write happens before the read
+	got, err := client.WriteReadMultipleHoldings(2, 4, 3, []int{40, 50}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []int{3, 40, 50, 6}
+	if len(got.Values) != len(expect) {
+		t.Fatalf("Expected %v values, not %v", expect, got.Values)
+	}
+	for i, v := range expect {
+		if got.Values[i] != v {
+			t.Fatalf("Expected the read to reflect the write, %v, not %v", expect, got.Values)
+		}
+	}
+}
+
+func TestWriteReadMultipleHoldingsArguments(t *testing.T) {
+	client, _ := newTestServer(t)
+	tests := []struct {
+		count  int
+		values []int
+	}{
+		{0, []int{1}},
+		{126, []int{1}},
+		{1, []int{}},
+		{1, make([]int, 122)},
+		{1, []int{0x10000}},
+	}
+	for _, test := range tests {
+		if _, err := client.WriteReadMultipleHoldings(0, test.count, 0, test.values, time.Second); err == nil {
+			t.Fatalf("Expected a read count of %v and %v values to be rejected", test.count, len(test.values))
+		}
+	}
+}
+
+func TestHoldingBCD(t *testing.T) {
+	client, server := newTestServer(t)
+	server.RegisterHoldings(10, acceptHoldings)
+	values := []int{0, 1234, 9999}
+	if _, err := client.WriteHoldingBCD(0, values, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	read, err := client.ReadHoldings(0, 3, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := []int{0x0000, 0x1234, 0x9999}
+	got, err := read.AsBCD()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range values {
+		if read.Values[i] != words[i] || got[i] != values[i] {
+			t.Fatalf("Expected %v to be stored as %04x, not %04x, and read back as %v", values, words, read.Values, got)
+		}
+	}
+
+	if _, err := (X03xReadHolding{Values: []int{0x12a4}}).AsBCD(); err == nil {
+		t.Fatalf("Expected a digit above 9 to be rejected")
+	}
+	for _, v := range []int{-1, 10000} {
+		if _, err := client.WriteHoldingBCD(0, []int{v}, time.Second); err == nil {
+			t.Fatalf("Expected %v to be rejected as binary-coded-decimal", v)
+		}
+	}
+}
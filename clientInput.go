@@ -12,6 +12,32 @@ type X04xReadInputs struct {
 	Values  []int
 }
 
+// AsInt16 reinterprets each value as a signed 16-bit integer
+func (s X04xReadInputs) AsInt16() []int16 {
+	return wordsToInt16s(s.Values)
+}
+
+// AsInt32s combines each pair of values in to a signed 32-bit integer using the word order
+func (s X04xReadInputs) AsInt32s(order WordOrder) ([]int32, error) {
+	return wordsToInt32s(s.Values, order)
+}
+
+// AsUint32s combines each pair of values in to an unsigned 32-bit integer using the word order
+func (s X04xReadInputs) AsUint32s(order WordOrder) ([]uint32, error) {
+	return wordsToUint32s(s.Values, order)
+}
+
+// AsInt64s combines each group of 4 values in to a signed 64-bit integer using the word order
+func (s X04xReadInputs) AsInt64s(order WordOrder) ([]int64, error) {
+	return wordsToInt64s(s.Values, order)
+}
+
+// AsBCD unpacks each value as 4 binary-coded-decimal digits (0x1234 is 1234). An error is returned if any digit is
+// not 0 to 9.
+func (s X04xReadInputs) AsBCD() ([]int, error) {
+	return wordsToBCD(s.Values)
+}
+
 func (s X04xReadInputs) String() string {
 	cnt := len(s.Values)
 	txt := make([]string, cnt)
@@ -21,11 +47,35 @@ func (s X04xReadInputs) String() string {
 	return fmt.Sprintf("X04xReadInputs %05d -> %05d (count %v)\n", s.Address, s.Address+cnt-1, cnt) + strings.Join(txt, "")
 }
 
-func (c client) ReadInputs(from int, count int, tout time.Duration) (*X04xReadInputs, error) {
-	p := dataBuilder{}
-	p.word(from)
-	p.word(count)
-	tx := pdu{0x04, p.payload()}
+func (c *client) ReadInputs(from int, count int, tout time.Duration) (*X04xReadInputs, error) {
+	ret := &X04xReadInputs{Address: from}
+	err := chunked(from, count, c.getLimits().ReadRegisters, func(from int, count int) error {
+		res, err := c.readInputs(from, count, tout)
+		if err != nil {
+			return err
+		}
+		ret.Values = append(ret.Values, res.Values...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (c *client) ReadInput(address int, tout time.Duration) (int, error) {
+	res, err := c.ReadInputs(address, 1, tout)
+	if err != nil {
+		return 0, err
+	}
+	if len(res.Values) != 1 {
+		return 0, fmt.Errorf("Expected 1 input from %05d, but got %v", address, len(res.Values))
+	}
+	return res.Values[0], nil
+}
+
+func (c *client) readInputs(from int, count int, tout time.Duration) (*X04xReadInputs, error) {
+	tx := encodeAddressCount(0x04, from, count)
 	ret := &X04xReadInputs{}
 	decode := func(r *dataReader) error {
 		l, err := r.byte()
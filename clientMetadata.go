@@ -113,11 +113,7 @@ type devInfoAccumulator struct {
 }
 
 func getMoreDeviceID(c *client, fill *devInfoAccumulator, tout time.Duration) error {
-	p := dataBuilder{}
-	p.byte(0x0e) // MEI type 14.
-	p.byte(fill.code)
-	p.byte(fill.next)
-	tx := pdu{0x2b, p.payload()}
+	tx := encodeDeviceIdentification(fill.code, fill.next)
 
 	decode := func(r *dataReader) error {
 		if len(r.data) < 6 {
@@ -175,14 +171,24 @@ func getSection(c *client, sect int, fill *devInfoAccumulator, tout time.Duratio
 	case 3:
 		from = 0x80
 	}
-	fill.code = sect
+	return getRange(c, sect, from, fill, tout)
+}
+
+// getRange reads the objects for the code, from the object ID, until the remote unit reports that there are no more.
+// Each response has to advance the next object ID, so a remote unit that always has more cannot keep us looping.
+func getRange(c *client, code int, from int, fill *devInfoAccumulator, tout time.Duration) error {
+	fill.code = code
 	fill.next = from
 	fill.more = true
 	for fill.more {
+		prev := fill.next
 		err := getMoreDeviceID(c, fill, tout)
 		if err != nil {
 			return err
 		}
+		if fill.more && fill.next <= prev {
+			return fmt.Errorf("Expect DeviceIdentification response to advance the next object ID beyond 0x%02x, not 0x%02x", prev, fill.next)
+		}
 	}
 	return nil
 }
@@ -231,6 +237,47 @@ func (c *client) DeviceIdentification(tout time.Duration) (*X2BxDeviceIdentifica
 
 var identifications = []string{"Vendor Name", "Product Code", "Major Minor Version", "Vendor URL", "Product Name", "Model Name", "User Application Name"}
 
+// X2BxDeviceIdentificationRange server response to a Device Identification function request for the objects of a
+// conformity level (the Code), keyed by their object ID
+type X2BxDeviceIdentificationRange struct {
+	Code       int
+	Conformity int
+	Objects    map[int]string
+}
+
+func (s X2BxDeviceIdentificationRange) String() string {
+	oids := make([]int, 0, len(s.Objects))
+	for oid := range s.Objects {
+		oids = append(oids, oid)
+	}
+	sort.Ints(oids)
+	parts := make([]string, 0, len(oids)+1)
+	parts = append(parts, fmt.Sprintf("X2BxDeviceIdentificationRange code %v conformity 0x%02x", s.Code, s.Conformity))
+	for _, oid := range oids {
+		name := fmt.Sprintf("Extended 0x%02x", oid)
+		if oid < len(identifications) {
+			name = identifications[oid]
+		}
+		parts = append(parts, fmt.Sprintf("0x%02x %-22s %v", oid, name+":", s.Objects[oid]))
+	}
+	return strings.Join(parts, "\n      ")
+}
+
+func (c *client) DeviceIdentificationRange(code int, from int, tout time.Duration) (*X2BxDeviceIdentificationRange, error) {
+	if code < 1 || code > 4 {
+		return nil, fmt.Errorf("Illegal Read Device ID code %v, must be from 1 to 4", code)
+	}
+	if from < 0 || from > 0xff {
+		return nil, fmt.Errorf("Illegal Object ID %v, must be from 0x00 to 0xff", from)
+	}
+	fill := &devInfoAccumulator{objects: make(map[int]string)}
+	err := getRange(c, code, from, fill, tout)
+	if err != nil {
+		return nil, err
+	}
+	return &X2BxDeviceIdentificationRange{Code: code, Conformity: fill.conforms, Objects: fill.objects}, nil
+}
+
 // X2BxDeviceIdentificationObject server response to a Device Identification function request for a single Object
 type X2BxDeviceIdentificationObject struct {
 	ObjectID int
@@ -243,11 +290,7 @@ func (s X2BxDeviceIdentificationObject) String() string {
 }
 
 func (c *client) DeviceIdentificationObject(objectID int, tout time.Duration) (*X2BxDeviceIdentificationObject, error) {
-	p := dataBuilder{}
-	p.byte(0x0e)
-	p.byte(4)
-	p.byte(objectID)
-	tx := pdu{0x2b, p.payload()}
+	tx := encodeDeviceIdentification(4, objectID)
 
 	ret := &X2BxDeviceIdentificationObject{}
 	ret.ObjectID = objectID
@@ -295,6 +338,35 @@ func (c *client) DeviceIdentificationObject(objectID int, tout time.Duration) (*
 	return ret, nil
 }
 
+func (c *client) EncapsulatedInterface(meiType int, data []int, tout time.Duration) ([]int, error) {
+	if meiType < 0 || meiType > 0xff {
+		return nil, fmt.Errorf("Illegal MEI type %v, must be from 0x00 to 0xff", meiType)
+	}
+	// the function code and the MEI type are part of the PDU too
+	if max := c.trans.MaxPDUSize() - 2; len(data) > max {
+		return nil, fmt.Errorf("Illegal data size %v, must be at most %v bytes", len(data), max)
+	}
+	tx := encodeEncapsulatedInterface(meiType, data)
+
+	var ret []int
+	decode := func(r *dataReader) error {
+		mei, err := r.byte()
+		if err != nil {
+			return err
+		}
+		if mei != meiType {
+			return fmt.Errorf("Expect EncapsulatedInterface response to have MEI type 0x%02x not 0x%02x", meiType, mei)
+		}
+		ret, err = r.bytes(len(r.data) - r.cursor)
+		return err
+	}
+	err := <-c.query(tout, tx, decode)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
 // X0BxCommEventCounter server response to a Comm Event Counter function request
 type X0BxCommEventCounter struct {
 	Busy       bool
@@ -336,67 +408,150 @@ type X0CxCommEventLog struct {
 	Events       []int
 }
 
-func (s X0CxCommEventLog) String() string {
-	logs := make([]string, len(s.Events))
-	for i, e := range s.Events {
-		msg := make([]string, 0, 5)
-		msg = append(msg, fmt.Sprintf("      %08b", e))
-		if e&0x80 != 0 {
-			// Receive event
-			msg = append(msg, "<---RX")
-			if e&0x40 != 0 {
-				msg = append(msg, "BC")
-			}
-			if e&0x20 != 0 {
-				msg = append(msg, "LOM")
-			}
-			e &= 0x1f
-			if e != 0 {
-				msg = append(msg, ">>FAIL<<")
-				if e&0x10 != 0 {
-					msg = append(msg, "OR")
-				}
-				if e&0x02 != 0 {
-					msg = append(msg, "CE")
-				}
-			} else {
-				msg = append(msg, "OK")
-			}
-		} else if e&0x40 != 0 {
-			// Send event
-			msg = append(msg, "TX--->")
-			if e&0x20 != 0 {
-				msg = append(msg, "LOM")
-			}
-			e &= 0x1f
-			if e != 0 {
-				msg = append(msg, ">>FAIL<<")
-				if e&0x10 != 0 {
-					msg = append(msg, "TO")
-				}
-				if e&0x08 != 0 {
-					msg = append(msg, "NAK")
-				}
-				if e&0x04 != 0 {
-					msg = append(msg, "BSY")
-				}
-				if e&0x02 != 0 {
-					msg = append(msg, "AB")
-				}
-				if e&0x01 != 0 {
-					msg = append(msg, "RE")
-				}
-			} else {
-				msg = append(msg, "OK")
-			}
-		} else if e == 0x40 {
-			msg = append(msg, ">>LOM<<")
-		} else if e == 0x00 {
-			msg = append(msg, ">>START<<")
+// CommEventKind identifies the type of an event in a remote unit's communication event log
+type CommEventKind int
+
+const (
+	// CommEventReceive is a request received by the remote unit
+	CommEventReceive CommEventKind = iota
+	// CommEventSend is a response sent by the remote unit
+	CommEventSend
+	// CommEventListenOnly is the remote unit entering listen only mode
+	CommEventListenOnly
+	// CommEventRestart is a communication restart of the remote unit
+	CommEventRestart
+	// CommEventUnknown is an event that is not in the Modbus specification
+	CommEventUnknown
+)
+
+func (k CommEventKind) String() string {
+	switch k {
+	case CommEventReceive:
+		return "Receive"
+	case CommEventSend:
+		return "Send"
+	case CommEventListenOnly:
+		return "ListenOnly"
+	case CommEventRestart:
+		return "Restart"
+	}
+	return "Unknown"
+}
+
+// CommEvent is a single entry from a remote unit's communication event log, decoded from the event byte
+type CommEvent struct {
+	// Event is the raw event byte as reported by the remote unit
+	Event int
+	// MessageCount is the remote unit's message count at the time the event was retrieved
+	MessageCount int
+	// Kind is the type of event, the fields below are only set for receive and send events
+	Kind CommEventKind
+	// ListenOnly is set if the remote unit was in listen only mode when it received or sent
+	ListenOnly bool
+	// Broadcast is set for a received broadcast
+	Broadcast bool
+	// CommError and Overrun are set for a request that was received with a communication error (CRC, parity, etc.),
+	// or that was too long
+	CommError bool
+	Overrun   bool
+	// ReadException, AbortException, BusyException, and NAKException are set for a response that was an exception
+	// (codes 1 to 3, 4, 5 and 6, and 7), and WriteTimeout for a response that timed out
+	ReadException  bool
+	AbortException bool
+	BusyException  bool
+	NAKException   bool
+	WriteTimeout   bool
+}
+
+// decodeCommEvent decodes an event byte from a remote unit's communication event log
+func decodeCommEvent(e int, messageCount int) CommEvent {
+	ev := CommEvent{Event: e, MessageCount: messageCount}
+	switch {
+	case e&busIncoming != 0:
+		ev.Kind = CommEventReceive
+		ev.Broadcast = e&busBroadcast != 0
+		ev.ListenOnly = e&busListenOnly != 0
+		ev.CommError = e&busCommError != 0
+		ev.Overrun = e&busCharOverrun != 0
+	case e&busOutgoing != 0:
+		ev.Kind = CommEventSend
+		ev.ListenOnly = e&busListenOnly != 0
+		ev.ReadException = e&busReadException != 0
+		ev.AbortException = e&busAbortException != 0
+		ev.BusyException = e&busBusyException != 0
+		ev.NAKException = e&busNAKException != 0
+		ev.WriteTimeout = e&busWriteTimeout != 0
+	case e == busEnteredListenOnly:
+		ev.Kind = CommEventListenOnly
+	case e == busCommRestart:
+		ev.Kind = CommEventRestart
+	default:
+		ev.Kind = CommEventUnknown
+	}
+	return ev
+}
+
+// Failed returns true if the event is a receive that failed, or a send of an exception or that timed out
+func (e CommEvent) Failed() bool {
+	return (e.Kind == CommEventReceive || e.Kind == CommEventSend) && e.Event&0x1f != 0
+}
+
+func (e CommEvent) String() string {
+	msg := make([]string, 0, 5)
+	msg = append(msg, fmt.Sprintf("%08b", e.Event))
+	flag := func(set bool, name string) {
+		if set {
+			msg = append(msg, name)
+		}
+	}
+	switch e.Kind {
+	case CommEventReceive:
+		msg = append(msg, "<---RX")
+		flag(e.Broadcast, "BC")
+		flag(e.ListenOnly, "LOM")
+		if e.Failed() {
+			msg = append(msg, ">>FAIL<<")
+			flag(e.Overrun, "OR")
+			flag(e.CommError, "CE")
 		} else {
-			msg = append(msg, "**UNKNOWN**")
+			msg = append(msg, "OK")
+		}
+	case CommEventSend:
+		msg = append(msg, "TX--->")
+		flag(e.ListenOnly, "LOM")
+		if e.Failed() {
+			msg = append(msg, ">>FAIL<<")
+			flag(e.WriteTimeout, "TO")
+			flag(e.NAKException, "NAK")
+			flag(e.BusyException, "BSY")
+			flag(e.AbortException, "AB")
+			flag(e.ReadException, "RE")
+		} else {
+			msg = append(msg, "OK")
 		}
-		logs[i] = strings.Join(msg, " ")
+	case CommEventListenOnly:
+		msg = append(msg, ">>LOM<<")
+	case CommEventRestart:
+		msg = append(msg, ">>START<<")
+	default:
+		msg = append(msg, "**UNKNOWN**")
+	}
+	return strings.Join(msg, " ")
+}
+
+// DecodeEvents returns the events in the log decoded, most recent first
+func (s X0CxCommEventLog) DecodeEvents() []CommEvent {
+	ret := make([]CommEvent, len(s.Events))
+	for i, e := range s.Events {
+		ret[i] = decodeCommEvent(e, s.MessageCount)
+	}
+	return ret
+}
+
+func (s X0CxCommEventLog) String() string {
+	logs := make([]string, len(s.Events))
+	for i, e := range s.DecodeEvents() {
+		logs[i] = "      " + e.String()
 	}
 	return fmt.Sprintf("X0CxCommEventLog busy %v -> events %v -> messages %v\n%v", s.Busy, s.EventCount, s.MessageCount, strings.Join(logs, "\n"))
 }
@@ -453,12 +608,16 @@ func (s X08xDiagnosticEcho) String() string {
 }
 
 func (c *client) DiagnosticEcho(data []int, tout time.Duration) (*X08xDiagnosticEcho, error) {
-	sz := len(data)*2 + 2
-	tx := pdu{function: 0x08, data: make([]uint8, sz)}
-	setWord(tx.data, 0, 0) // 0x00 subfunction
+	// the sub-function and the data have to fit in the PDU data (252 bytes by default)
+	if max := (c.trans.MaxPDUSize() - 3) / 2; len(data) > max {
+		return nil, fmt.Errorf("Illegal DiagnosticEcho data of %v words, at most %v words can be echoed", len(data), max)
+	}
 	for i, v := range data {
-		iSetWord(tx.data, 2+i*2, v)
+		if v < 0 || v > 0xffff {
+			return nil, fmt.Errorf("Illegal DiagnosticEcho value %v at index %v, must be from 0 to 65535", v, i)
+		}
 	}
+	tx := encodeDiagnostic(0x00, data...)
 	ret := &X08xDiagnosticEcho{}
 	decode := func(r *dataReader) error {
 		cnt := len(r.data) / 2
@@ -488,6 +647,27 @@ func (c *client) DiagnosticEcho(data []int, tout time.Duration) (*X08xDiagnostic
 	return ret, nil
 }
 
+func (c *client) PingDevice(tout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	_, err := c.DiagnosticEcho([]int{0x4d42}, tout)
+	if err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+func (c *client) Ping(tout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	rtt, err := c.PingDevice(tout)
+	if err == nil {
+		return rtt, nil
+	}
+	if !deviceResponded(err) {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
 // X08xDiagnosticRegister server response to a Diagnostic Return Query data function request
 type X08xDiagnosticRegister struct {
 	Register int
@@ -522,10 +702,7 @@ func (c *client) DiagnosticRegister(tout time.Duration) (*X08xDiagnosticRegister
 }
 
 func (c *client) DiagnosticClear(tout time.Duration) error {
-	p := dataBuilder{}
-	p.word(0x0a)
-	p.word(0x00)
-	tx := pdu{0x08, p.payload()}
+	tx := encodeDiagnostic(0x0a, 0x00)
 	decode := func(r *dataReader) error {
 		if len(r.data) != 4 {
 			return fmt.Errorf("Expect DiagnosticClear response to be exactly 4 bytes, not %v", len(r.data))
@@ -547,6 +724,42 @@ func (c *client) DiagnosticClear(tout time.Duration) error {
 	return nil
 }
 
+func (c *client) ForceListenOnly(tout time.Duration) error {
+	p := dataBuilder{}
+	p.word(0x04)
+	p.word(0x00)
+	tx := pdu{0x08, p.payload()}
+	return <-c.query(tout, tx, nil)
+}
+
+// restartCommData is the data of a Restart Communications request, 0xFF00 to clear the event log
+func restartCommData(clearLog bool) int {
+	if clearLog {
+		return 0xff00
+	}
+	return 0x0000
+}
+
+func (c *client) RestartComm(clearLog bool, tout time.Duration) error {
+	code := restartCommData(clearLog)
+	tx := encodeDiagnostic(0x01, code)
+	decode := func(r *dataReader) error {
+		if len(r.data) != 4 {
+			return fmt.Errorf("Expect RestartComm response to be exactly 4 bytes, not %v", len(r.data))
+		}
+		sf, _ := r.word()
+		ec, _ := r.word()
+		if sf != 0x01 {
+			return fmt.Errorf("Expect RestartComm response to be for the subfunction 0x0001, not 0x%04x", sf)
+		}
+		if ec != code {
+			return fmt.Errorf("Expect RestartComm response to echo 0x%04x but got 0x%04x", code, ec)
+		}
+		return nil
+	}
+	return <-c.query(tout, tx, decode)
+}
+
 // Diagnostic is a type used to identify counters in the modbus diagnostics in client.DiagnosticCount(...)
 type Diagnostic uint16
 
@@ -583,10 +796,8 @@ func (s X08xDiagnosticCount) String() string {
 }
 
 func (c *client) DiagnosticCount(counter Diagnostic, tout time.Duration) (*X08xDiagnosticCount, error) {
-	p := dataBuilder{}
-	p.word(int(counter)) // first word, the counter to get
-	p.word(0)            // second word, the "data field" is set to zero. The response data field will be the value.
-	tx := pdu{0x08, p.payload()}
+	// the "data field" is set to zero. The response data field will be the value.
+	tx := encodeDiagnostic(int(counter), 0)
 
 	ret := &X08xDiagnosticCount{}
 	decode := func(r *dataReader) error {
@@ -610,6 +821,19 @@ func (c *client) DiagnosticCount(counter Diagnostic, tout time.Duration) (*X08xD
 	return ret, nil
 }
 
+func (c *client) AllDiagnosticCounts(tout time.Duration) (map[Diagnostic]int, error) {
+	deadline := time.Now().Add(tout)
+	ret := make(map[Diagnostic]int)
+	for counter := BusMessages; counter <= BusCharacterOverruns; counter++ {
+		got, err := c.DiagnosticCount(counter, time.Until(deadline))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to get diagnostic counter %v: %w", counter, err)
+		}
+		ret[counter] = got.Count
+	}
+	return ret, nil
+}
+
 // X08xDiagnosticOverrunClear server response to a Diagnostic Overrun Clear data function request
 type X08xDiagnosticOverrunClear struct {
 	Echo int
@@ -647,14 +871,13 @@ func (c *client) DiagnosticOverrunClear(echo int, tout time.Duration) (*X08xDiag
 	return ret, nil
 }
 
-/*
-// X00xDebugRaw server response to a Diagnostic Overrun Clear data function request
+// X00xDebugRaw server response to an arbitrary function request sent with DebugRaw
 type X00xDebugRaw struct {
-	function uint8
-	data     []uint8
+	Function int
+	Data     []int
 }
 
-func toHex(src []uint8) string {
+func toHex(src []int) string {
 	out := make([]string, len(src))
 	for i, val := range src {
 		out[i] = fmt.Sprintf("%02x", val)
@@ -663,7 +886,7 @@ func toHex(src []uint8) string {
 }
 
 func (s X00xDebugRaw) String() string {
-	src := s.data[:]
+	src := s.Data[:]
 	out := make([]string, 0)
 	offset := 0
 	for len(src) > 16 {
@@ -673,16 +896,22 @@ func (s X00xDebugRaw) String() string {
 		offset += 16
 	}
 	out = append(out, fmt.Sprintf("   0x%02x -: %v", offset, toHex(src)))
-	return fmt.Sprintf("X00xDebugRaw function 0x%02x Response length %v\n%v", s.function, len(s.data), strings.Join(out, "\n"))
+	return fmt.Sprintf("X00xDebugRaw function 0x%02x Response length %v\n%v", s.Function, len(s.Data), strings.Join(out, "\n"))
 }
 
-func (c *client) DebugRaw(function uint8, payload []uint8, tout time.Duration) (*X00xDebugRaw, error) {
-	tx := pdu{function: function, data: payload}
-	ret := &X00xDebugRaw{}
-	decode := func(rx pdu) error {
-		ret.data = make([]uint8, len(rx.data))
-		copy(ret.data, rx.data)
-		return nil
+func (c *client) DebugRaw(function int, payload []int, tout time.Duration) (*X00xDebugRaw, error) {
+	if function < 1 || function > 127 {
+		return nil, fmt.Errorf("Illegal function 0x%02x, must be from 0x01 to 0x7f", function)
+	}
+	if max := c.trans.MaxPDUSize() - 1; len(payload) > max {
+		return nil, fmt.Errorf("Illegal payload size %v, must be at most %v bytes", len(payload), max)
+	}
+	tx := pdu{byte(function), intsToBytes(payload)}
+	ret := &X00xDebugRaw{Function: function}
+	decode := func(r *dataReader) error {
+		data, err := r.bytes(len(r.data))
+		ret.Data = data
+		return err
 	}
 	err := <-c.query(tout, tx, decode)
 	if err != nil {
@@ -690,4 +919,3 @@ func (c *client) DebugRaw(function uint8, payload []uint8, tout time.Duration) (
 	}
 	return ret, nil
 }
-*/
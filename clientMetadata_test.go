@@ -0,0 +1,81 @@
+package modbus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPingGateway(t *testing.T) {
+	clientSide, serverSide := NewLoopback()
+	defer clientSide.Close()
+	server, _ := NewServer([]byte{1}, []string{"a", "b", "c"})
+	serverSide.SetServer(1, server)
+	client := clientSide.GetClient(1)
+
+	if _, err := client.Ping(time.Second); err != nil {
+		t.Fatalf("Expected the ping to succeed: %v", err)
+	}
+	server.InjectException(0x08, 0x01, 1)
+	if _, err := client.Ping(time.Second); err != nil {
+		t.Fatalf("Expected an exception to count as alive: %v", err)
+	}
+	server.InjectException(0x08, 0x0A, 1)
+	if _, err := client.Ping(time.Second); exceptionCode(err) != 0x0A {
+		t.Fatalf("Expected the gateway exception to be an error, not %v", err)
+	}
+}
+
+func TestRunIndicator(t *testing.T) {
+	client, server := newTestServer(t)
+	for _, running := range []bool{true, false, true} {
+		server.SetRunIndicator(running)
+		id, err := client.ServerID(time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id.RunIndicator != running {
+			t.Fatalf("Expected the run indicator to be %v, not %v", running, id.RunIndicator)
+		}
+	}
+}
+
+func TestDeviceIdentificationEndlessStream(t *testing.T) {
+	for _, step := range []byte{0, 1} {
+		client, server := newTestServer(t)
+		// the server always reports that more objects follow, with the next object ID advanced by step
+		server.RegisterFunctionHandler(0x2b, 3, func(mb Modbus, request []byte) ([]byte, error) {
+			oid := request[2]
+			return []byte{0x0e, request[1], 0x01, 0xff, oid + step, 1, oid, 1, 'x'}, nil
+		})
+		done := make(chan error, 1)
+		go func() {
+			_, err := client.DeviceIdentification(time.Second)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Fatalf("Expected an error for a stream that never ends with step %v", step)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected DeviceIdentification to give up on a stream that never ends with step %v", step)
+		}
+	}
+}
+
+func TestExceptionStatus(t *testing.T) {
+	client, server := newTestServer(t)
+	if err := server.SetExceptionStatus(0x81); err != nil {
+		t.Fatal(err)
+	}
+	got, err := client.ReadExceptionStatus(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ExceptionStatus != 0x81 {
+		t.Fatalf("Expected the exception status 0x81, not %v", got)
+	}
+	if err := server.SetExceptionStatus(0x100); err == nil {
+		t.Fatalf("Expected an exception status of 0x100 to be rejected")
+	}
+}
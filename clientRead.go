@@ -0,0 +1,109 @@
+package modbus
+
+import (
+	"fmt"
+	"time"
+)
+
+// ReadResult is the common form of the responses to reading coils, discretes, input registers, and holding registers,
+// for code that handles any kind of register. See Client.Read
+type ReadResult interface {
+	fmt.Stringer
+	// Kind is the type of the values that were read
+	Kind() RegisterKind
+	// From is the address of the first value
+	From() int
+	// Ints returns the values that were read, with bits as 0 or 1
+	Ints() []int
+}
+
+// Kind returns KindCoil
+func (s X01xReadCoils) Kind() RegisterKind {
+	return KindCoil
+}
+
+// From returns the address of the first coil
+func (s X01xReadCoils) From() int {
+	return s.Address
+}
+
+// Ints returns the coils as 0 or 1
+func (s X01xReadCoils) Ints() []int {
+	return boolsToInts(s.Coils)
+}
+
+// Kind returns KindDiscrete
+func (s X02xReadDiscretes) Kind() RegisterKind {
+	return KindDiscrete
+}
+
+// From returns the address of the first discrete
+func (s X02xReadDiscretes) From() int {
+	return s.Address
+}
+
+// Ints returns the discretes as 0 or 1
+func (s X02xReadDiscretes) Ints() []int {
+	return boolsToInts(s.Discretes)
+}
+
+// Kind returns KindHolding
+func (s X03xReadHolding) Kind() RegisterKind {
+	return KindHolding
+}
+
+// From returns the address of the first holding register
+func (s X03xReadHolding) From() int {
+	return s.Address
+}
+
+// Ints returns the holding register values
+func (s X03xReadHolding) Ints() []int {
+	return s.Values
+}
+
+// Kind returns KindInput
+func (s X04xReadInputs) Kind() RegisterKind {
+	return KindInput
+}
+
+// From returns the address of the first input register
+func (s X04xReadInputs) From() int {
+	return s.Address
+}
+
+// Ints returns the input register values
+func (s X04xReadInputs) Ints() []int {
+	return s.Values
+}
+
+func (c *client) Read(kind RegisterKind, from int, count int, tout time.Duration) (ReadResult, error) {
+	var ret ReadResult
+	var err error
+	// the results are assigned only on success, so that a failed read returns a nil ReadResult, not a nil pointer
+	switch kind {
+	case KindDiscrete:
+		var got *X02xReadDiscretes
+		if got, err = c.ReadDiscretes(from, count, tout); err == nil {
+			ret = got
+		}
+	case KindCoil:
+		var got *X01xReadCoils
+		if got, err = c.ReadCoils(from, count, tout); err == nil {
+			ret = got
+		}
+	case KindInput:
+		var got *X04xReadInputs
+		if got, err = c.ReadInputs(from, count, tout); err == nil {
+			ret = got
+		}
+	case KindHolding:
+		var got *X03xReadHolding
+		if got, err = c.ReadHoldings(from, count, tout); err == nil {
+			ret = got
+		}
+	default:
+		err = fmt.Errorf("Unable to read %v values, only discretes, coils, inputs, and holding registers can be read", kind)
+	}
+	return ret, err
+}
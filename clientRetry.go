@@ -0,0 +1,523 @@
+package modbus
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+/*
+RetryClient is a Client that repeats requests that fail for reasons that may be transient: a timeout (e.g. a frame
+was lost to a CRC error), a failed connection, or a remote unit that is busy (exception code 6) or that did not respond to
+a gateway (exception code 0x0B). Other failures, like an illegal address or value, are returned immediately since
+repeating the request would fail the same way.
+
+Each attempt is given the full timeout. Repeating a write is not always safe (the first attempt may have succeeded
+even though the response was lost), so writes are only repeated if the RetryClient was created with WithWriteRetry.
+*/
+type RetryClient struct {
+	client   Client
+	attempts int
+	backoff  time.Duration
+	writes   bool
+}
+
+// WithRetry wraps the client so that read requests that fail with a transient error are attempted up to attempts times
+// in total. The first retry waits for backoff, and each following retry waits twice as long as the previous one.
+func WithRetry(c Client, attempts int, backoff time.Duration) Client {
+	return &RetryClient{c, attempts, backoff, false}
+}
+
+// WithWriteRetry is like WithRetry, but write requests are retried too.
+func WithWriteRetry(c Client, attempts int, backoff time.Duration) Client {
+	return &RetryClient{c, attempts, backoff, true}
+}
+
+// retryable identifies the errors that may succeed if the request is repeated
+func retryable(err error) bool {
+	var mbErr *Error
+	if errors.As(err, &mbErr) {
+		return mbErr.Code() == 6 || mbErr.Code() == 0x0B
+	}
+	var netErr net.Error
+	return errors.Is(err, ErrTimeout) || errors.As(err, &netErr)
+}
+
+func (r *RetryClient) retry(write bool, op func() error) error {
+	attempts := r.attempts
+	if write && !r.writes {
+		attempts = 1
+	}
+	start := time.Now()
+	wait := r.backoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || !retryable(err) {
+			return err
+		}
+		if attempt >= attempts {
+			if attempt == 1 {
+				return err
+			}
+			return fmt.Errorf("Failed after %v attempts in %v: %w", attempt, time.Since(start), err)
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+func (r *RetryClient) UnitID() int {
+	return r.client.UnitID()
+}
+
+func (r *RetryClient) SetLimits(limits Limits) {
+	r.client.SetLimits(limits)
+}
+
+func (r *RetryClient) SetAcknowledgePolling(interval time.Duration) {
+	r.client.SetAcknowledgePolling(interval)
+}
+
+func (r *RetryClient) SetDefaultTimeout(tout time.Duration) {
+	r.client.SetDefaultTimeout(tout)
+}
+
+func (r *RetryClient) SetLenientWriteValidation(lenient bool) {
+	r.client.SetLenientWriteValidation(lenient)
+}
+
+func (r *RetryClient) Read(kind RegisterKind, from int, count int, tout time.Duration) (ret ReadResult, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.Read(kind, from, count, tout)
+		return err
+	})
+	return
+}
+
+// Batch returns a Batch whose requests are repeated like the other requests of the RetryClient
+func (r *RetryClient) Batch(tout time.Duration) Batch {
+	return newBatch(r, tout)
+}
+
+func (r *RetryClient) ReadDiscretesDefault(from int, count int) (ret *X02xReadDiscretes, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ReadDiscretesDefault(from, count)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ReadCoilsDefault(from int, count int) (ret *X01xReadCoils, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ReadCoilsDefault(from, count)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) WriteSingleCoilDefault(address int, value bool) (ret *X05xWriteSingleCoil, err error) {
+	err = r.retry(true, func() error {
+		ret, err = r.client.WriteSingleCoilDefault(address, value)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) WriteMultipleCoilsDefault(address int, values []bool) (ret *X0FxWriteMultipleCoils, err error) {
+	err = r.retry(true, func() error {
+		ret, err = r.client.WriteMultipleCoilsDefault(address, values)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ReadInputsDefault(from int, count int) (ret *X04xReadInputs, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ReadInputsDefault(from, count)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ReadHoldingsDefault(from int, count int) (ret *X03xReadHolding, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ReadHoldingsDefault(from, count)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) WriteSingleHoldingDefault(address int, value int) (ret *X06xWriteSingleHolding, err error) {
+	err = r.retry(true, func() error {
+		ret, err = r.client.WriteSingleHoldingDefault(address, value)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) WriteMultipleHoldingsDefault(address int, values []int) (ret *X10xWriteMultipleHoldings, err error) {
+	err = r.retry(true, func() error {
+		ret, err = r.client.WriteMultipleHoldingsDefault(address, values)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ReadDiscretes(from int, count int, tout time.Duration) (ret *X02xReadDiscretes, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ReadDiscretes(from, count, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ReadDiscrete(address int, tout time.Duration) (ret bool, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ReadDiscrete(address, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ReadCoils(from int, count int, tout time.Duration) (ret *X01xReadCoils, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ReadCoils(from, count, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ReadCoil(address int, tout time.Duration) (ret bool, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ReadCoil(address, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) WriteSingleCoil(address int, value bool, tout time.Duration) (ret *X05xWriteSingleCoil, err error) {
+	err = r.retry(true, func() error {
+		ret, err = r.client.WriteSingleCoil(address, value, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) WriteMultipleCoils(address int, values []bool, tout time.Duration) (ret *X0FxWriteMultipleCoils, err error) {
+	err = r.retry(true, func() error {
+		ret, err = r.client.WriteMultipleCoils(address, values, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ReadInputs(from int, count int, tout time.Duration) (ret *X04xReadInputs, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ReadInputs(from, count, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ReadInput(address int, tout time.Duration) (ret int, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ReadInput(address, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ReadHoldings(from int, count int, tout time.Duration) (ret *X03xReadHolding, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ReadHoldings(from, count, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ReadHolding(address int, tout time.Duration) (ret int, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ReadHolding(address, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ReadHoldingsMap(ranges []AddressRange, tout time.Duration) (ret map[int]int, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ReadHoldingsMap(ranges, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ReadHoldingFloat32s(from int, count int, order WordOrder, tout time.Duration) (ret []float32, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ReadHoldingFloat32s(from, count, order, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) WriteSingleHolding(from int, value int, tout time.Duration) (ret *X06xWriteSingleHolding, err error) {
+	err = r.retry(true, func() error {
+		ret, err = r.client.WriteSingleHolding(from, value, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) WriteSingleHoldingVerify(address int, value int, tout time.Duration) (ret *X06xWriteSingleHolding, err error) {
+	err = r.retry(true, func() error {
+		ret, err = r.client.WriteSingleHoldingVerify(address, value, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) WriteMultipleHoldings(address int, values []int, tout time.Duration) (ret *X10xWriteMultipleHoldings, err error) {
+	err = r.retry(true, func() error {
+		ret, err = r.client.WriteMultipleHoldings(address, values, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) WriteHoldingFloat32s(from int, values []float32, order WordOrder, tout time.Duration) (ret *X10xWriteMultipleHoldings, err error) {
+	err = r.retry(true, func() error {
+		ret, err = r.client.WriteHoldingFloat32s(from, values, order, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) WriteHoldingString(from int, s string, order ByteOrder, tout time.Duration) (ret *X10xWriteMultipleHoldings, err error) {
+	err = r.retry(true, func() error {
+		ret, err = r.client.WriteHoldingString(from, s, order, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) WriteHoldingBCD(from int, values []int, tout time.Duration) (ret *X10xWriteMultipleHoldings, err error) {
+	err = r.retry(true, func() error {
+		ret, err = r.client.WriteHoldingBCD(from, values, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) WriteReadMultipleHoldings(read int, count int, write int, values []int, tout time.Duration) (ret *X17xWriteReadHoldings, err error) {
+	err = r.retry(true, func() error {
+		ret, err = r.client.WriteReadMultipleHoldings(read, count, write, values, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) MaskWriteHolding(address int, andmask int, ormask int, tout time.Duration) (ret *X16xMaskWriteHolding, err error) {
+	err = r.retry(true, func() error {
+		ret, err = r.client.MaskWriteHolding(address, andmask, ormask, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ReadFIFOQueue(from int, tout time.Duration) (ret *X18xReadFIFOQueue, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ReadFIFOQueue(from, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ReadMultiFileRecords(requests []X14xReadRecordRequest, tout time.Duration) (ret *X14xReadMultiFileRecord, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ReadMultiFileRecords(requests, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ReadMultiFileRecordsTolerant(requests []X14xReadRecordRequest, tout time.Duration) (ret *X14xReadMultiFileRecord, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ReadMultiFileRecordsTolerant(requests, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ReadFileRecords(file int, record int, length int, tout time.Duration) (ret *X14xReadFileRecordResult, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ReadFileRecords(file, record, length, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) WriteMultiFileRecords(requests []X15xWriteFileRecordRequest, tout time.Duration) (ret *X15xMultiWriteFileRecord, err error) {
+	err = r.retry(true, func() error {
+		ret, err = r.client.WriteMultiFileRecords(requests, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) WriteFileRecords(file int, record int, values []int, tout time.Duration) (ret *X15xWriteFileRecordResult, err error) {
+	err = r.retry(true, func() error {
+		ret, err = r.client.WriteFileRecords(file, record, values, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ReadExceptionStatus(tout time.Duration) (ret *X07xReadExceptionStatus, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ReadExceptionStatus(tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ServerID(tout time.Duration) (ret *X11xServerID, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.ServerID(tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) DiagnosticRegister(tout time.Duration) (ret *X08xDiagnosticRegister, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.DiagnosticRegister(tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) DiagnosticEcho(data []int, tout time.Duration) (ret *X08xDiagnosticEcho, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.DiagnosticEcho(data, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) PingDevice(tout time.Duration) (ret time.Duration, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.PingDevice(tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) Ping(tout time.Duration) (ret time.Duration, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.Ping(tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) DiagnosticClear(tout time.Duration) error {
+	return r.retry(true, func() error {
+		return r.client.DiagnosticClear(tout)
+	})
+}
+
+func (r *RetryClient) DiagnosticCount(counter Diagnostic, tout time.Duration) (ret *X08xDiagnosticCount, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.DiagnosticCount(counter, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) AllDiagnosticCounts(tout time.Duration) (ret map[Diagnostic]int, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.AllDiagnosticCounts(tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) DiagnosticOverrunClear(echo int, tout time.Duration) (ret *X08xDiagnosticOverrunClear, err error) {
+	err = r.retry(true, func() error {
+		ret, err = r.client.DiagnosticOverrunClear(echo, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) ForceListenOnly(tout time.Duration) error {
+	return r.retry(true, func() error {
+		return r.client.ForceListenOnly(tout)
+	})
+}
+
+func (r *RetryClient) RestartComm(clearLog bool, tout time.Duration) error {
+	return r.retry(true, func() error {
+		return r.client.RestartComm(clearLog, tout)
+	})
+}
+
+func (r *RetryClient) CommEventCounter(tout time.Duration) (ret *X0BxCommEventCounter, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.CommEventCounter(tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) CommEventLog(tout time.Duration) (ret *X0CxCommEventLog, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.CommEventLog(tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) StreamCommEventLog(interval time.Duration, tout time.Duration) (<-chan CommEvent, func()) {
+	return r.client.StreamCommEventLog(interval, tout)
+}
+
+func (r *RetryClient) DeviceIdentification(tout time.Duration) (ret *X2BxDeviceIdentification, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.DeviceIdentification(tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) DeviceIdentificationObject(objectID int, tout time.Duration) (ret *X2BxDeviceIdentificationObject, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.DeviceIdentificationObject(objectID, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) DeviceIdentificationRange(code int, from int, tout time.Duration) (ret *X2BxDeviceIdentificationRange, err error) {
+	err = r.retry(false, func() error {
+		ret, err = r.client.DeviceIdentificationRange(code, from, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) EncapsulatedInterface(meiType int, data []int, tout time.Duration) (ret []int, err error) {
+	err = r.retry(true, func() error {
+		ret, err = r.client.EncapsulatedInterface(meiType, data, tout)
+		return err
+	})
+	return
+}
+
+func (r *RetryClient) DebugRaw(function int, payload []int, tout time.Duration) (ret *X00xDebugRaw, err error) {
+	err = r.retry(true, func() error {
+		ret, err = r.client.DebugRaw(function, payload, tout)
+		return err
+	})
+	return
+}
@@ -0,0 +1,33 @@
+package modbus
+
+import (
+	"time"
+)
+
+// ScanUnits probes each unit from one unitID to another (inclusive) on the Modbus and returns the units that responded.
+// The probe is called with a client for each unit, and if probe is nil, ReadExceptionStatus is used. A unit is present
+// if the probe succeeds, or if the unit responds with an exception. Any other error (e.g. a timeout, or the Gateway
+// Path Unavailable and Gateway Target Device Failed to Respond exceptions from a gateway) means the unit is absent.
+// Unit 0 is the broadcast address on a serial bus, so it is never probed, and the range is limited to the valid unit
+// addresses 1 to 247. The units are probed one at a time.
+func ScanUnits(mb Modbus, from int, to int, probe func(Client) error, tout time.Duration) []int {
+	if from < 1 {
+		from = 1
+	}
+	if to > 247 {
+		to = 247
+	}
+	if probe == nil {
+		probe = func(c Client) error {
+			_, err := c.ReadExceptionStatus(tout)
+			return err
+		}
+	}
+	found := make([]int, 0)
+	for unit := from; unit <= to; unit++ {
+		if deviceResponded(probe(mb.GetClient(unit))) {
+			found = append(found, unit)
+		}
+	}
+	return found
+}
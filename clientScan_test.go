@@ -0,0 +1,39 @@
+package modbus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScanUnitsGateway(t *testing.T) {
+	clientSide, serverSide := NewLoopback()
+	defer clientSide.Close()
+	present, _ := NewServer([]byte{1}, []string{"a", "b", "c"})
+	failed, _ := NewServer([]byte{2}, []string{"a", "b", "c"})
+	illegal, _ := NewServer([]byte{3}, []string{"a", "b", "c"})
+	// a gateway reports that the target device did not respond
+	failed.InjectException(0x07, 0x0B, 100)
+	// the unit itself responds with an exception
+	illegal.InjectException(0x07, 0x01, 100)
+	serverSide.SetServer(1, present)
+	serverSide.SetServer(2, failed)
+	serverSide.SetServer(3, illegal)
+
+	found := ScanUnits(clientSide, 0, 3, nil, 100*time.Millisecond)
+	if len(found) != 2 || found[0] != 1 || found[1] != 3 {
+		t.Fatalf("Expected units 1 and 3 to be present, not %v", found)
+	}
+}
+
+func TestScanUnitsRange(t *testing.T) {
+	clientSide, serverSide := NewLoopback()
+	defer clientSide.Close()
+	server, _ := NewServer([]byte{1}, []string{"a", "b", "c"})
+	serverSide.SetServer(0xff, server)
+
+	// units past 247 are not probed (and do not panic)
+	found := ScanUnits(clientSide, 245, 256, nil, 100*time.Millisecond)
+	if len(found) != 3 || found[0] != 245 || found[2] != 247 {
+		t.Fatalf("Expected units 245 to 247 to be present, not %v", found)
+	}
+}
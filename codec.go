@@ -4,7 +4,80 @@ package modbus
 This file contains the routines for reading from and writing to PDU frames
 */
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+)
+
+/*
+WordOrder identifies how a value that is larger than 16 bits is stored in consecutive registers. Vendors differ. For
+a 32-bit value with the bytes ABCD (A is the most significant byte), the registers contain:
+
+	WordOrder        Register 1  Register 2  Word swap  Byte swap
+	BigEndian        AB          CD          no         no
+	LittleEndian     DC          BA          yes        yes
+	BigByteSwap      BA          DC          no         yes
+	LittleByteSwap   CD          AB          yes        no
+
+Larger values (e.g. 64-bit) follow the same pattern, with all the words reversed for a word swap.
+*/
+type WordOrder int
+
+const (
+	// BigEndian stores the most significant word first, and each word is big-endian (ABCD). This is the Modbus wire order.
+	BigEndian WordOrder = iota
+	// LittleByteSwap stores the least significant word first, but each word is still big-endian (CDAB). This is often
+	// called "word swapped".
+	LittleByteSwap
+	// LittleEndian stores the least significant word first, and each word is little-endian (DCBA)
+	LittleEndian
+	// BigByteSwap stores the most significant word first, but each word is little-endian (BADC)
+	BigByteSwap
+)
+
+func (o WordOrder) String() string {
+	switch o {
+	case BigEndian:
+		return "BigEndian(ABCD)"
+	case LittleEndian:
+		return "LittleEndian(DCBA)"
+	case BigByteSwap:
+		return "BigByteSwap(BADC)"
+	case LittleByteSwap:
+		return "LittleByteSwap(CDAB)"
+	}
+	return fmt.Sprintf("WordOrder(%d)", int(o))
+}
+
+// ByteOrder identifies how the 2 characters of a string are stored in each register
+type ByteOrder int
+
+const (
+	// HighByteFirst stores the first character of each pair in the high byte of the register
+	HighByteFirst ByteOrder = iota
+	// LowByteFirst stores the first character of each pair in the low byte of the register
+	LowByteFirst
+)
+
+func (o ByteOrder) String() string {
+	switch o {
+	case HighByteFirst:
+		return "HighByteFirst"
+	case LowByteFirst:
+		return "LowByteFirst"
+	}
+	return fmt.Sprintf("ByteOrder(%d)", int(o))
+}
+
+// wordSwap is true if the least significant word is stored first
+func (o WordOrder) wordSwap() bool {
+	return o == LittleEndian || o == LittleByteSwap
+}
+
+// byteSwap is true if the bytes in each word are little-endian
+func (o WordOrder) byteSwap() bool {
+	return o == LittleEndian || o == BigByteSwap
+}
 
 // dataBuilder is used to build outgoing frames we send to a remote system
 type dataBuilder struct {
@@ -90,6 +163,27 @@ func (p *dataBuilder) nbits(bits ...bool) {
 	p.bits(bits...)
 }
 
+// ordered adds each value as size words in the layout of the word order
+func (p *dataBuilder) ordered(order WordOrder, size int, values ...uint64) {
+	for _, v := range values {
+		group := make([]byte, size*2)
+		for i := size - 1; i >= 0; i-- {
+			w := i
+			if order.wordSwap() {
+				w = size - 1 - i
+			}
+			hi, lo := byte(v>>8), byte(v)
+			if order.byteSwap() {
+				hi, lo = lo, hi
+			}
+			group[w*2] = hi
+			group[w*2+1] = lo
+			v >>= 16
+		}
+		p.data = append(p.data, group...)
+	}
+}
+
 func (p *dataBuilder) beacon() {
 	p.sizes = append(p.sizes, len(p.data))
 	p.byte(0)
@@ -104,6 +198,16 @@ func getReader(payload []byte) dataReader {
 	return dataReader{0, payload}
 }
 
+// lengthError is returned by a dataReader when the data is shorter, or longer, than expected. A server responds to it
+// with an Illegal Data Value exception, which is what the spec requires for a request with an incorrect length.
+type lengthError struct {
+	msg string
+}
+
+func (err *lengthError) Error() string {
+	return err.msg
+}
+
 func (p *dataReader) canRead(count int) error {
 	over := p.cursor + count - len(p.data)
 	if over > 0 {
@@ -115,7 +219,7 @@ func (p *dataReader) canRead(count int) error {
 		if count > 1 {
 			cs = "s"
 		}
-		return fmt.Errorf("Unable to read %v byte%v beyond end of data. Request %v byte%v from %v in %v size slice", over, os, count, cs, p.cursor, len(p.data))
+		return &lengthError{fmt.Sprintf("Unable to read %v byte%v beyond end of data. Request %v byte%v from %v in %v size slice", over, os, count, cs, p.cursor, len(p.data))}
 	}
 	return nil
 }
@@ -192,13 +296,7 @@ func (p *dataReader) bits(count int) ([]bool, error) {
 	if len(packed) != x {
 		return nil, fmt.Errorf("Expected %v bits to be packed in to %v bytes, but got %v", count, x, len(packed))
 	}
-	bits := make([]bool, count)
-	for c := range bits {
-		i := c / 8
-		b := (c % 8)
-		bits[c] = (packed[i] & (1 << b)) != 0
-	}
-	return bits, nil
+	return unpackBits(packed, count), nil
 }
 
 func (p *dataReader) nbits() ([]bool, error) {
@@ -211,13 +309,44 @@ func (p *dataReader) nbits() ([]bool, error) {
 	if err != nil {
 		return nil, err
 	}
+	return unpackBits(packed, count), nil
+}
+
+// unpackBits gets count bits from the packed bytes, least significant bit first
+func unpackBits(packed []int, count int) []bool {
 	bits := make([]bool, count)
 	for c := range bits {
 		i := c / 8
 		b := (c % 8)
 		bits[c] = (packed[i] & (1 << b)) != 0
 	}
-	return bits, nil
+	return bits
+}
+
+// ordered reads count values that are each size words in the layout of the word order
+func (p *dataReader) ordered(order WordOrder, size int, count int) ([]uint64, error) {
+	raw, err := p.bytesRaw(size * 2 * count)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]uint64, count)
+	for i := range ret {
+		group := raw[i*size*2 : (i+1)*size*2]
+		v := uint64(0)
+		for j := 0; j < size; j++ {
+			w := j
+			if order.wordSwap() {
+				w = size - 1 - j
+			}
+			hi, lo := group[w*2], group[w*2+1]
+			if order.byteSwap() {
+				hi, lo = lo, hi
+			}
+			v = v<<16 | uint64(hi)<<8 | uint64(lo)
+		}
+		ret[i] = v
+	}
+	return ret, nil
 }
 
 func (p *dataReader) remaining() error {
@@ -227,7 +356,161 @@ func (p *dataReader) remaining() error {
 		if left != 1 {
 			ls = "s"
 		}
-		return fmt.Errorf("Expected to read all the payload data, but %v byte%v remain", left, ls)
+		return &lengthError{fmt.Sprintf("Expected to read all the payload data, but %v byte%v remain", left, ls)}
 	}
 	return nil
 }
+
+// wordsToValues combines each group of size words in to a single value using the word order
+func wordsToValues(words []int, size int, order WordOrder) ([]uint64, error) {
+	if len(words)%size != 0 {
+		return nil, fmt.Errorf("Expected a multiple of %v words to decode %v-bit values, but got %v", size, size*16, len(words))
+	}
+	// the words are in wire (big-endian) order, read them back in the word order
+	p := dataBuilder{}
+	p.words(words...)
+	r := getReader(p.payload())
+	return r.ordered(order, size, len(words)/size)
+}
+
+// valuesToWords splits each value in to size words using the word order
+func valuesToWords(values []uint64, size int, order WordOrder) []int {
+	p := dataBuilder{}
+	p.ordered(order, size, values...)
+	// read the layout back as wire (big-endian) words
+	r := getReader(p.payload())
+	ret, _ := r.words(len(values) * size)
+	return ret
+}
+
+func wordsToFloat32s(words []int, order WordOrder) ([]float32, error) {
+	values, err := wordsToValues(words, 2, order)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]float32, len(values))
+	for i, v := range values {
+		ret[i] = math.Float32frombits(uint32(v))
+	}
+	return ret, nil
+}
+
+func float32sToWords(floats []float32, order WordOrder) []int {
+	values := make([]uint64, len(floats))
+	for i, f := range floats {
+		values[i] = uint64(math.Float32bits(f))
+	}
+	return valuesToWords(values, 2, order)
+}
+
+func wordsToInt16s(words []int) []int16 {
+	ret := make([]int16, len(words))
+	for i, w := range words {
+		// the conversion to int16 sign-extends values above 0x7fff
+		ret[i] = int16(uint16(w))
+	}
+	return ret
+}
+
+func wordsToUint32s(words []int, order WordOrder) ([]uint32, error) {
+	values, err := wordsToValues(words, 2, order)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]uint32, len(values))
+	for i, v := range values {
+		ret[i] = uint32(v)
+	}
+	return ret, nil
+}
+
+func wordsToInt32s(words []int, order WordOrder) ([]int32, error) {
+	values, err := wordsToValues(words, 2, order)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]int32, len(values))
+	for i, v := range values {
+		ret[i] = int32(uint32(v))
+	}
+	return ret, nil
+}
+
+func wordsToInt64s(words []int, order WordOrder) ([]int64, error) {
+	values, err := wordsToValues(words, 4, order)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]int64, len(values))
+	for i, v := range values {
+		ret[i] = int64(v)
+	}
+	return ret, nil
+}
+
+// wordsToBCD unpacks each word as 4 binary-coded-decimal digits, e.g. 0x1234 is 1234
+func wordsToBCD(words []int) ([]int, error) {
+	ret := make([]int, len(words))
+	for i, w := range words {
+		value := 0
+		for shift := 12; shift >= 0; shift -= 4 {
+			digit := (w >> shift) & 0x0f
+			if digit > 9 {
+				return nil, fmt.Errorf("Value 0x%04x at index %v is not binary-coded-decimal: digit 0x%x is not 0 to 9", w, i, digit)
+			}
+			value = value*10 + digit
+		}
+		ret[i] = value
+	}
+	return ret, nil
+}
+
+// bcdToWords packs each value in to a word as 4 binary-coded-decimal digits, e.g. 1234 is 0x1234
+func bcdToWords(values []int) ([]int, error) {
+	ret := make([]int, len(values))
+	for i, v := range values {
+		if v < 0 || v > 9999 {
+			return nil, fmt.Errorf("Value %v at index %v can not be binary-coded-decimal, must be from 0 to 9999", v, i)
+		}
+		word := 0
+		for shift := 0; v > 0; shift += 4 {
+			word |= (v % 10) << shift
+			v /= 10
+		}
+		ret[i] = word
+	}
+	return ret, nil
+}
+
+// stringToWords packs the string in to words, 2 bytes per word, padding the last word with a null if needed
+func stringToWords(s string, order ByteOrder) []int {
+	data := []byte(s)
+	if len(data)%2 != 0 {
+		data = append(data, 0)
+	}
+	ret := make([]int, len(data)/2)
+	for i := range ret {
+		hi, lo := data[i*2], data[i*2+1]
+		if order == LowByteFirst {
+			hi, lo = lo, hi
+		}
+		ret[i] = int(hi)<<8 | int(lo)
+	}
+	return ret
+}
+
+// wordsToString unpacks 2 bytes per word in to a string, trailing null characters are removed
+func wordsToString(words []int, order ByteOrder) string {
+	data := make([]byte, 0, len(words)*2)
+	for _, w := range words {
+		hi, lo := byte(w>>8), byte(w)
+		if order == LowByteFirst {
+			hi, lo = lo, hi
+		}
+		data = append(data, hi, lo)
+	}
+	for len(data) > 0 && data[len(data)-1] == 0 {
+		data = data[:len(data)-1]
+	}
+	return string(data)
+}
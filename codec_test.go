@@ -0,0 +1,95 @@
+package modbus
+
+import "testing"
+
+func TestWordOrderValues(t *testing.T) {
+	// the values are stored and serialized by applications, so they must not change
+	orders := []WordOrder{BigEndian, LittleByteSwap, LittleEndian, BigByteSwap}
+	for i, order := range orders {
+		if int(order) != i {
+			t.Fatalf("Expected %v to have the value %v, not %v", order, i, int(order))
+		}
+	}
+}
+
+func TestWordOrderRoundTrip(t *testing.T) {
+	expect := map[WordOrder][]int{
+		BigEndian:      {0x1234, 0x5678},
+		LittleByteSwap: {0x5678, 0x1234},
+		LittleEndian:   {0x7856, 0x3412},
+		BigByteSwap:    {0x3412, 0x7856},
+	}
+	for order, words := range expect {
+		got := valuesToWords([]uint64{0x12345678}, 2, order)
+		if got[0] != words[0] || got[1] != words[1] {
+			t.Fatalf("Expected %v to store 0x12345678 as %04x, not %04x", order, words, got)
+		}
+		values, err := wordsToValues(got, 2, order)
+		if err != nil || values[0] != 0x12345678 {
+			t.Fatalf("Expected %v to read back 0x12345678, not %x (%v)", order, values, err)
+		}
+	}
+}
+
+func TestAsInt16(t *testing.T) {
+	read := X03xReadHolding{Values: []int{0x0000, 0x7fff, 0x8000, 0xffff}}
+	expect := []int16{0, 32767, -32768, -1}
+	got := read.AsInt16()
+	for i, v := range expect {
+		if got[i] != v {
+			t.Fatalf("Expected %v to be %v, not %v", read.Values, expect, got)
+		}
+	}
+}
+
+func TestSignedWordGroups(t *testing.T) {
+	read := X03xReadHolding{Values: []int{0xffff, 0xfffe, 0xffff, 0xffff}}
+	got32, err := read.AsInt32s(BigEndian)
+	if err != nil || len(got32) != 2 || got32[0] != -2 || got32[1] != -1 {
+		t.Fatalf("Expected [-2 -1], not %v (%v)", got32, err)
+	}
+	got64, err := read.AsInt64s(BigEndian)
+	// 0xfffffffeffffffff
+	if err != nil || len(got64) != 1 || got64[0] != -0x100000001 {
+		t.Fatalf("Expected [%v], not %v (%v)", -0x100000001, got64, err)
+	}
+
+	// values that do not make complete groups are an error, not a panic
+	for _, count := range []int{1, 3} {
+		read := X03xReadHolding{Values: make([]int, count)}
+		if _, err := read.AsInt32s(BigEndian); err == nil {
+			t.Fatalf("Expected %v values to be rejected as 32-bit integers", count)
+		}
+		if _, err := read.AsInt64s(BigEndian); err == nil {
+			t.Fatalf("Expected %v values to be rejected as 64-bit integers", count)
+		}
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	tests := []struct {
+		s     string
+		order ByteOrder
+		words []int
+	}{
+		{"ABCD", HighByteFirst, []int{0x4142, 0x4344}},
+		{"ABCD", LowByteFirst, []int{0x4241, 0x4443}},
+		// an odd length is padded with a null
+		{"ABC", HighByteFirst, []int{0x4142, 0x4300}},
+		{"ABC", LowByteFirst, []int{0x4241, 0x0043}},
+	}
+	for _, test := range tests {
+		got := stringToWords(test.s, test.order)
+		if len(got) != len(test.words) {
+			t.Fatalf("Expected %q to be stored as %04x, not %04x", test.s, test.words, got)
+		}
+		for i, w := range test.words {
+			if got[i] != w {
+				t.Fatalf("Expected %q to be stored as %04x, not %04x", test.s, test.words, got)
+			}
+		}
+		if back := wordsToString(got, test.order); back != test.s {
+			t.Fatalf("Expected %04x to read back as %q, not %q", got, test.s, back)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package modbus
+
+/*
+This file contains the construction of the request PDUs that clients send. The exported Encode functions return the
+exact bytes (the function code followed by the request data) that the matching client call would send to a remote unit,
+without the unit ID or any transport framing (MBAP header, CRC, LRC). They do not need a Modbus instance, and are
+intended for testing and interoperability checks against the examples in the Modbus specification.
+*/
+
+// encoded returns the function code followed by the data of the PDU
+func (p pdu) encoded() []byte {
+	ret := make([]byte, 0, len(p.data)+1)
+	ret = append(ret, p.function)
+	return append(ret, p.data...)
+}
+
+func encodeAddressCount(function byte, from int, count int) pdu {
+	p := dataBuilder{}
+	p.word(from)
+	p.word(count)
+	return pdu{function, p.payload()}
+}
+
+func encodeWriteSingleCoil(address int, value bool) pdu {
+	p := dataBuilder{}
+	p.word(address)
+	if value {
+		p.word(0xFF00)
+	} else {
+		p.word(0x0000)
+	}
+	return pdu{0x05, p.payload()}
+}
+
+func encodeWriteMultipleCoils(address int, values []bool) pdu {
+	p := dataBuilder{}
+	p.word(address)
+	p.nbits(values...)
+	return pdu{0x0F, p.payload()}
+}
+
+func encodeWriteMultipleHoldings(address int, values []int) pdu {
+	p := dataBuilder{}
+	p.word(address)
+	p.word(len(values))
+	p.byte(len(values) * 2)
+	p.words(values...)
+	return pdu{0x10, p.payload()}
+}
+
+func encodeWriteReadMultipleHoldings(read int, count int, write int, values []int) pdu {
+	p := dataBuilder{}
+	p.word(read)
+	p.word(count)
+	p.word(write)
+	p.word(len(values))
+	p.byte(len(values) * 2)
+	p.words(values...)
+	return pdu{0x17, p.payload()}
+}
+
+func encodeMaskWriteHolding(address int, andmask int, ormask int) pdu {
+	p := dataBuilder{}
+	p.word(address)
+	p.word(andmask)
+	p.word(ormask)
+	return pdu{0x16, p.payload()}
+}
+
+func encodeReadFIFOQueue(from int) pdu {
+	p := dataBuilder{}
+	p.word(from)
+	return pdu{0x18, p.payload()}
+}
+
+func encodeReadFileRecords(requests []X14xReadRecordRequest) pdu {
+	p := dataBuilder{}
+	p.beacon() // set a byte counter here...
+	for _, req := range requests {
+		p.byte(6) // from spec: The reference type: 1 byte (must be specified as 6)
+		p.word(req.File)
+		p.word(req.Record)
+		p.word(req.Length)
+	}
+	return pdu{0x14, p.payload()}
+}
+
+func encodeWriteFileRecords(requests []X15xWriteFileRecordRequest) pdu {
+	p := dataBuilder{}
+	p.beacon()
+	for _, r := range requests {
+		p.byte(6) // from spec: The reference type: 1 byte (must be specified as 6)
+		p.word(r.File)
+		p.word(r.Record)
+		p.word(len(r.Values))
+		p.words(r.Values...)
+	}
+	return pdu{0x15, p.payload()}
+}
+
+// encodeDiagnostic is a Diagnostics request for the sub-function, with the data words
+func encodeDiagnostic(subfunction int, data ...int) pdu {
+	p := dataBuilder{}
+	p.word(subfunction)
+	p.words(data...)
+	return pdu{0x08, p.payload()}
+}
+
+func encodeEncapsulatedInterface(meiType int, data []int) pdu {
+	p := dataBuilder{}
+	p.byte(meiType)
+	p.bytes(data...)
+	return pdu{0x2b, p.payload()}
+}
+
+// encodeDeviceIdentification is a Read Device Identification (MEI type 0x0E) request
+func encodeDeviceIdentification(code int, objectID int) pdu {
+	return encodeEncapsulatedInterface(0x0e, []int{code, objectID})
+}
+
+// EncodeReadDiscretes returns the request PDU bytes for a ReadDiscretes call
+func EncodeReadDiscretes(from int, count int) []byte {
+	return encodeAddressCount(0x02, from, count).encoded()
+}
+
+// EncodeReadCoils returns the request PDU bytes for a ReadCoils call
+func EncodeReadCoils(from int, count int) []byte {
+	return encodeAddressCount(0x01, from, count).encoded()
+}
+
+// EncodeWriteSingleCoil returns the request PDU bytes for a WriteSingleCoil call
+func EncodeWriteSingleCoil(address int, value bool) []byte {
+	return encodeWriteSingleCoil(address, value).encoded()
+}
+
+// EncodeWriteMultipleCoils returns the request PDU bytes for a WriteMultipleCoils call
+func EncodeWriteMultipleCoils(address int, values []bool) []byte {
+	return encodeWriteMultipleCoils(address, values).encoded()
+}
+
+// EncodeReadInputs returns the request PDU bytes for a ReadInputs call
+func EncodeReadInputs(from int, count int) []byte {
+	return encodeAddressCount(0x04, from, count).encoded()
+}
+
+// EncodeReadHoldings returns the request PDU bytes for a ReadHoldings call
+func EncodeReadHoldings(from int, count int) []byte {
+	return encodeAddressCount(0x03, from, count).encoded()
+}
+
+// EncodeWriteSingleHolding returns the request PDU bytes for a WriteSingleHolding call
+func EncodeWriteSingleHolding(address int, value int) []byte {
+	return encodeAddressCount(0x06, address, value).encoded()
+}
+
+// EncodeWriteMultipleHoldings returns the request PDU bytes for a WriteMultipleHoldings call
+func EncodeWriteMultipleHoldings(address int, values []int) []byte {
+	return encodeWriteMultipleHoldings(address, values).encoded()
+}
+
+// EncodeWriteReadMultipleHoldings returns the request PDU bytes for a WriteReadMultipleHoldings call
+func EncodeWriteReadMultipleHoldings(read int, count int, write int, values []int) []byte {
+	return encodeWriteReadMultipleHoldings(read, count, write, values).encoded()
+}
+
+// EncodeMaskWriteHolding returns the request PDU bytes for a MaskWriteHolding call
+func EncodeMaskWriteHolding(address int, andmask int, ormask int) []byte {
+	return encodeMaskWriteHolding(address, andmask, ormask).encoded()
+}
+
+// EncodeReadFIFOQueue returns the request PDU bytes for a ReadFIFOQueue call
+func EncodeReadFIFOQueue(from int) []byte {
+	return encodeReadFIFOQueue(from).encoded()
+}
+
+// EncodeReadMultiFileRecords returns the request PDU bytes for a ReadMultiFileRecords call
+func EncodeReadMultiFileRecords(requests []X14xReadRecordRequest) []byte {
+	return encodeReadFileRecords(requests).encoded()
+}
+
+// EncodeReadFileRecords returns the request PDU bytes for a ReadFileRecords call
+func EncodeReadFileRecords(file int, record int, length int) []byte {
+	return encodeReadFileRecords([]X14xReadRecordRequest{{file, record, length}}).encoded()
+}
+
+// EncodeWriteMultiFileRecords returns the request PDU bytes for a WriteMultiFileRecords call
+func EncodeWriteMultiFileRecords(requests []X15xWriteFileRecordRequest) []byte {
+	return encodeWriteFileRecords(requests).encoded()
+}
+
+// EncodeWriteFileRecords returns the request PDU bytes for a WriteFileRecords call
+func EncodeWriteFileRecords(file int, record int, values []int) []byte {
+	return encodeWriteFileRecords([]X15xWriteFileRecordRequest{{file, record, values}}).encoded()
+}
+
+// EncodeDiagnosticEcho returns the request PDU bytes for a DiagnosticEcho call
+func EncodeDiagnosticEcho(data []int) []byte {
+	return encodeDiagnostic(0x00, data...).encoded()
+}
+
+// EncodeRestartComm returns the request PDU bytes for a RestartComm call
+func EncodeRestartComm(clearLog bool) []byte {
+	return encodeDiagnostic(0x01, restartCommData(clearLog)).encoded()
+}
+
+// EncodeDiagnosticClear returns the request PDU bytes for a DiagnosticClear call
+func EncodeDiagnosticClear() []byte {
+	return encodeDiagnostic(0x0a, 0x00).encoded()
+}
+
+// EncodeDiagnosticCount returns the request PDU bytes for a DiagnosticCount call
+func EncodeDiagnosticCount(counter Diagnostic) []byte {
+	return encodeDiagnostic(int(counter), 0x00).encoded()
+}
+
+// EncodeEncapsulatedInterface returns the request PDU bytes for an EncapsulatedInterface call
+func EncodeEncapsulatedInterface(meiType int, data []int) []byte {
+	return encodeEncapsulatedInterface(meiType, data).encoded()
+}
+
+// EncodeDeviceIdentificationRange returns the request PDU bytes for the first request of a DeviceIdentificationRange
+// call
+func EncodeDeviceIdentificationRange(code int, from int) []byte {
+	return encodeDeviceIdentification(code, from).encoded()
+}
+
+// EncodeDeviceIdentificationObject returns the request PDU bytes for a DeviceIdentificationObject call
+func EncodeDeviceIdentificationObject(objectID int) []byte {
+	return encodeDeviceIdentification(4, objectID).encoded()
+}
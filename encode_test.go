@@ -0,0 +1,33 @@
+package modbus
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeSpecificationExamples(t *testing.T) {
+	tests := []struct {
+		name   string
+		got    []byte
+		expect []byte
+	}{
+		{"ReadHoldings", EncodeReadHoldings(0x006b, 3), []byte{0x03, 0x00, 0x6b, 0x00, 0x03}},
+		{"ReadMultiFileRecords", EncodeReadMultiFileRecords([]X14xReadRecordRequest{{4, 1, 2}, {3, 9, 2}}),
+			[]byte{0x14, 0x0e, 0x06, 0x00, 0x04, 0x00, 0x01, 0x00, 0x02, 0x06, 0x00, 0x03, 0x00, 0x09, 0x00, 0x02}},
+		{"ReadFileRecords", EncodeReadFileRecords(4, 1, 2), []byte{0x14, 0x07, 0x06, 0x00, 0x04, 0x00, 0x01, 0x00, 0x02}},
+		{"WriteFileRecords", EncodeWriteFileRecords(4, 7, []int{0x06af, 0x04be, 0x100d}),
+			[]byte{0x15, 0x0d, 0x06, 0x00, 0x04, 0x00, 0x07, 0x00, 0x03, 0x06, 0xaf, 0x04, 0xbe, 0x10, 0x0d}},
+		{"DiagnosticEcho", EncodeDiagnosticEcho([]int{0xa537}), []byte{0x08, 0x00, 0x00, 0xa5, 0x37}},
+		{"RestartComm", EncodeRestartComm(true), []byte{0x08, 0x00, 0x01, 0xff, 0x00}},
+		{"DiagnosticClear", EncodeDiagnosticClear(), []byte{0x08, 0x00, 0x0a, 0x00, 0x00}},
+		{"DiagnosticCount", EncodeDiagnosticCount(BusMessages), []byte{0x08, 0x00, 0x0b, 0x00, 0x00}},
+		{"DeviceIdentificationRange", EncodeDeviceIdentificationRange(1, 0), []byte{0x2b, 0x0e, 0x01, 0x00}},
+		{"DeviceIdentificationObject", EncodeDeviceIdentificationObject(0x81), []byte{0x2b, 0x0e, 0x04, 0x81}},
+		{"EncapsulatedInterface", EncodeEncapsulatedInterface(0x0d, []int{1, 2}), []byte{0x2b, 0x0d, 0x01, 0x02}},
+	}
+	for _, test := range tests {
+		if !bytes.Equal(test.got, test.expect) {
+			t.Errorf("Expected %v to encode as % 02x, not % 02x", test.name, test.expect, test.got)
+		}
+	}
+}
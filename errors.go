@@ -1,10 +1,25 @@
 package modbus
 
 import (
+	"errors"
 	"fmt"
 )
 
-// Error is a custom type for Modbus errors
+// ErrTimeout is wrapped by the errors returned from client requests that did not complete before the timeout. Use
+// errors.Is(err, modbus.ErrTimeout) to check for it.
+var ErrTimeout = errors.New("Timeout exceeded")
+
+// errNoResponse is returned by a server that handled a request, but does not send a response to it (for example, when
+// it is in listen only mode).
+var errNoResponse = errors.New("No response")
+
+// Error is a custom type for Modbus errors. Servers return an Error to send a specific exception code to the client,
+// and clients return an Error when the remote unit responds with an exception. Use errors.As to check the Code:
+//
+//	var mbErr *modbus.Error
+//	if errors.As(err, &mbErr) && mbErr.Code() == 2 {
+//		// the remote unit does not have that address
+//	}
 type Error struct {
 	msg  string
 	code uint8
@@ -22,12 +37,65 @@ func (err *Error) Code() uint8 {
 // PDU Returns the error in the form of a Modbus exception response PDU
 func (err *Error) asPDU(function uint8) pdu {
 	p := pdu{}
-	p.function |= 0x80
+	p.function = function | 0x80
 	p.data = make([]uint8, 1)
 	p.data[0] = err.code
 	return p
 }
 
+// exceptionError converts the exception code in a response from a remote unit to an Error
+func exceptionError(code uint8) *Error {
+	switch code {
+	case 1:
+		return &Error{"Modbus Illegal Function", code}
+	case 2:
+		return &Error{"Modbus Illegal Data Address", code}
+	case 3:
+		return &Error{"Modbus Illegal Data Value", code}
+	case 4:
+		return &Error{"Modbus Server Device Failure", code}
+	case 5:
+		return &Error{"Modbus ACK Only", code}
+	case 6:
+		return &Error{"Modbus Server Busy", code}
+	case 7:
+		return &Error{"Modbus Negative Acknowledge", code}
+	case 8:
+		return &Error{"Modbus Memory Parity Error", code}
+	case 0x0A:
+		return &Error{"Modbus Gateway Path Unavailable", code}
+	case 0x0B:
+		return &Error{"Modbus Gateway Target Device Failed to Respond", code}
+	}
+	return &Error{fmt.Sprintf("Modbus Unknown error code: %v", code), code}
+}
+
+// deviceResponded is true if the remote unit itself responded: the request succeeded, or the unit responded with an
+// exception. The gateway exceptions (0x0A and 0x0B) are sent by a gateway when the unit behind it does not respond.
+func deviceResponded(err error) bool {
+	if err == nil {
+		return true
+	}
+	var mbErr *Error
+	if !errors.As(err, &mbErr) {
+		return false
+	}
+	return mbErr.Code() != 0x0A && mbErr.Code() != 0x0B
+}
+
+// exceptionCode is the exception code that is sent to a client for the error, 0 if there is no error, and 4 (Server
+// Device Failure) if the error is not an Error.
+func exceptionCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var mbErr *Error
+	if errors.As(err, &mbErr) {
+		return int(mbErr.Code())
+	}
+	return 4
+}
+
 // IllegalFunctionErrorF represents an invalid function code - Modbus error code 1
 func IllegalFunctionErrorF(format string, args ...interface{}) *Error {
 	return &Error{fmt.Sprintf(format, args...), 1}
@@ -52,3 +120,51 @@ func ServerFailureErrorF(format string, args ...interface{}) *Error {
 func ServerBusyErrorF(format string, args ...interface{}) *Error {
 	return &Error{fmt.Sprintf(format, args...), 6}
 }
+
+// GatewayPathErrorF represents a gateway that is unable to route the request to the target unit - Modbus error code 0x0A
+func GatewayPathErrorF(format string, args ...interface{}) *Error {
+	return &Error{fmt.Sprintf(format, args...), 0x0A}
+}
+
+// GatewayTargetErrorF represents a gateway that routed the request, but the target unit did not respond - Modbus error code 0x0B
+func GatewayTargetErrorF(format string, args ...interface{}) *Error {
+	return &Error{fmt.Sprintf(format, args...), 0x0B}
+}
+
+// DecodeError is returned by a client when the response from the remote unit cannot be decoded, for example when it is
+// too short. Log the Raw response to diagnose a misbehaving device.
+type DecodeError struct {
+	// Function is the function code of the response
+	Function int
+	// Raw is the response PDU, the function code followed by the data
+	Raw []byte
+	// Err is the reason the response could not be decoded
+	Err error
+}
+
+func (err *DecodeError) Error() string {
+	return fmt.Sprintf("Unable to decode function 0x%02x response [%v]: %v", err.Function, toHex(bytesToInt(err.Raw)), err.Err)
+}
+
+// Unwrap returns the reason the response could not be decoded
+func (err *DecodeError) Unwrap() error {
+	return err.Err
+}
+
+// PartialError is returned when a request that was split in to multiple PDUs fails after some of the PDUs succeeded.
+// For a write, the values that were completed have been changed on the remote unit.
+type PartialError struct {
+	// Completed is the number of values (coils, registers, etc.) that were successfully processed before the failure
+	Completed int
+	// Err is the reason the next PDU failed
+	Err error
+}
+
+func (err *PartialError) Error() string {
+	return fmt.Sprintf("Failed after %v values were completed: %v", err.Completed, err.Err)
+}
+
+// Unwrap returns the reason the request failed
+func (err *PartialError) Unwrap() error {
+	return err.Err
+}
@@ -1,5 +1,19 @@
 module github.com/rolfl/modbus
 
-go 1.15
+go 1.19
 
-require github.com/jessevdk/go-flags v1.4.0 // indirect
+require (
+	github.com/jessevdk/go-flags v1.4.0
+	github.com/prometheus/client_golang v1.18.0
+	golang.org/x/sys v0.15.0
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/matttproud/golang_protobuf_extensions/v2 v2.0.0 // indirect
+	github.com/prometheus/client_model v0.5.0 // indirect
+	github.com/prometheus/common v0.45.0 // indirect
+	github.com/prometheus/procfs v0.12.0 // indirect
+	google.golang.org/protobuf v1.31.0 // indirect
+)
@@ -26,6 +26,13 @@ func byteClamp(val int) int {
 	return val
 }
 
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 func checkPanic(to string, val int, max int) {
 	if val < 0 {
 		panic(fmt.Sprintf("Unable to convert %v to %v - negative", val, to))
@@ -106,22 +113,20 @@ func iSetByte(data []byte, index int, value int) {
 	data[index] = bytePanic(value)
 }
 
-func computeCRC16(data []byte) (crc uint16) {
-	crc = 0xFFFF
-	for _, d := range data {
-		crc ^= uint16(d)
-		for b := 0; b < 8; b++ {
-			if crc&0x1 == 1 {
-				crc >>= 1
-				crc ^= 0xA001
-			} else {
-				crc >>= 1
-			}
+// boolsToInts converts bits to 0 and 1 values
+func boolsToInts(bits []bool) []int {
+	ret := make([]int, len(bits))
+	for i, b := range bits {
+		if b {
+			ret[i] = 1
 		}
 	}
-	return
+	return ret
 }
 
+// fileRecordLimit is the number of records a file can have, the record numbers are 0 to 0x270F
+const fileRecordLimit = 0x2710
+
 // serverCheckAddress validates that an address and length is covered by the available data
 func serverCheckAddress(name string, address, count, limit int) error {
 	if address+count <= limit {
@@ -133,3 +138,47 @@ func serverCheckAddress(name string, address, count, limit int) error {
 	}
 	return IllegalAddressErrorF("%v: unable to get %v item%v from %v with limit of %v", name, count, plural, address, limit)
 }
+
+// serverCheckQuantity validates the number of values in a request against the limit in the spec for the function, so
+// that the response fits in a PDU
+func serverCheckQuantity(name string, count, max int) error {
+	if count >= 1 && count <= max {
+		return nil
+	}
+	return IllegalValueErrorF("%v: quantity %v is not valid: it must be in the range 1 to %v", name, count, max)
+}
+
+// clientCheckFileRecord validates the file, record and length values of a file record request against the limits in the spec
+func clientCheckFileRecord(file, record, length int) error {
+	if file < 1 || file > 0xffff {
+		return fmt.Errorf("File number %v is not valid: it must be in the range 1 to 65535", file)
+	}
+	if record < 0 || record >= fileRecordLimit {
+		return fmt.Errorf("Record number %v in file %v is not valid: it must be in the range 0 to 9999", record, file)
+	}
+	if length < 1 || length > 0xffff {
+		return fmt.Errorf("Record length %v for file %v record %v is not valid: it must be in the range 1 to 65535", length, file, record)
+	}
+	return nil
+}
+
+// chunked calls fn for each successive chunk of at most max items of the count items starting at from. If a chunk
+// fails after others have succeeded, the error is a *PartialError
+func chunked(from int, count int, max int, fn func(from int, count int) error) error {
+	if count <= max || max <= 0 {
+		return fn(from, count)
+	}
+	for done := 0; done < count; done += max {
+		size := count - done
+		if size > max {
+			size = max
+		}
+		if err := fn(from+done, size); err != nil {
+			if done == 0 {
+				return err
+			}
+			return &PartialError{done, err}
+		}
+	}
+	return nil
+}
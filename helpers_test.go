@@ -0,0 +1,29 @@
+package modbus
+
+import "testing"
+
+func TestClientCheckFileRecord(t *testing.T) {
+	tests := []struct {
+		file   int
+		record int
+		length int
+		valid  bool
+	}{
+		{0, 0, 1, false},
+		{1, 0, 1, true},
+		{65535, 0, 1, true},
+		{65536, 0, 1, false},
+		{1, -1, 1, false},
+		{1, 9999, 1, true},
+		{1, 10000, 1, false},
+		{1, 0, 0, false},
+		{1, 0, 65535, true},
+		{1, 0, 65536, false},
+	}
+	for _, test := range tests {
+		err := clientCheckFileRecord(test.file, test.record, test.length)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("Expected file %v record %v length %v to be valid %v, not %v", test.file, test.record, test.length, test.valid, err)
+		}
+	}
+}
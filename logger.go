@@ -0,0 +1,46 @@
+package modbus
+
+import "sync"
+
+// Logger receives the diagnostic messages that a Modbus instance produces: Debugf for the normal progress of the
+// communication (connections opened and closed, requests handled), and Errorf for problems on the wire (CRC errors,
+// malformed frames, failed connections). See Modbus.SetLogger
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...interface{}) {}
+func (nopLogger) Errorf(format string, args ...interface{}) {}
+
+// logSink holds the Logger that messages are sent to, which may be replaced while the transport is running. Nothing is
+// logged until a Logger is set.
+type logSink struct {
+	lock   sync.Mutex
+	logger Logger
+}
+
+func (l *logSink) set(logger Logger) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.logger = logger
+}
+
+func (l *logSink) get() Logger {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.logger == nil {
+		return nopLogger{}
+	}
+	return l.logger
+}
+
+func (l *logSink) Debugf(format string, args ...interface{}) {
+	l.get().Debugf(format, args...)
+}
+
+func (l *logSink) Errorf(format string, args ...interface{}) {
+	l.get().Errorf(format, args...)
+}
@@ -0,0 +1,106 @@
+package modbus
+
+import "sync"
+
+// loopback is one end of an in-process link between two Modbus instances. The frames sent by one end are received by
+// the other.
+type loopback struct {
+	name string
+	// the largest PDU that is framed
+	pduLimit
+	// Write to this channel to queue frames to send
+	toTX chan adu
+	// Frames from the other end will be readable from this channel
+	toDemux chan adu
+	// the other end of the link
+	peer *loopback
+	// a channel that is closed when either end is closed
+	closed chan bool
+	once   *sync.Once
+	diag   *busDiagnosticManager
+	wlog   wireLog
+	log    logSink
+}
+
+/*
+NewLoopback returns two Modbus instances that are connected to each other in-process, without any socket or serial
+device. A Server set on one of them can be driven by the clients from the other, which makes it simple to test code
+that uses this library:
+
+	clientSide, serverSide := modbus.NewLoopback()
+	serverSide.SetServer(5, server)
+	holdings, _ := clientSide.GetClient(5).ReadHoldings(0, 10, time.Second)
+
+The frames are passed between the two instances the same way as on Modbus/TCP (they are encoded with an MBAP header,
+which is what a WireLogger receives), and unit 0 is not a broadcast (unless it is changed with SetUnitZeroBroadcast
+on both instances). Closing either instance closes both.
+*/
+func NewLoopback() (clientSide Modbus, serverSide Modbus) {
+	closed := make(chan bool)
+	once := &sync.Once{}
+	a := newLoopback("loopback client side", closed, once)
+	b := newLoopback("loopback server side", closed, once)
+	a.peer = b
+	b.peer = a
+	go a.wireWriter()
+	go b.wireWriter()
+	return newModbus(a.toTX, a.toDemux, a, a.diag), newModbus(b.toTX, b.toDemux, b, b.diag)
+}
+
+func newLoopback(name string, closed chan bool, once *sync.Once) *loopback {
+	l := &loopback{}
+	l.name = name
+	l.toTX = make(chan adu, 5)
+	l.toDemux = make(chan adu, 5)
+	l.closed = closed
+	l.once = once
+	l.diag = newBusDiagnosticManager()
+	return l
+}
+
+func (l *loopback) close() error {
+	l.once.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *loopback) setWireLogger(logger WireLogger) {
+	l.wlog.setLogger(logger, l.closed)
+}
+
+func (l *loopback) setLogger(logger Logger) {
+	l.log.set(logger)
+}
+
+// wireWriter takes frames that are ready to send, and passes them to the other end.
+func (l *loopback) wireWriter() {
+	for {
+		select {
+		case <-l.closed:
+			l.log.Debugf("Terminating %s writer: closed", l.name)
+			return
+		case f := <-l.toTX:
+			if !f.request {
+				l.diag.response(f.pdu)
+			}
+			frame := buildTCPFrame(f)
+			l.wlog.log(Sent, frame)
+			l.peer.receive(frame, f.request)
+		}
+	}
+}
+
+// receive decodes a frame from the other end, and submits it to the demuxer.
+func (l *loopback) receive(frame []byte, request bool) {
+	l.wlog.log(Received, frame)
+	f := decodeTCPFrame(frame)
+	// unlike the other transports, the loopback knows which frames are requests, so that a request cannot be mistaken
+	// for the response to a request that this end is waiting for.
+	f.request = request
+	l.diag.message(f.unit == 0)
+	select {
+	case <-l.closed:
+	case l.toDemux <- f:
+	}
+}
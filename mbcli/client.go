@@ -55,55 +55,64 @@ func client(access string) (modbus.Client, error) {
 		return busses[host].GetClient(unit), nil
 	}
 	if parts[0] == "rtu" {
-		if len(parts) < 6 || len(parts) > 8 {
-			return nil, fmt.Errorf("expect 6 to 8 parts for RTU client access rtu:device:baud:parity:stop:(minFrame:)(dtr:)unit - not: %v", access)
-		}
-		device := parts[1]
-		baud, ok := bauds[parts[2]]
-		if !ok {
-			return nil, fmt.Errorf("illegal baud %v", parts[2])
-		}
-		parity, ok := parities[parts[3]]
-		if !ok {
-			return nil, fmt.Errorf("illegal parity %v", parts[3])
-		}
-		stop, ok := stopbits[parts[4]]
-		if !ok {
-			return nil, fmt.Errorf("illegal stop bits %v", parts[4])
+		mb, unit, err := rtuBus(access, parts)
+		if err != nil {
+			return nil, err
 		}
-		idx := 5
-		last := len(parts) - 1
+		return mb.GetClient(unit), nil
+	}
+	return nil, fmt.Errorf("unknown modbus connection type %v (expect tcp or rtu)", parts[0])
+}
 
-		minFrame := 0 * time.Millisecond
-		dtr := false
-		if idx < last && parts[idx] == "dtr" {
-			dtr = true
-			idx++
-		}
-		if idx < last {
-			mf, err := strconv.Atoi(parts[idx])
-			if err != nil {
-				return nil, err
-			}
-			minFrame = time.Duration(mf) * time.Millisecond
-			idx++
-		}
-		if idx < last {
-			return nil, fmt.Errorf("illegal specification - unable to determine last part: %v", access)
-		}
-		unit, err := strconv.Atoi(parts[idx])
+// rtuBus returns the RTU bus for an rtu:device:baud:parity:stop:(minFrame:)(dtr:)unit specification, and the unit.
+func rtuBus(access string, parts []string) (modbus.Modbus, int, error) {
+	if len(parts) < 6 || len(parts) > 8 {
+		return nil, 0, fmt.Errorf("expect 6 to 8 parts for RTU access rtu:device:baud:parity:stop:(minFrame:)(dtr:)unit - not: %v", access)
+	}
+	device := parts[1]
+	baud, ok := bauds[parts[2]]
+	if !ok {
+		return nil, 0, fmt.Errorf("illegal baud %v", parts[2])
+	}
+	parity, ok := parities[parts[3]]
+	if !ok {
+		return nil, 0, fmt.Errorf("illegal parity %v", parts[3])
+	}
+	stop, ok := stopbits[parts[4]]
+	if !ok {
+		return nil, 0, fmt.Errorf("illegal stop bits %v", parts[4])
+	}
+	idx := 5
+	last := len(parts) - 1
+
+	minFrame := 0 * time.Millisecond
+	dtr := false
+	if idx < last && parts[idx] == "dtr" {
+		dtr = true
+		idx++
+	}
+	if idx < last {
+		mf, err := strconv.Atoi(parts[idx])
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
-		key := fmt.Sprintf("%v:%v:%v:%v:%v:%v", device, baud, parity, stop, minFrame, dtr)
-		if _, ok = busses[key]; !ok {
-			mb, err := modbus.NewRTU(device, baud, parity, stop, minFrame, dtr)
-			if err != nil {
-				return nil, err
-			}
-			busses[key] = mb
+		minFrame = time.Duration(mf) * time.Millisecond
+		idx++
+	}
+	if idx < last {
+		return nil, 0, fmt.Errorf("illegal specification - unable to determine last part: %v", access)
+	}
+	unit, err := strconv.Atoi(parts[idx])
+	if err != nil {
+		return nil, 0, err
+	}
+	key := fmt.Sprintf("%v:%v:%v:%v:%v:%v", device, baud, parity, stop, minFrame, dtr)
+	if _, ok = busses[key]; !ok {
+		mb, err := modbus.NewRTU(device, baud, parity, stop, minFrame, dtr)
+		if err != nil {
+			return nil, 0, err
 		}
-		return busses[key].GetClient(unit), nil
+		busses[key] = mb
 	}
-	return nil, fmt.Errorf("unknown modbus connection type %v (expect tcp or rtu)", parts[0])
+	return busses[key], unit, nil
 }
@@ -1,20 +1,22 @@
 package main
 
 import (
-	"fmt"
 	"time"
+
+	"github.com/rolfl/modbus"
 )
 
 type CoilGetCommands struct {
 	Units   []string `short:"u" long:"unit" description:"Unit(s) to contact" required:"true" env:"MBCLI_UNIT" env-delim:","`
 	Timeout int      `short:"t" long:"timeout" default:"5" description:"Timeout (in seconds)"`
-	Args    struct {
+	WatchOptions
+	Args struct {
 		Addresses []string `required:"1"`
 	} `positional-args:"yes" required:"yes"`
 }
 
 func (c *CoilGetCommands) Execute(args []string) error {
-	return genericClientReads("coil", c.Units, c.Args.Addresses, c.Timeout)
+	return genericClientReads(modbus.KindCoil, c.Units, c.Args.Addresses, c.Timeout, c.WatchOptions)
 }
 
 type CoilSetCommands struct {
@@ -44,15 +46,11 @@ func (c *CoilSetCommands) Execute(args []string) error {
 			}
 			_, err := client.WriteMultipleCoils(rng.address, flags, timeout)
 			if err != nil {
-				fmt.Printf("Write Holdings: Failed: %v\n", err)
+				output(sys, "Write Coils", nil, err)
 				continue
 			}
 			got, err := client.ReadCoils(rng.address, len(flags), timeout)
-			if err != nil {
-				fmt.Printf("Write Holdings verify: Failed: %v\n", err)
-			} else {
-				fmt.Printf("Write Holdings verify: %v\n", got)
-			}
+			output(sys, "Write Coils verify", got, err)
 		}
 	}
 	return nil
@@ -32,18 +32,12 @@ func (c *DiagnosticCommands) Execute(args []string) error {
 	for _, sys := range c.Units {
 		client, _ := client(sys)
 		if c.ServerID {
-			if sid, err := client.ServerID(timeout); err != nil {
-				fmt.Printf("ServerID: Failed: %v\n", err)
-			} else {
-				fmt.Printf("ServerID: %v\n", sid)
-			}
+			got, err := client.ServerID(timeout)
+			output(sys, "ServerID", got, err)
 		}
 		if c.DeviceID {
-			if did, err := client.DeviceIdentification(timeout); err != nil {
-				fmt.Printf("DeviceID: Failed: %v\n", err)
-			} else {
-				fmt.Printf("DeviceID: %v\n", did)
-			}
+			got, err := client.DeviceIdentification(timeout)
+			output(sys, "DeviceID", got, err)
 		}
 		if c.Counts {
 			counts := []modbus.Diagnostic{
@@ -56,26 +50,17 @@ func (c *DiagnosticCommands) Execute(args []string) error {
 				modbus.ServerBusies,
 			}
 			for _, count := range counts {
-				if cnt, err := client.DiagnosticCount(count, timeout); err != nil {
-					fmt.Printf("Count %v: Failed: %v\n", count, err)
-				} else {
-					fmt.Printf("Count: %v\n", cnt)
-				}
+				cnt, err := client.DiagnosticCount(count, timeout)
+				output(sys, fmt.Sprintf("Count %v", count), cnt, err)
 			}
 		}
 		if c.Clear {
-			if err := client.DiagnosticClear(timeout); err != nil {
-				fmt.Printf("Diagnostic Reset: Failed: %v\n", err)
-			} else {
-				fmt.Printf("Diagnostic counters reset\n")
-			}
+			err := client.DiagnosticClear(timeout)
+			output(sys, "Diagnostic Reset", "counters reset", err)
 		}
 		if c.Events {
-			if cnt, err := client.CommEventCounter(timeout); err != nil {
-				fmt.Printf("Diagnostic Event Counter: Failed: %v\n", err)
-			} else {
-				fmt.Printf("Diagnostic Event Counter: %v\n", cnt)
-			}
+			cnt, err := client.CommEventCounter(timeout)
+			output(sys, "Diagnostic Event Counter", cnt, err)
 		}
 	}
 	return nil
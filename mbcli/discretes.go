@@ -1,15 +1,18 @@
 package main
 
+import "github.com/rolfl/modbus"
+
 type DiscreteGetCommands struct {
 	Units   []string `short:"u" long:"unit" description:"Unit(s) to contact" required:"true" env:"MBCLI_UNIT" env-delim:","`
 	Timeout int      `short:"t" long:"timeout" default:"5" description:"Timeout (in seconds)"`
-	Args    struct {
+	WatchOptions
+	Args struct {
 		Addresses []string `required:"1"`
 	} `positional-args:"yes" required:"yes"`
 }
 
 func (c *DiscreteGetCommands) Execute(args []string) error {
-	return genericClientReads("discrete", c.Units, c.Args.Addresses, c.Timeout)
+	return genericClientReads(modbus.KindDiscrete, c.Units, c.Args.Addresses, c.Timeout, c.WatchOptions)
 }
 
 type DiscreteCommands struct {
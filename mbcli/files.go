@@ -0,0 +1,75 @@
+package main
+
+import (
+	"time"
+)
+
+type FileGetCommands struct {
+	Units   []string `short:"u" long:"unit" description:"Unit(s) to contact" required:"true" env:"MBCLI_UNIT" env-delim:","`
+	Timeout int      `short:"t" long:"timeout" default:"5" description:"Timeout (in seconds)"`
+	WatchOptions
+	Args struct {
+		Records []string `required:"1"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *FileGetCommands) Execute(args []string) error {
+	err := initializeConnections(c.Units)
+	if err != nil {
+		return err
+	}
+
+	timeout := time.Second * time.Duration(c.Timeout)
+	records, err := fileRanges(c.Args.Records)
+	if err != nil {
+		return err
+	}
+
+	// run the commands, the connections are reused for each read
+	return c.watch(func() error {
+		for _, sys := range c.Units {
+			client, _ := client(sys)
+			for _, rng := range records {
+				got, err := client.ReadFileRecords(rng.file, rng.address, rng.count, timeout)
+				output(sys, "Get File Records", got, err)
+			}
+		}
+		return nil
+	})
+}
+
+type FileSetCommands struct {
+	Units   []string `short:"u" long:"unit" description:"Unit(s) to contact" required:"true" env:"MBCLI_UNIT" env-delim:","`
+	Timeout int      `short:"t" long:"timeout" default:"5" description:"Timeout (in seconds)"`
+	Args    struct {
+		RecordValues []string `required:"1"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *FileSetCommands) Execute(args []string) error {
+	err := initializeConnections(c.Units)
+	if err != nil {
+		return err
+	}
+
+	timeout := time.Second * time.Duration(c.Timeout)
+	records, err := fileRecordValues(c.Args.RecordValues)
+	if err != nil {
+		return err
+	}
+
+	// run the commands
+	for _, sys := range c.Units {
+		client, _ := client(sys)
+		for _, rng := range records {
+			got, err := client.WriteFileRecords(rng.file, rng.address, rng.values, timeout)
+			output(sys, "Set File Records", got, err)
+		}
+	}
+	return nil
+}
+
+type FileCommands struct {
+	Get FileGetCommands `command:"get" alias:"read" description:"Get or read File records as file:record:length"`
+	Set FileSetCommands `command:"set" alias:"write" description:"Set or write File records as file:record:v,v,v"`
+}
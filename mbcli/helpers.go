@@ -2,9 +2,13 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/rolfl/modbus"
 )
 
 type addressedRange struct {
@@ -73,6 +77,95 @@ func addressValues(refs []string, isbool bool) ([]addressedValues, error) {
 	return ret, nil
 }
 
+type fileRange struct {
+	file int
+	addressedRange
+}
+
+// fileRanges parses file:record:length references, the length is optional
+func fileRanges(refs []string) ([]fileRange, error) {
+	ret := []fileRange{}
+	for _, ref := range refs {
+		file, rest, err := splitFile(ref)
+		if err != nil {
+			return nil, err
+		}
+		rngs, err := addressRanges([]string{rest})
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, fileRange{file, rngs[0]})
+	}
+	return ret, nil
+}
+
+type fileValues struct {
+	file int
+	addressedValues
+}
+
+// fileRecordValues parses file:record:v,v,v references
+func fileRecordValues(refs []string) ([]fileValues, error) {
+	ret := []fileValues{}
+	for _, ref := range refs {
+		file, rest, err := splitFile(ref)
+		if err != nil {
+			return nil, err
+		}
+		vals, err := addressValues([]string{rest}, false)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, fileValues{file, vals[0]})
+	}
+	return ret, nil
+}
+
+func splitFile(ref string) (int, string, error) {
+	parts := strings.SplitN(ref, ":", 2)
+	if len(parts) != 2 {
+		return 0, "", fmt.Errorf("expect a file and record like file:record - not: %v", ref)
+	}
+	file, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", err
+	}
+	return file, parts[1], nil
+}
+
+// WatchOptions are the options for the get commands that read the same values repeatedly
+type WatchOptions struct {
+	Watch time.Duration `long:"watch" description:"Read again every interval (e.g. 2s) until interrupted"`
+	Count int           `long:"count" description:"Stop after this many reads (with --watch)"`
+}
+
+// watch calls read once, or with --watch, every interval until it is interrupted, or Count reads are done. The time of
+// each read is included in the output.
+func (w WatchOptions) watch(read func() error) error {
+	if w.Watch <= 0 {
+		return read()
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	defer signal.Stop(stop)
+	ticker := time.NewTicker(w.Watch)
+	defer ticker.Stop()
+	for n := 1; ; n++ {
+		sampled = time.Now()
+		if err := read(); err != nil {
+			return err
+		}
+		if w.Count > 0 && n >= w.Count {
+			return nil
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
 func initializeConnections(units []string) error {
 	for _, sys := range units {
 		_, err := client(sys)
@@ -83,7 +176,14 @@ func initializeConnections(units []string) error {
 	return nil
 }
 
-func genericClientReads(toget string, units []string, addressRefs []string, timeoutSec int) error {
+var readNames = map[modbus.RegisterKind]string{
+	modbus.KindDiscrete: "Get Discretes",
+	modbus.KindCoil:     "Get Coils",
+	modbus.KindInput:    "Get Inputs",
+	modbus.KindHolding:  "Get Holding Registers",
+}
+
+func genericClientReads(kind modbus.RegisterKind, units []string, addressRefs []string, timeoutSec int, watch WatchOptions) error {
 	// initialize the connections
 	err := initializeConnections(units)
 	if err != nil {
@@ -96,35 +196,17 @@ func genericClientReads(toget string, units []string, addressRefs []string, time
 		return err
 	}
 
-	// run the commands
-	for _, sys := range units {
-		client, _ := client(sys)
-		var got interface{}
-		var name string
-
-		for _, rng := range addresses {
-			switch toget {
-			case "discrete":
-				got, err = client.ReadDiscretes(rng.address, rng.count, timeout)
-				name = "Get Discretes"
-			case "coil":
-				got, err = client.ReadCoils(rng.address, rng.count, timeout)
-				name = "Get Coils"
-			case "input":
-				got, err = client.ReadInputs(rng.address, rng.count, timeout)
-				name = "Get Inputs"
-			case "holding":
-				got, err = client.ReadHoldings(rng.address, rng.count, timeout)
-				name = "Get Holding Registers"
-			default:
-				return fmt.Errorf("unknown read type %v", toget)
-			}
-			if err != nil {
-				fmt.Printf("%v: Failed: %v\n", name, err)
-			} else {
-				fmt.Printf("%v: %v\n", name, got)
+	// run the commands, the connections are reused for each read
+	return watch.watch(func() error {
+		for _, sys := range units {
+			client, _ := client(sys)
+			name := readNames[kind]
+
+			for _, rng := range addresses {
+				got, err := client.Read(kind, rng.address, rng.count, timeout)
+				output(sys, name, got, err)
 			}
 		}
-	}
-	return nil
+		return nil
+	})
 }
@@ -1,20 +1,22 @@
 package main
 
 import (
-	"fmt"
 	"time"
+
+	"github.com/rolfl/modbus"
 )
 
 type HoldingGetCommands struct {
 	Units   []string `short:"u" long:"unit" description:"Unit(s) to contact" required:"true" env:"MBCLI_UNIT" env-delim:","`
 	Timeout int      `short:"t" long:"timeout" default:"5" description:"Timeout (in seconds)"`
-	Args    struct {
+	WatchOptions
+	Args struct {
 		Addresses []string `required:"1"`
 	} `positional-args:"yes" required:"yes"`
 }
 
 func (c *HoldingGetCommands) Execute(args []string) error {
-	return genericClientReads("holding", c.Units, c.Args.Addresses, c.Timeout)
+	return genericClientReads(modbus.KindHolding, c.Units, c.Args.Addresses, c.Timeout, c.WatchOptions)
 }
 
 type HoldingSetCommands struct {
@@ -40,15 +42,11 @@ func (c *HoldingSetCommands) Execute(args []string) error {
 		for _, rng := range addresses {
 			_, err := client.WriteMultipleHoldings(rng.address, rng.values, timeout)
 			if err != nil {
-				fmt.Printf("Write Holdings: Failed: %v\n", err)
+				output(sys, "Write Holdings", nil, err)
 				continue
 			}
 			got, err := client.ReadHoldings(rng.address, len(rng.values), timeout)
-			if err != nil {
-				fmt.Printf("Write Holdings verify: Failed: %v\n", err)
-			} else {
-				fmt.Printf("Write Holdings verify: %v\n", got)
-			}
+			output(sys, "Write Holdings verify", got, err)
 		}
 	}
 	return nil
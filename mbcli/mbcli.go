@@ -9,17 +9,21 @@ import (
 
 type CLICommand struct {
 	Verbose    bool               `long:"verbose" description:"Print API requests and responses"`
+	Format     string             `long:"format" default:"text" choice:"text" choice:"json" choice:"csv" description:"Output format"`
 	Diagnostic DiagnosticCommands `command:"diag" alias:"diagnostics" description:"Diagnostic functions"`
 	Discrete   DiscreteCommands   `command:"discrete" alias:"discretes" description:"Discrete functions"`
 	Coil       CoilCommands       `command:"coil" alias:"coils" description:"Coil functions"`
 	Input      InputCommands      `command:"input" alias:"inputs" description:"Input functions"`
 	Holding    HoldingCommands    `command:"holding" alias:"holdings" description:"Holding functions"`
+	File       FileCommands       `command:"file" alias:"files" description:"File record functions"`
+	Serve      ServeCommands      `command:"serve" alias:"server" description:"Run as a Modbus server (simulator)"`
 }
 
-func main() {
-	clicmd := CLICommand{}
+// options are the global options, set when the command line is parsed
+var options CLICommand
 
-	parser := flags.NewParser(&clicmd, flags.HelpFlag|flags.PassDoubleDash)
+func main() {
+	parser := flags.NewParser(&options, flags.HelpFlag|flags.PassDoubleDash)
 
 	_, err := parser.Parse()
 
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rolfl/modbus"
+)
+
+// sampled is the time of the current read in watch mode, it is zero otherwise
+var sampled time.Time
+
+// timestamp formats the sampled time, or returns "" if not watching
+func timestamp() string {
+	if sampled.IsZero() {
+		return ""
+	}
+	return sampled.Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+// output prints the result of an operation on a unit in the format selected with --format. In watch mode each
+// result includes the time it was read.
+func output(unit string, name string, got interface{}, err error) {
+	switch options.Format {
+	case "json":
+		outputJSON(unit, name, got, err)
+	case "csv":
+		outputCSV(unit, name, got, err)
+	default:
+		if ts := timestamp(); ts != "" {
+			name = ts + " " + name
+		}
+		if err != nil {
+			fmt.Printf("%v: Failed: %v\n", name, err)
+		} else {
+			fmt.Printf("%v: %v\n", name, got)
+		}
+	}
+}
+
+type jsonResult struct {
+	Time      string      `json:"time,omitempty"`
+	Unit      string      `json:"unit"`
+	Operation string      `json:"operation"`
+	Result    interface{} `json:"result,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// outputJSON prints one JSON object on each line
+func outputJSON(unit string, name string, got interface{}, err error) {
+	res := jsonResult{Time: timestamp(), Unit: unit, Operation: name, Result: got}
+	if err != nil {
+		res.Result = nil
+		res.Error = err.Error()
+	}
+	data, err := json.Marshal(res)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: Failed: %v\n", name, err)
+		return
+	}
+	fmt.Println(string(data))
+}
+
+// outputCSV prints unit,address,value rows for the values that were read, and unit,operation,result rows for other
+// results. In watch mode the rows start with the time. Failures are printed to stderr.
+func outputCSV(unit string, name string, got interface{}, err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: %v: Failed: %v\n", unit, name, err)
+		return
+	}
+	w := &timedCSV{csv.NewWriter(os.Stdout), timestamp()}
+	defer w.Flush()
+	bits := func(address int, values []bool) {
+		for i, v := range values {
+			val := "0"
+			if v {
+				val = "1"
+			}
+			w.Write([]string{unit, strconv.Itoa(address + i), val})
+		}
+	}
+	words := func(address int, values []int) {
+		for i, v := range values {
+			w.Write([]string{unit, strconv.Itoa(address + i), strconv.Itoa(v)})
+		}
+	}
+	switch r := got.(type) {
+	case *modbus.X01xReadCoils:
+		bits(r.Address, r.Coils)
+	case *modbus.X02xReadDiscretes:
+		bits(r.Address, r.Discretes)
+	case *modbus.X03xReadHolding:
+		words(r.Address, r.Values)
+	case *modbus.X04xReadInputs:
+		words(r.Address, r.Values)
+	case *modbus.X14xReadFileRecordResult:
+		// the address of a record is file:record
+		for i, v := range r.Values {
+			w.Write([]string{unit, fmt.Sprintf("%v:%v", r.File, r.Record+i), strconv.Itoa(v)})
+		}
+	default:
+		w.Write([]string{unit, name, fmt.Sprint(got)})
+	}
+}
+
+// timedCSV adds the time to the start of each row, if there is one
+type timedCSV struct {
+	*csv.Writer
+	ts string
+}
+
+func (w *timedCSV) Write(record []string) error {
+	if w.ts != "" {
+		record = append([]string{w.ts}, record...)
+	}
+	return w.Writer.Write(record)
+}
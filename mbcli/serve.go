@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/rolfl/modbus"
+)
+
+type ServeCommands struct {
+	ServerID  string   `long:"id" default:"mbcli" description:"The ServerID of the server"`
+	Discretes int      `long:"discretes" default:"100" description:"Number of discretes to serve"`
+	Coils     int      `long:"coils" default:"100" description:"Number of coils to serve"`
+	Inputs    int      `long:"inputs" default:"100" description:"Number of inputs to serve"`
+	Holdings  int      `long:"holdings" default:"100" description:"Number of holding registers to serve"`
+	Files     int      `long:"files" default:"4" description:"Number of files to serve"`
+	Discrete  []string `long:"discrete" description:"Initial discrete values as address:v,v,v"`
+	Coil      []string `long:"coil" description:"Initial coil values as address:v,v,v"`
+	Input     []string `long:"input" description:"Initial input values as address:v,v,v"`
+	Holding   []string `long:"holding" description:"Initial holding register values as address:v,v,v"`
+	Args      struct {
+		Access string `description:"tcp:host:port or rtu:device:baud:parity:stop:(minFrame:)(dtr:)unit"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *ServeCommands) Execute(args []string) error {
+	server, err := c.server()
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+
+	parts := strings.Split(c.Args.Access, ":")
+	switch parts[0] {
+	case "tcp":
+		if len(parts) != 3 {
+			return fmt.Errorf("expect exactly 3 parts for TCP server access tcp:host:port - not: %v", c.Args.Access)
+		}
+		host := strings.Join(parts[1:], ":")
+		tcpserv, err := modbus.NewTCPServer(host, modbus.ServeAllUnits(server))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Serving all units on TCP %v\n", host)
+		go func() {
+			<-stop
+			tcpserv.Close()
+		}()
+		tcpserv.WaitClosed()
+	case "rtu":
+		mb, unit, err := rtuBus(c.Args.Access, parts)
+		if err != nil {
+			return err
+		}
+		mb.SetServer(unit, server)
+		fmt.Printf("Serving unit %v on RTU %v\n", unit, parts[1])
+		<-stop
+		mb.Close()
+	default:
+		return fmt.Errorf("unknown modbus connection type %v (expect tcp or rtu)", parts[0])
+	}
+	return nil
+}
+
+// server creates the server with the memory model and initial values from the flags. Remote clients can write all
+// the coils, holding registers, and files.
+func (c *ServeCommands) server() (modbus.Server, error) {
+	server, err := modbus.NewServer([]byte(c.ServerID), []string{"mbcli", "Simulator", "1.0"})
+	if err != nil {
+		return nil, err
+	}
+	server.RegisterDiscretes(c.Discretes)
+	server.RegisterCoils(c.Coils, func(server modbus.Server, atomic modbus.Atomic, address int, values []bool, current []bool) ([]bool, error) {
+		return values, nil
+	})
+	server.RegisterInputs(c.Inputs)
+	server.RegisterHoldings(c.Holdings, func(server modbus.Server, atomic modbus.Atomic, address int, values []int, current []int) ([]int, error) {
+		return values, nil
+	})
+	server.RegisterFiles(c.Files, func(server modbus.Server, atomic modbus.Atomic, file int, address int, values []int, current []int) ([]int, error) {
+		return values, nil
+	})
+
+	discretes, err := addressValues(c.Discrete, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range discretes {
+		if err := server.WriteDiscretesAtomic(v.address, toBools(v.values)); err != nil {
+			return nil, err
+		}
+	}
+	coils, err := addressValues(c.Coil, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range coils {
+		if err := server.WriteCoilsAtomic(v.address, toBools(v.values)); err != nil {
+			return nil, err
+		}
+	}
+	inputs, err := addressValues(c.Input, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range inputs {
+		if err := server.WriteInputsAtomic(v.address, v.values); err != nil {
+			return nil, err
+		}
+	}
+	holdings, err := addressValues(c.Holding, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range holdings {
+		if err := server.WriteHoldingsAtomic(v.address, v.values); err != nil {
+			return nil, err
+		}
+	}
+	return server, nil
+}
+
+func toBools(values []int) []bool {
+	flags := make([]bool, len(values))
+	for i, v := range values {
+		flags[i] = v == 1
+	}
+	return flags
+}
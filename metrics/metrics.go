@@ -0,0 +1,81 @@
+/*
+Package metrics exports the diagnostic counters of a Modbus instance, and optionally a Server, as Prometheus metrics.
+
+The counters are read from the Modbus.Diagnostics() and Server.Diagnostics() functions each time Prometheus collects
+the metrics:
+
+	mb, _ := modbus.NewTCP("host.example.com:502")
+	prometheus.MustRegister(metrics.NewCollector("plc1", mb, nil))
+
+The name is set as the "bus" label on all the metrics so that more than one Modbus instance can be registered.
+*/
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rolfl/modbus"
+)
+
+var (
+	busLabels = []string{"bus"}
+
+	busMessages   = prometheus.NewDesc("modbus_bus_messages_total", "Valid messages received on the Modbus.", busLabels, nil)
+	busCommErrors = prometheus.NewDesc("modbus_bus_comm_errors_total", "Failed receptions (invalid CRC, etc) on the Modbus.", busLabels, nil)
+	busExceptions = prometheus.NewDesc("modbus_bus_exceptions_total", "Exception responses sent to clients on the Modbus.", busLabels, nil)
+	busOverruns   = prometheus.NewDesc("modbus_bus_overruns_total", "Incoming frames larger than the maximum Modbus size.", busLabels, nil)
+
+	serverMessages   = prometheus.NewDesc("modbus_server_messages_total", "Messages addressed to the server.", busLabels, nil)
+	serverNoResponse = prometheus.NewDesc("modbus_server_no_response_total", "Messages the server did not respond to.", busLabels, nil)
+	serverNAKs       = prometheus.NewDesc("modbus_server_naks_total", "Negative acknowledge exceptions sent by the server.", busLabels, nil)
+	serverBusy       = prometheus.NewDesc("modbus_server_busy_total", "Server busy exceptions sent by the server.", busLabels, nil)
+	serverEvents     = prometheus.NewDesc("modbus_server_events_total", "Successful regular operations handled by the server.", busLabels, nil)
+)
+
+// Collector is a prometheus.Collector for the diagnostic counters of a Modbus instance and, optionally, a Server.
+type Collector struct {
+	name   string
+	bus    modbus.Modbus
+	server modbus.Server
+}
+
+// NewCollector creates a Collector for the Modbus instance. The name is used as the "bus" label value. The server may
+// be nil, in which case only the Modbus counters are exported.
+func NewCollector(name string, bus modbus.Modbus, server modbus.Server) *Collector {
+	return &Collector{name, bus, server}
+}
+
+// Describe sends the descriptions of the metrics to the channel
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- busMessages
+	ch <- busCommErrors
+	ch <- busExceptions
+	ch <- busOverruns
+	if c.server != nil {
+		ch <- serverMessages
+		ch <- serverNoResponse
+		ch <- serverNAKs
+		ch <- serverBusy
+		ch <- serverEvents
+	}
+}
+
+// Collect reads the current diagnostic counters and sends them to the channel
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	bd := c.bus.Diagnostics()
+	c.counter(ch, busMessages, bd.Messages)
+	c.counter(ch, busCommErrors, bd.CommErrors)
+	c.counter(ch, busExceptions, bd.Exceptions)
+	c.counter(ch, busOverruns, bd.Overruns)
+	if c.server != nil {
+		sd := c.server.Diagnostics()
+		c.counter(ch, serverMessages, sd.Messages)
+		c.counter(ch, serverNoResponse, sd.NoResponse)
+		c.counter(ch, serverNAKs, sd.ServerNAKs)
+		c.counter(ch, serverBusy, sd.ServerBusy)
+		c.counter(ch, serverEvents, sd.EventCounter)
+	}
+}
+
+func (c *Collector) counter(ch chan<- prometheus.Metric, desc *prometheus.Desc, value int) {
+	ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(value), c.name)
+}
@@ -57,6 +57,8 @@ package modbus
 import (
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 )
 
 type rtuFrame []byte
@@ -77,6 +79,58 @@ type adu struct {
 
 type busErrorFunc func() int
 
+// RequestObserver is called when a client request completes. See Modbus.SetRequestObserver
+type RequestObserver func(unit int, function int, dur time.Duration, err error)
+
+// UnhandledFrameHandler is called with the frames received for units that nothing is waiting for: responses that arrive
+// after the client request timed out, or requests for units that have no server. The data is the function's payload
+// bytes. See Modbus.SetUnhandledFrameHandler
+type UnhandledFrameHandler func(unit int, function int, data []int)
+
+// transport is implemented by each of the wire protocols (RTU, TCP) that a Modbus instance communicates over
+type transport interface {
+	close() error
+	setWireLogger(logger WireLogger)
+	setLogger(logger Logger)
+	setMaxPDUSize(size int)
+	maxPDUSize() int
+}
+
+const (
+	// DefaultMaxPDUSize is the largest PDU (function code and data) allowed by the Modbus specification. See
+	// Modbus.SetMaxPDUSize
+	DefaultMaxPDUSize = 253
+	// minPDUSize is the smallest PDU size that still fits the fixed-size requests and responses
+	minPDUSize = 16
+	// maxPDUSizeLimit is the largest PDU size that can be set, which sizes the read buffers of the framers
+	maxPDUSizeLimit = 1024
+	// rtuOverhead is the unit ID and CRC that an RTU frame adds to the PDU
+	rtuOverhead = 3
+	// mbapOverhead is the MBAP header that a Modbus/TCP frame adds to the PDU (the unit ID is part of the header)
+	mbapOverhead = 7
+)
+
+// pduLimit is embedded in each transport to hold the largest PDU that the framer accepts.
+type pduLimit struct {
+	lock sync.Mutex
+	size int
+}
+
+func (p *pduLimit) setMaxPDUSize(size int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.size = size
+}
+
+func (p *pduLimit) maxPDUSize() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.size == 0 {
+		return DefaultMaxPDUSize
+	}
+	return p.size
+}
+
 /*
 Modbus is a half duplex (or possibly full duplex) mechanism for talking to remote units.
 
@@ -87,18 +141,73 @@ The Modbus instance can be used to get clients, add servers, or close the commun
 you can get the current diagnostic state of the channel.
 */
 type Modbus interface {
-	//GetClient creates a control instance for communicating with a specific server on the remote side of the Modbus
+	//GetClient creates a control instance for communicating with a specific server on the remote side of the Modbus.
+	// On a serial bus, a client for unitID 0 broadcasts to all units: requests complete once they are sent (see
+	// SetBroadcastDelay) and there is no response, so only write functions are useful. On Modbus/TCP, unitID 0 is
+	// not a broadcast, and the remote device is expected to respond. See SetUnitZeroBroadcast
+	// Frames on a serial bus (and RTU over TCP) have no transaction id, so the requests for a unit are sent one at a
+	// time, each after the response to the one before. Requests for different units can still wait at the same time.
 	GetClient(unitID int) Client
-	// SetServer establishes a server instance on the given unitId
+	// SetServer establishes a server instance on the given unitId. A server set on unitId 0xFF is a wildcard that
+	// handles the requests for all the units that do not have their own server.
 	SetServer(unitID int, server Server)
 	// Close closes the communication channel under the Modbus protocol
 	Close() error
+	// CloseGracefully stops clients from sending new requests, and servers from handling new requests (they are dropped
+	// without a response). It waits for the requests that were already sent to get a response (or time out), and for
+	// servers to finish handling their requests, then closes the communication channel. If that takes longer than the
+	// timeout, the channel is closed anyway, and an error is returned.
+	CloseGracefully(timeout time.Duration) error
 	// Diagnostics returns the current diagnostic counters for the Modbus channel
 	Diagnostics() BusDiagnostics
-
-	getEventLog() []int
+	// SimulateCRCErrors is a test option that corrupts the CRC of the given fraction (0.0 to 1.0) of the responses that
+	// servers send on an RTU bus, so that the error handling of remote clients can be exercised. Set it to 0 to stop
+	// corrupting responses. An error is returned if the Modbus is not an RTU bus.
+	SimulateCRCErrors(fraction float64) error
+	// RTUTiming returns the effective end-of-frame pause (t1.5) and bus idle (t3.5) times that an RTU bus uses. Both
+	// values are 0 if the Modbus is not an RTU bus.
+	RTUTiming() (pause time.Duration, idle time.Duration)
+	// SetBroadcastDelay sets how long a request to the broadcast unit 0 waits, after it is sent, before it completes.
+	// Remote units do not respond to broadcasts, so the delay gives them time to process the request before the next
+	// one is sent. The Modbus serial specification recommends 100 to 200ms for serial buses. The default is 0.
+	SetBroadcastDelay(delay time.Duration)
+	// SetUnitZeroBroadcast controls whether unit 0 is a broadcast. A broadcast request is handled by the servers, but they
+	// do not respond, and a client request to unit 0 completes when it is sent. When unit 0 is not a broadcast, requests
+	// to it are handled like those for any other unit: the server for unit 0 (or the wildcard server for 0xFF) responds,
+	// and clients wait for the response. By default unit 0 is a broadcast on the serial buses (and RTU over TCP), and
+	// not on Modbus/TCP, UDP, and the loopback, where some clients send requests to unit 0 and expect a response.
+	SetUnitZeroBroadcast(broadcast bool)
+	// SetWireLogger sets a function that is called with every frame read from, or written to the wire. The logger is
+	// called on a separate go-routine, and if it does not keep up, frames are dropped. A nil logger stops logging.
+	SetWireLogger(logger WireLogger)
+	// SetRequestObserver sets a function that is called when each client request completes, with the remote unit, the
+	// function code, the time from when the request was sent until the response was received (or the request failed),
+	// and the error if the request failed. A nil observer stops the calls.
+	SetRequestObserver(observer RequestObserver)
+	// SetUnhandledFrameHandler sets a function that is called with each frame received for a unit that no client is
+	// waiting for, and that no server handles, so that the application can capture, count, or log them. The handler is
+	// called on the go-routine that reads the Modbus, so it should not block. A nil handler ignores the frames.
+	SetUnhandledFrameHandler(handler UnhandledFrameHandler)
+	// SetLogger sets the Logger that the diagnostic messages from the Modbus, and the communication channel under it,
+	// are sent to. By default nothing is logged. A nil logger stops logging.
+	SetLogger(logger Logger)
+	// EventLog returns the events recorded on the Modbus channel, most recent first, in the format of the Comm Event
+	// Log (function 0x0C): a receive event for each frame received, a send event for each frame sent, and the
+	// communication restart (0x00) and entered listen only mode (0x04) events. At most 64 events are kept.
+	EventLog() []int
+	// SetMaxPDUSize sets the largest PDU (the function code and its data, without the unit ID, header, or checksum)
+	// that is sent or received on the Modbus. Larger frames are discarded as overruns, client requests are split
+	// into smaller ones to fit, and requests that can not be split fail. The default is DefaultMaxPDUSize (253), which
+	// is the Modbus specification limit, but some gateways support extended frames, and some constrained devices need
+	// smaller ones. The size must be from 16 to 1024.
+	SetMaxPDUSize(size int) error
+	// MaxPDUSize returns the largest PDU that is sent or received on the Modbus. See SetMaxPDUSize
+	MaxPDUSize() int
+
+	logEvent(event int)
 	clearDiagnostics()
 	clearOverrunCounter()
+	broadcast(unit byte) bool
 }
 
 type modbus struct {
@@ -106,32 +215,180 @@ type modbus struct {
 	rx      chan adu
 	clients map[byte]*client
 	servers map[byte]Server
-	pending map[uint16]bool
-	closer  func() error
+	// clients and servers are read by the demuxRX go-routine while they may be added
+	mlock   sync.RWMutex
+	pending map[uint16]waiter
+	plock   sync.Mutex
+	trans   transport
 	txid    uint16
 	diag    *busDiagnosticManager
+	bdelay  time.Duration
+	obs     RequestObserver
+	orphan  UnhandledFrameHandler
+	log     logSink
+	closing bool
+	// active counts the server requests being handled
+	active sync.WaitGroup
+	// whether unit 0 is a broadcast, read with the mlock
+	zeroBroadcast bool
+}
+
+// waiter is a client request that is waiting for the response with its transaction id
+type waiter struct {
+	unit byte
+	rx   chan reply
 }
 
-func newModbus(tx chan adu, rx chan adu, closer func() error, diag *busDiagnosticManager) Modbus {
-	mytx := make(chan adu, 0)
-	m := &modbus{mytx, rx, make(map[byte]*client), make(map[byte]Server), make(map[uint16]bool), closer, 0, diag}
+// reply is what a client receives in response to a request, either a response pdu, or an error if the request failed
+// before a response was received.
+type reply struct {
+	pdu pdu
+	err error
+}
+
+func newModbus(tx chan adu, rx chan adu, trans transport, diag *busDiagnosticManager) *modbus {
+	m := &modbus{tx: tx, rx: rx, clients: make(map[byte]*client), servers: make(map[byte]Server), pending: make(map[uint16]waiter), trans: trans, diag: diag}
+	m.zeroBroadcast = broadcastTransport(trans)
 	go m.demuxRX()
-	go m.associate(tx)
 	return m
 }
 
 func (m *modbus) Close() error {
-	return m.closer()
+	return m.trans.close()
+}
+
+func (m *modbus) CloseGracefully(timeout time.Duration) error {
+	m.plock.Lock()
+	m.closing = true
+	m.plock.Unlock()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	handled := make(chan bool)
+	go func() {
+		m.active.Wait()
+		close(handled)
+	}()
+	poll := time.NewTicker(10 * time.Millisecond)
+	defer poll.Stop()
+	var err error
+	for err == nil && (m.countPending() > 0 || handled != nil) {
+		select {
+		case <-deadline.C:
+			err = fmt.Errorf("Timeout closing gracefully after %v with %v requests waiting for a response", timeout, m.countPending())
+		case <-handled:
+			handled = nil
+		case <-poll.C:
+		}
+	}
+	cerr := m.trans.close()
+	if err != nil {
+		return err
+	}
+	return cerr
+}
+
+func (m *modbus) countPending() int {
+	m.plock.Lock()
+	defer m.plock.Unlock()
+	return len(m.pending)
 }
 
 func (m *modbus) Diagnostics() BusDiagnostics {
 	return m.diag.getDiagnostics()
 }
 
-func (m *modbus) getEventLog() []int {
+func (m *modbus) SimulateCRCErrors(fraction float64) error {
+	rtu, ok := m.trans.(*rtu)
+	if !ok {
+		return fmt.Errorf("CRC errors can only be simulated on an RTU bus")
+	}
+	return rtu.simulateCRCErrors(fraction)
+}
+
+func (m *modbus) RTUTiming() (time.Duration, time.Duration) {
+	rtu, ok := m.trans.(*rtu)
+	if !ok {
+		return 0, 0
+	}
+	return rtu.pause, rtu.idle
+}
+
+func (m *modbus) SetMaxPDUSize(size int) error {
+	if size < minPDUSize || size > maxPDUSizeLimit {
+		return fmt.Errorf("Illegal maximum PDU size %v, must be from %v to %v", size, minPDUSize, maxPDUSizeLimit)
+	}
+	m.trans.setMaxPDUSize(size)
+	return nil
+}
+
+func (m *modbus) MaxPDUSize() int {
+	return m.trans.maxPDUSize()
+}
+
+func (m *modbus) SetBroadcastDelay(delay time.Duration) {
+	m.plock.Lock()
+	defer m.plock.Unlock()
+	m.bdelay = delay
+}
+
+func (m *modbus) SetWireLogger(logger WireLogger) {
+	m.trans.setWireLogger(logger)
+}
+
+func (m *modbus) SetLogger(logger Logger) {
+	m.log.set(logger)
+	m.trans.setLogger(logger)
+}
+
+func (m *modbus) SetRequestObserver(observer RequestObserver) {
+	m.plock.Lock()
+	defer m.plock.Unlock()
+	m.obs = observer
+}
+
+func (m *modbus) SetUnhandledFrameHandler(handler UnhandledFrameHandler) {
+	m.plock.Lock()
+	defer m.plock.Unlock()
+	m.orphan = handler
+}
+
+func (m *modbus) unhandled(a adu) {
+	m.plock.Lock()
+	orphan := m.orphan
+	m.plock.Unlock()
+	if orphan != nil {
+		orphan(int(a.unit), int(a.pdu.function), bytesToInt(a.pdu.data))
+	} else if m.hasClient(a.unit) {
+		m.log.Debugf("Received packet for %v but that client is not expecting a response.", a.unit)
+	} else {
+		m.log.Debugf("Received packet for %v but there is nothing serving that address.", a.unit)
+	}
+}
+
+func (m *modbus) observe(unit byte, function byte, dur time.Duration, err error) {
+	m.plock.Lock()
+	obs := m.obs
+	m.plock.Unlock()
+	if obs != nil {
+		obs(int(unit), int(function), dur, err)
+	}
+}
+
+func (m *modbus) broadcastDelay() time.Duration {
+	m.plock.Lock()
+	defer m.plock.Unlock()
+	return m.bdelay
+}
+
+func (m *modbus) EventLog() []int {
 	return m.diag.getEventLog()
 }
 
+func (m *modbus) logEvent(event int) {
+	m.diag.logEvent(event)
+}
+
 func (m *modbus) clearDiagnostics() {
 	m.diag.clear()
 }
@@ -143,62 +400,180 @@ func (m *modbus) clearOverrunCounter() {
 // GetClient estabishes a client that talks to a remote unit.
 func (m *modbus) GetClient(unitID int) Client {
 	unit := bytePanic(unitID)
+	m.mlock.Lock()
+	defer m.mlock.Unlock()
 	c := m.clients[unit]
 	if c != nil {
 		return c
 	}
 	// make a new one.
-	c = &client{unit, m, make(chan pdu, 5)}
+	c = &client{unit: unit, trans: m, limits: DefaultLimits, timeout: DefaultTimeout}
+	if serialTransport(m.trans) {
+		c.turn = make(chan bool, 1)
+	}
 	m.clients[unit] = c
 	return c
 }
 
 // SetServer sets a handler for when remote units talk to us.
 func (m *modbus) SetServer(unit int, server Server) {
+	m.mlock.Lock()
+	defer m.mlock.Unlock()
 	m.servers[bytePanic(unit)] = server
 }
 
-func (m *modbus) associate(to chan adu) {
-	for a := range m.tx {
-		if a.request {
-			m.pending[a.txid] = true
+// broadcastTransport is true for the transports on which unit 0 is a broadcast to all units by default: the serial
+// buses, and RTU frames over TCP that a gateway puts on a serial bus. On Modbus/TCP (and UDP, and the loopback) unit 0
+// is used to address the remote device directly (see the README).
+func broadcastTransport(trans transport) bool {
+	return serialTransport(trans)
+}
+
+// serialTransport is true for the transports whose frames have no transaction id: the serial buses, and RTU frames over
+// TCP. A response is matched to the request by its unit, so each unit has only one request at a time.
+func serialTransport(trans transport) bool {
+	switch trans.(type) {
+	case *tcp, *udp, *loopback:
+		return false
+	}
+	return true
+}
+
+// broadcast identifies requests that are broadcast to all units, see SetUnitZeroBroadcast
+func (m *modbus) broadcast(unit byte) bool {
+	if unit != 0 {
+		return false
+	}
+	m.mlock.RLock()
+	defer m.mlock.RUnlock()
+	return m.zeroBroadcast
+}
+
+func (m *modbus) SetUnitZeroBroadcast(broadcast bool) {
+	m.mlock.Lock()
+	defer m.mlock.Unlock()
+	m.zeroBroadcast = broadcast
+}
+
+// register allocates a unique transaction id for a request to the unit, and the response with that transaction id
+// will be sent to rx. Broadcasts get no response, so they are not registered.
+func (m *modbus) register(unit byte, rx chan reply) (uint16, error) {
+	m.plock.Lock()
+	defer m.plock.Unlock()
+	if m.closing {
+		return 0, fmt.Errorf("Unable to send a request to unit %v: the Modbus is closing", unit)
+	}
+	for {
+		m.txid++
+		if _, inuse := m.pending[m.txid]; m.txid != 0 && !inuse {
+			break
 		}
-		to <- a
 	}
+	if !m.broadcast(unit) {
+		m.pending[m.txid] = waiter{unit, rx}
+	}
+	return m.txid, nil
+}
+
+// release stops waiting for the response to a request, so that a late response is not delivered.
+func (m *modbus) release(txid uint16) {
+	m.plock.Lock()
+	defer m.plock.Unlock()
+	delete(m.pending, txid)
+}
+
+// waiting returns the client request waiting for the response, if there is one.
+func (m *modbus) waiting(a adu) (waiter, bool) {
+	if a.request {
+		// only the loopback knows that a frame is a request, and not a response
+		return waiter{}, false
+	}
+	m.plock.Lock()
+	defer m.plock.Unlock()
+	w, ok := m.pending[a.txid]
+	if !ok || w.unit != a.unit {
+		return waiter{}, false
+	}
+	delete(m.pending, a.txid)
+	return w, true
 }
 
 func (m *modbus) demuxRX() {
 	for adu := range m.rx {
-		if m.pending[adu.txid] {
-			delete(m.pending, adu.txid)
-			m.clients[adu.unit].rx <- adu.pdu
-		} else if m.servers[adu.unit] != nil || m.servers[0xff] != nil {
-			go m.handleServer(adu)
-		} else if m.clients[adu.unit] != nil {
-			fmt.Printf("Received packet for %v but that client is not expecting a response.\n", adu.unit)
+		if w, ok := m.waiting(adu); ok {
+			// the rx channel has room for the one response it waits for
+			w.rx <- reply{adu.pdu, nil}
+		} else if server := m.serverFor(adu.unit); server != nil {
+			if m.serving() {
+				go m.handleServer(server, adu)
+			} else {
+				m.log.Debugf("Dropping request for unit 0x%02x function 0x%02x: the Modbus is closing", adu.unit, adu.pdu.function)
+			}
 		} else {
-			fmt.Printf("Received packet for %v but there is nothing serving that address.\n", adu.unit)
+			m.unhandled(adu)
 		}
 	}
 }
 
-func (m *modbus) handleServer(req adu) {
-	server := m.servers[req.unit]
-	if server == nil {
-		server = m.servers[0xff]
+// serving counts a server request as active, unless the Modbus is closing. The check and the count are made under the
+// same lock that CloseGracefully sets closing with, so no request is counted once it waits for the active requests.
+func (m *modbus) serving() bool {
+	m.plock.Lock()
+	defer m.plock.Unlock()
+	if m.closing {
+		return false
 	}
+	m.active.Add(1)
+	return true
+}
+
+// failPending is called by a transport when the requests that have been sent can no longer get a response, for example
+// when a connection is reset. The clients waiting on the requests receive the error instead of waiting for a timeout.
+func (m *modbus) failPending(err error) {
+	m.plock.Lock()
+	defer m.plock.Unlock()
+	for txid, w := range m.pending {
+		delete(m.pending, txid)
+		w.rx <- reply{err: err}
+	}
+}
+
+func (m *modbus) hasClient(unit byte) bool {
+	m.mlock.RLock()
+	defer m.mlock.RUnlock()
+	return m.clients[unit] != nil
+}
+
+// serverFor returns the server for the unit. The most specific server wins: a server set for the unit, and if there is
+// none, the wildcard server set for 0xFF.
+func (m *modbus) serverFor(unit byte) Server {
+	m.mlock.RLock()
+	defer m.mlock.RUnlock()
+	if server := m.servers[unit]; server != nil {
+		return server
+	}
+	return m.servers[0xff]
+}
+
+func (m *modbus) handleServer(server Server, req adu) {
+	defer m.active.Done()
 	data, err := server.request(m, req.unit, req.pdu.function, req.pdu.data)
-	if err != nil {
+	if max := m.MaxPDUSize(); err == nil && len(data)+1 > max {
+		err = ServerFailureErrorF("Response of %v bytes exceeds the maximum PDU size of %v bytes", len(data)+1, max)
+	}
+	if errors.Is(err, errNoResponse) {
+		m.log.Debugf("Handled unit 0x%02x function 0x%02x without a response", req.unit, req.pdu.function)
+	} else if err != nil {
 		var mError *Error
 		if !errors.As(err, &mError) {
 			mError = ServerFailureErrorF("%v", err)
 		}
-		fmt.Printf("Request failed unit 0x%02x function 0x%02x: %v\n", req.unit, req.pdu.function, mError)
+		m.log.Debugf("Request failed unit 0x%02x function 0x%02x: %v", req.unit, req.pdu.function, mError)
 		p := mError.asPDU(req.pdu.function)
 		rep := adu{false, req.txid, req.unit, p}
 		m.tx <- rep
 	} else {
-		fmt.Printf("Handled unit 0x%02x function 0x%02x\n", req.unit, req.pdu.function)
+		m.log.Debugf("Handled unit 0x%02x function 0x%02x", req.unit, req.pdu.function)
 		p := pdu{req.pdu.function, data}
 		rep := adu{false, req.txid, req.unit, p}
 		m.tx <- rep
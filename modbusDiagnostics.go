@@ -36,6 +36,9 @@ const (
 	busNAKException   = 1 << 3
 	busWriteTimeout   = 1 << 4
 	busOutgoing       = 1 << 6
+	// busCommRestart and busEnteredListenOnly are complete events, not bits
+	busCommRestart       = 0x00
+	busEnteredListenOnly = 0x04
 )
 
 func newBusDiagnosticManager() *busDiagnosticManager {
@@ -0,0 +1,167 @@
+package modbus
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCloseGracefullyDropsNewRequests(t *testing.T) {
+	clientSide, serverSide := NewLoopback()
+	server, _ := NewServer([]byte{1}, []string{"a", "b", "c"})
+	server.SetResponseDelay(50*time.Millisecond, 50*time.Millisecond)
+	serverSide.SetServer(1, server)
+	client := clientSide.GetClient(1)
+
+	// keep requests arriving at the server while it closes
+	stop := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				client.ReadExceptionStatus(20 * time.Millisecond)
+			}
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := serverSide.CloseGracefully(time.Second); err != nil {
+		t.Fatalf("Expected the server side to close gracefully: %v", err)
+	}
+	close(stop)
+	<-done
+}
+
+func TestServerRouting(t *testing.T) {
+	clientSide, serverSide := NewLoopback()
+	defer clientSide.Close()
+	// each server reports its own ID, so the responses show which server handled the request
+	for _, unit := range []int{1, 2, 0xff} {
+		server, _ := NewServer([]byte{byte(unit)}, []string{"a", "b", "c"})
+		serverSide.SetServer(unit, server)
+	}
+	expect := map[int]byte{1: 1, 2: 2, 3: 0xff, 0: 0xff, 0xff: 0xff}
+	for unit, id := range expect {
+		got, err := clientSide.GetClient(unit).ServerID(time.Second)
+		if err != nil {
+			t.Fatalf("Unit %v failed: %v", unit, err)
+		}
+		if len(got.ServerID) != 1 || got.ServerID[0] != id {
+			t.Fatalf("Expected unit %v to be handled by server 0x%02x, not %v", unit, id, got.ServerID)
+		}
+	}
+}
+
+func TestClientsAndServersWhileReceiving(t *testing.T) {
+	clientSide, serverSide := NewLoopback()
+	defer clientSide.Close()
+	server, _ := NewServer([]byte{1}, []string{"a", "b", "c"})
+	serverSide.SetServer(1, server)
+
+	// frames keep arriving while clients and servers are added, run with -race
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		client := clientSide.GetClient(1)
+		for i := 0; i < 50; i++ {
+			client.ReadExceptionStatus(time.Second)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		clientSide.GetClient(2 + i)
+		other, _ := NewServer([]byte{2}, []string{"a", "b", "c"})
+		serverSide.SetServer(2+i, other)
+	}
+	<-done
+}
+
+func TestEventLogMarkers(t *testing.T) {
+	clientSide, serverSide := NewLoopback()
+	defer clientSide.Close()
+	server, _ := NewServer([]byte{1}, []string{"a", "b", "c"})
+	serverSide.SetServer(1, server)
+	client := clientSide.GetClient(1)
+
+	if err := client.RestartComm(false, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ReadExceptionStatus(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	server.InjectException(0x07, 2, 1)
+	if _, err := client.ReadExceptionStatus(time.Second); exceptionCode(err) != 2 {
+		t.Fatalf("Expected an Illegal Data Address exception, not %v", err)
+	}
+
+	// most recent first, and the restart clears the events before it
+	expect := []int{
+		busOutgoing | busReadException, busIncoming,
+		busOutgoing, busIncoming,
+		busOutgoing, busCommRestart,
+	}
+	got := serverSide.EventLog()
+	if len(got) != len(expect) {
+		t.Fatalf("Expected the events %02x, not %02x", expect, got)
+	}
+	for i, e := range expect {
+		if got[i] != e {
+			t.Fatalf("Expected the events %02x, not %02x", expect, got)
+		}
+	}
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	clientSide, serverSide := NewLoopback()
+	defer clientSide.Close()
+	// each unit has its own server, with holdings that identify the unit and the address
+	units := []int{1, 2, 3, 4, 5}
+	for _, unit := range units {
+		server, _ := NewServer([]byte{byte(unit)}, []string{"a", "b", "c"})
+		server.RegisterHoldings(100, acceptHoldings)
+		values := make([]int, 100)
+		for i := range values {
+			values[i] = unit*1000 + i
+		}
+		if err := server.WriteHoldingsAtomic(0, values); err != nil {
+			t.Fatal(err)
+		}
+		serverSide.SetServer(unit, server)
+	}
+
+	// 50 requests in flight at once, 10 from each client, each for a distinct range
+	errs := make(chan error, 50)
+	wg := sync.WaitGroup{}
+	for _, unit := range units {
+		client := clientSide.GetClient(unit)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(unit int, from int) {
+				defer wg.Done()
+				got, err := client.ReadHoldings(from, 5, 5*time.Second)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if len(got.Values) != 5 {
+					errs <- fmt.Errorf("Expected 5 values from unit %v address %v, not %v", unit, from, got.Values)
+					return
+				}
+				for j, v := range got.Values {
+					if v != unit*1000+from+j {
+						errs <- fmt.Errorf("Expected unit %v address %v to be %v, not %v", unit, from+j, unit*1000+from+j, v)
+						return
+					}
+				}
+			}(unit, i*10)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
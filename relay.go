@@ -0,0 +1,92 @@
+package modbus
+
+import (
+	"errors"
+	"time"
+)
+
+// RelayOptions controls how the requests are forwarded by a relay. See RelayWithOptions
+type RelayOptions struct {
+	// Units maps each unit that requests are received for on the front to the unit that they are forwarded to on the
+	// back. If 0xFF is mapped, the requests for units that are not mapped are forwarded to the same unit on the back.
+	Units map[int]int
+	// Timeout is how long to wait for the back unit to respond. A timeout of 0 (or less) uses 1 second.
+	Timeout time.Duration
+}
+
+// relay is a Server that forwards each request it gets to a client on another Modbus. It only forwards requests, it
+// has no memory model/cache of its own, so the Server methods are not available.
+type relay struct {
+	Server
+	back    Modbus
+	units   map[byte]byte
+	timeout time.Duration
+}
+
+/*
+Relay makes front a gateway to back: the requests that front receives for the units are forwarded to the same units on
+back, and the responses (including exceptions) are returned to the remote clients on front. For example, to make the
+RTU units 1 and 2 available to Modbus/TCP clients:
+
+	rtu, _ := modbus.NewRTU("/dev/ttyUSB0", 19200, 'E', 1, true)
+	tcpserv, _ := modbus.NewTCPServerWithOptions(":502", nil, modbus.TCPServerOptions{
+		OnConnectModbus: func(remote net.Addr, mb modbus.Modbus) {
+			modbus.Relay(mb, rtu, []int{1, 2})
+		},
+	})
+
+If the back unit does not respond the remote client gets a Gateway Target Device Failed to Respond exception (0x0B),
+and if the request cannot be sent it gets a Gateway Path Unavailable exception (0x0A).
+*/
+func Relay(front Modbus, back Modbus, units []int) {
+	mapped := make(map[int]int)
+	for _, u := range units {
+		mapped[u] = u
+	}
+	RelayWithOptions(front, back, RelayOptions{Units: mapped})
+}
+
+// RelayWithOptions makes front a gateway to back like Relay, but the units can be mapped to different units on back.
+func RelayWithOptions(front Modbus, back Modbus, opts RelayOptions) {
+	r := &relay{back: back, units: make(map[byte]byte), timeout: opts.Timeout}
+	if r.timeout <= 0 {
+		r.timeout = time.Second
+	}
+	for f, b := range opts.Units {
+		r.units[bytePanic(f)] = bytePanic(b)
+	}
+	for f := range r.units {
+		front.SetServer(int(f), r)
+	}
+}
+
+// route returns the unit on the back that requests for the unit on the front are forwarded to.
+func (r *relay) route(unit byte) (byte, bool) {
+	if b, ok := r.units[unit]; ok {
+		return b, true
+	}
+	if _, ok := r.units[0xff]; ok {
+		return unit, true
+	}
+	return 0, false
+}
+
+func (r *relay) request(mb Modbus, unit byte, function byte, request []byte) ([]byte, error) {
+	target, ok := r.route(unit)
+	if !ok {
+		return nil, GatewayPathErrorF("No relay for unit %v", unit)
+	}
+	got, err := r.back.GetClient(int(target)).DebugRaw(int(function), bytesToInt(request), r.timeout)
+	if err != nil {
+		var mbErr *Error
+		switch {
+		case errors.As(err, &mbErr):
+			// the back unit responded with an exception, pass it on
+			return nil, mbErr
+		case errors.Is(err, ErrTimeout):
+			return nil, GatewayTargetErrorF("Unit %v did not respond to function 0x%02x: %v", target, function, err)
+		}
+		return nil, GatewayPathErrorF("Unable to relay function 0x%02x to unit %v: %v", function, target, err)
+	}
+	return intsToBytes(got.Data), nil
+}
@@ -2,6 +2,8 @@ package modbus
 
 import (
 	"fmt"
+	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/rolfl/modbus/serial"
@@ -25,12 +27,16 @@ const (
 
 type rtu struct {
 	name string
+	// the largest PDU that is framed
+	pduLimit
 	// internally used to feed each char as it comes off the wire
 	rxchar chan byte
 	// channel has a value when there's been a pause in reception (end of frame?)
 	rxto chan bool
 	// reset the reception pause clock... presumably because we got a new character
 	rxtoc chan bool
+	// channel has a value when the bus has been idle for t3.5 after reception, so the next character starts a frame
+	rxidle chan bool
 	// will have a value on it if the wire is ready for a transmission
 	txready chan bool
 	// How long after an RX character to wait for end of frame
@@ -49,18 +55,27 @@ type rtu struct {
 	toTX chan adu
 	// ID to use for uncorrelated calls
 	txid uint16
-	// wlog chan wirelog
+	wlog wireLog
+	log  logSink
 	// check whether incoming packets are associated with outgoing calls.
 	pending map[byte]uint16
+	plock   sync.Mutex
 	diag    *busDiagnosticManager
+	// test option: the fraction of responses to send with a corrupt CRC
+	crcErrors float64
+	crcLock   sync.Mutex
+	// RS485 direction control: RTS is set while frames are sent, with the delays before and after the frame
+	rts     bool
+	rtsPre  time.Duration
+	rtsPost time.Duration
 }
 
-// NewRTU establishes a connection to a local COM port (windows) or serial device (others)
-func NewRTU(device string, baud int, parity int, stopbits int, minFrame time.Duration, dtr bool) (Modbus, error) {
+// openSerial opens a local COM port (windows) or serial device (others) with the given settings
+func openSerial(device string, baud int, size int, parity int, stopbits int, dtr bool) (*serial.Port, error) {
 	options := serial.Config{}
 	options.Name = device
 	options.Baud = baud
-	options.Size = 8
+	options.Size = byte(size)
 	options.Parity = serial.ParityNone
 
 	switch parity {
@@ -92,12 +107,72 @@ func NewRTU(device string, baud int, parity int, stopbits int, minFrame time.Dur
 	if dtr {
 		err = port.SetDTR()
 		if err != nil {
+			port.Close()
 			return nil, err
 		}
 	}
+	return port, nil
+}
+
+// NewRTU establishes a connection to a local COM port (windows) or serial device (others)
+func NewRTU(device string, baud int, parity int, stopbits int, minFrame time.Duration, dtr bool) (Modbus, error) {
+	wp, err := newRTU(device, baud, parity, stopbits, minFrame, dtr)
+	if err != nil {
+		return nil, err
+	}
+	return wp.start(), nil
+}
+
+/*
+NewRTUWithTiming establishes a connection to a local COM port (windows) or serial device (others) the same way as NewRTU,
+but with explicit inter-frame timing instead of the timing computed from the baud rate. The t15 time is the pause in
+reception that ends a frame, and t35 is the idle time needed on the bus before a frame is sent. Use RTUTiming on the
+Modbus to see the timing that NewRTU chose.
+*/
+func NewRTUWithTiming(device string, baud int, parity int, stopbits int, t15 time.Duration, t35 time.Duration, dtr bool) (Modbus, error) {
+	if t15 <= 0 || t35 <= 0 {
+		return nil, fmt.Errorf("RTU timing t1.5 %v and t3.5 %v must both be greater than 0", t15, t35)
+	}
+	wp, err := newRTU(device, baud, parity, stopbits, 0, dtr)
+	if err != nil {
+		return nil, err
+	}
+	wp.pause = t15
+	wp.idle = t35
+	return wp.start(), nil
+}
+
+/*
+NewRTUWithFlowControl establishes a connection to a local COM port (windows) or serial device (others) the same way as
+NewRTU, for RS485 adapters that need the RTS line to switch the transceiver between receiving and sending. RTS is set
+before each frame is written, and cleared once the frame has been transmitted. The rtsPre delay is the time between
+setting RTS and writing the frame, and the rtsPost delay is the time between the end of the transmission and clearing
+RTS. Both delays may be 0.
+*/
+func NewRTUWithFlowControl(device string, baud int, parity int, stopbits int, minFrame time.Duration, dtr bool, rtsPre time.Duration, rtsPost time.Duration) (Modbus, error) {
+	wp, err := newRTU(device, baud, parity, stopbits, minFrame, dtr)
+	if err != nil {
+		return nil, err
+	}
+	// the transceiver receives until there is a frame to send
+	if err := wp.serial.ClearRTS(); err != nil {
+		wp.serial.Close()
+		return nil, err
+	}
+	wp.rts = true
+	wp.rtsPre = rtsPre
+	wp.rtsPost = rtsPost
+	return wp.start(), nil
+}
 
-	fmt.Printf("Opened Modbus RTU on %v at %v-%c-%v\n", device, baud, parity, stopbits)
-	wp := rtu{}
+// newRTU opens the serial device and computes the timing for the baud rate, the rtu is not started.
+func newRTU(device string, baud int, parity int, stopbits int, minFrame time.Duration, dtr bool) (*rtu, error) {
+	port, err := openSerial(device, baud, 8, parity, stopbits, dtr)
+	if err != nil {
+		return nil, err
+	}
+
+	wp := &rtu{}
 	wp.name = device
 	wp.serial = port
 	wp.isopen = true
@@ -105,12 +180,12 @@ func NewRTU(device string, baud int, parity int, stopbits int, minFrame time.Dur
 	wp.rxchar = make(chan byte, 300)
 	wp.rxto = make(chan bool)
 	wp.rxtoc = make(chan bool)
+	wp.rxidle = make(chan bool, 1)
 	wp.txready = make(chan bool, 1)
 	wp.toTX = make(chan adu, 5)
 	wp.toDemux = make(chan adu, 5)
 	wp.pending = make(map[byte]uint16)
 	wp.diag = newBusDiagnosticManager()
-	// wp.wlog = make(chan wirelog, 10)
 
 	// From the Modbus spec, wait 1.5 chars for frame end, and 3.5 for bus idle
 	// For baud rates greater than 19200 Bps, fixed values for the 2 timers should be used: it is
@@ -139,23 +214,22 @@ func NewRTU(device string, baud int, parity int, stopbits int, minFrame time.Dur
 	if wp.pause < minFrame {
 		wp.pause = minFrame
 	}
+	return wp, nil
+}
 
-	closer := func() error {
-		return wp.close()
-	}
-
+// start begins communicating on the serial device
+func (rtu *rtu) start() Modbus {
 	// start a go routine that reads bytes off the serial device
-	go wp.wireReader()
+	go rtu.wireReader()
 	// start a go routine that writes bytes to the serial device
-	go wp.wireWriter()
+	go rtu.wireWriter()
 	// start a go routine that manages the clocks.....
-	go wp.ticker()
+	go rtu.ticker()
 	// start a go routine that frames up received messages.
-	go wp.wireFramer()
+	go rtu.wireFramer()
 
-	// go wp.wireLogger()
-
-	return newModbus(wp.toTX, wp.toDemux, closer, wp.diag), nil
+	rtu.diag.logEvent(busCommRestart)
+	return newModbus(rtu.toTX, rtu.toDemux, rtu, rtu.diag)
 }
 
 func (rtu *rtu) close() error {
@@ -171,51 +245,69 @@ func (rtu *rtu) close() error {
 
 // wireFramer reads data from the wireReader channel, and waits for the frame token too.
 // it processes received frames, validates them, etc. then distributes them to the respective clients.
+// After a frame with a bad CRC (for example from a collision) the framer is out of sync with the bus: it discards the
+// characters it receives until the bus has been idle for t3.5, and the next character starts a new frame.
 func (rtu *rtu) wireFramer() {
 	alive := true
+	resync := false
 	for alive {
-		data := make([]byte, 0, 300)
+		// one more than the largest frame, so that handleFrame sees that an overrun frame is too large
+		limit := rtu.maxPDUSize() + rtuOverhead + 1
+		data := make([]byte, 0, limit)
 		framedone := false
 		for !framedone {
 			select {
 			case ch := <-rtu.rxchar:
 				// we cheat a bit, add chars to a certain length, then start bitbucketing them.
 				// the actual frame-size check happens in handleFrame
-				if len(data) < 260 {
+				if !resync && len(data) < limit {
 					data = append(data, ch)
 				}
 				// fmt.Printf("%0x\n", ch)
 			case <-rtu.rxto:
 				// we have a frame.... check it, and distribute it.
 				// fmt.Printf("<<<%v - %v\n", len(data), data)
-				rtu.handleFrame(data)
+				if resync {
+					rtu.log.Debugf("Discarding frame on %s while waiting for the bus to be idle", rtu.name)
+				} else if !rtu.handleFrame(data) {
+					resync = true
+					// an idle marker from before the bad frame does not count
+					select {
+					case <-rtu.rxidle:
+					default:
+					}
+				}
 				framedone = true
+			case <-rtu.rxidle:
+				resync = false
 			}
 		}
 	}
 }
 
-func (rtu *rtu) handleFrame(frame rtuFrame) {
+// handleFrame checks the frame, and distributes it if it is valid. It returns false if the CRC is wrong.
+func (rtu *rtu) handleFrame(frame rtuFrame) bool {
 	if len(frame) == 0 {
-		return
+		return true
 	}
+	rtu.wlog.log(Received, frame)
 	if len(frame) < 4 {
-		fmt.Printf("Too small of a frame on %s, just %d bytes\n", rtu.name, len(frame))
+		rtu.log.Errorf("Too small of a frame on %s, just %d bytes", rtu.name, len(frame))
 		rtu.diag.commError()
-		return
+		return true
 	}
-	if len(frame) > 256 {
+	if limit := rtu.maxPDUSize() + rtuOverhead; len(frame) > limit {
 		rtu.diag.overrun()
-		fmt.Printf("Too large of a frame on %s, exceeds 256 bytes\n", rtu.name)
-		return
+		rtu.log.Errorf("Too large of a frame on %s, exceeds %d bytes", rtu.name, limit)
+		return true
 	}
 
-	xcrc := computeCRC16(frame[:len(frame)-2])
+	xcrc := CRC16(frame[:len(frame)-2])
 	gcrc := getWordLE(frame, len(frame)-2)
 	if xcrc != gcrc {
-		fmt.Printf("CRC Mismatch on %s. Expected %d but got %d\n", rtu.name, xcrc, gcrc)
+		rtu.log.Errorf("CRC Mismatch on %s. Expected %d but got %d", rtu.name, xcrc, gcrc)
 		rtu.diag.commError()
-		return
+		return false
 	}
 
 	// OK, we have a frame, send it to the respective client.
@@ -227,6 +319,7 @@ func (rtu *rtu) handleFrame(frame rtuFrame) {
 
 	p := pdu{function, data}
 	a := adu{false, 0, unit, p}
+	rtu.plock.Lock()
 	if txid, ok := rtu.pending[unit]; ok {
 		a.txid = txid
 		delete(rtu.pending, unit)
@@ -234,8 +327,10 @@ func (rtu *rtu) handleFrame(frame rtuFrame) {
 		rtu.txid++
 		a.txid = rtu.txid
 	}
+	rtu.plock.Unlock()
 
 	rtu.toDemux <- a
+	return true
 }
 
 const (
@@ -276,6 +371,11 @@ func (rtu *rtu) ticker() {
 				// we can now write to the bus if we need to (3.5 char period)
 				//fmt.Println("Tock")
 				rtu.txready <- true
+				// and the framer can start a new frame, if it is resynchronizing
+				select {
+				case rtu.rxidle <- true:
+				default:
+				}
 				// set the mode to Off.
 				mode = isidle
 				// fmt.Printf("Long Idle marker\n")
@@ -300,13 +400,10 @@ func (rtu *rtu) wireReader() {
 	for alive {
 		n, err := rtu.serial.Read(buffer)
 		if err != nil {
-			fmt.Printf("Error reading from serial line %s: %s\n", rtu.name, err)
+			rtu.log.Errorf("Error reading from serial line %s: %s", rtu.name, err)
 			n = 0
 		}
 		if n != 0 {
-			// cp := make([]byte, n)
-			// copy(cp, buffer)
-			// rtu.wlog <- wirelog{time.Now(), cp}
 			// reset the clock timeout.
 			rtu.rxtoc <- true
 			// send the chars to the channel
@@ -332,18 +429,9 @@ func (rtu *rtu) wireReader() {
 			// Nothing to see here, move along.
 		}
 	}
-	fmt.Printf("Terminating serial line reader %s: closed\n", rtu.name)
+	rtu.log.Debugf("Terminating serial line reader %s: closed", rtu.name)
 }
 
-// func (rtu *rtu) wireLogger() {
-// 	prev := time.Now()
-// 	for l := range rtu.wlog {
-// 		dur := l.at.Sub(prev)
-// 		fmt.Printf("Received at %v (delay %v): %v\n", l.at, dur, l.bytes)
-// 		prev = l.at
-// 	}
-// }
-
 // wireWriter takes frames that are ready to send, waits for an idle period on the wire, and transmits it.
 func (rtu *rtu) wireWriter() {
 	alive := true
@@ -356,7 +444,10 @@ func (rtu *rtu) wireWriter() {
 			// data to send.... let's wait for the channel to be ready....
 			// fmt.Println("Got data to send on TX, waiting for TX IDLE")
 			if f.request {
+				// a broadcast to unit 0 gets no response, unless unit 0 is not a broadcast (see SetUnitZeroBroadcast)
+				rtu.plock.Lock()
 				rtu.pending[f.unit] = f.txid
+				rtu.plock.Unlock()
 			}
 			select {
 			case <-rtu.closed:
@@ -364,22 +455,72 @@ func (rtu *rtu) wireWriter() {
 			case <-rtu.txready:
 				// wire is clear to send on... let's dump it.
 				// fmt.Println("Got TX IDLE, waiting for TX COMPLETE")
-				if !f.request {
+				if f.request {
+					rtu.diag.logEvent(busOutgoing)
+				} else {
 					rtu.diag.response(f.pdu)
 				}
 				frame := buildRTUFrame(f)
-				for len(frame) > 0 {
-					if n, err := rtu.serial.Write(frame); err != nil {
-						// fmt.Printf("Unable to send bytes to %s: %s\n", rtu.name, err)
-						frame = frame[:0]
-					} else {
-						frame = frame[n:]
-					}
+				if !f.request && rtu.corruptCRC() {
+					frame[len(frame)-1] ^= 0xff
 				}
+				rtu.wlog.log(Sent, frame)
+				rtu.send(frame)
 			}
 		}
 	}
-	fmt.Printf("Terminating serial line writer %s: closed\n", rtu.name)
+	rtu.log.Debugf("Terminating serial line writer %s: closed", rtu.name)
+}
+
+// send writes the frame to the wire, with RS485 direction control if it is enabled
+func (rtu *rtu) send(frame rtuFrame) {
+	if rtu.rts {
+		if err := rtu.serial.SetRTS(); err != nil {
+			rtu.log.Errorf("Unable to set RTS on %s: %s", rtu.name, err)
+		}
+		time.Sleep(rtu.rtsPre)
+	}
+	for len(frame) > 0 {
+		if n, err := rtu.serial.Write(frame); err != nil {
+			// fmt.Printf("Unable to send bytes to %s: %s\n", rtu.name, err)
+			frame = frame[:0]
+		} else {
+			frame = frame[n:]
+		}
+	}
+	if rtu.rts {
+		if err := rtu.serial.Drain(); err != nil {
+			rtu.log.Errorf("Unable to drain %s: %s", rtu.name, err)
+		}
+		time.Sleep(rtu.rtsPost)
+		if err := rtu.serial.ClearRTS(); err != nil {
+			rtu.log.Errorf("Unable to clear RTS on %s: %s", rtu.name, err)
+		}
+	}
+}
+
+func (rtu *rtu) setWireLogger(logger WireLogger) {
+	rtu.wlog.setLogger(logger, rtu.closed)
+}
+
+func (rtu *rtu) setLogger(logger Logger) {
+	rtu.log.set(logger)
+}
+
+func (rtu *rtu) simulateCRCErrors(fraction float64) error {
+	if fraction < 0 || fraction > 1 {
+		return fmt.Errorf("CRC error fraction %v must be in the range 0.0 to 1.0", fraction)
+	}
+	rtu.crcLock.Lock()
+	defer rtu.crcLock.Unlock()
+	rtu.crcErrors = fraction
+	return nil
+}
+
+func (rtu *rtu) corruptCRC() bool {
+	rtu.crcLock.Lock()
+	defer rtu.crcLock.Unlock()
+	return rtu.crcErrors > 0 && rand.Float64() < rtu.crcErrors
 }
 
 func buildRTUFrame(f adu) rtuFrame {
@@ -388,7 +529,7 @@ func buildRTUFrame(f adu) rtuFrame {
 	data[0] = f.unit
 	data[1] = f.pdu.function
 	copy(data[2:], f.pdu.data)
-	crc := computeCRC16(data[:sz-2])
+	crc := CRC16(data[:sz-2])
 	setWordLE(data, sz-2, crc)
 	return data
 }
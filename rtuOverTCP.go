@@ -0,0 +1,281 @@
+package modbus
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+type rtuOverTCP struct {
+	name string
+	// the largest PDU that is framed
+	pduLimit
+	conn *net.TCPConn
+	// Write to this channel to queue frames to send
+	toTX chan adu
+	// Frames off the wire will be readable from this channel
+	toDemux chan adu
+	// whether this is open or not.
+	isopen bool
+	// a channel that is closed if we are not open ;)
+	closed chan bool
+	// ID to use for uncorrelated calls
+	txid uint16
+	// check whether incoming packets are associated with outgoing calls.
+	pending map[byte]uint16
+	plock   sync.Mutex
+	diag    *busDiagnosticManager
+	wlog    wireLog
+	log     logSink
+}
+
+/*
+NewRTUOverTCP establishes a connection to a remote IP and port using TCP then returns a Modbus instance that sends and
+receives RTU frames (unit, function, data, and CRC16, with no MBAP header) over the TCP channel. This is what some
+serial-to-ethernet gateways do instead of Modbus/TCP.
+
+Since there are no idle times to mark the end of a frame, frames are identified by the function code and the expected
+size of the request or response.
+
+e.g. NewRTUOverTCP("192.168.1.10:4001")
+*/
+func NewRTUOverTCP(hostport string) (Modbus, error) {
+	addr, err := net.ResolveTCPAddr("tcp", hostport)
+	if err != nil {
+		return nil, err
+	}
+
+	// dial from any local interface to the remote address
+	conn, err := net.DialTCP("tcp", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.SetNoDelay(true)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	t := &rtuOverTCP{}
+	t.conn = conn
+	t.name = conn.RemoteAddr().String()
+	t.isopen = true
+	t.closed = make(chan bool)
+	t.toDemux = make(chan adu, 5)
+	t.toTX = make(chan adu, 5)
+	t.pending = make(map[byte]uint16)
+	t.diag = newBusDiagnosticManager()
+
+	// start a go routine that reads bytes off the TCP connection
+	go t.wireReader()
+	// start a go routine that writes bytes to the TCP connection
+	go t.wireWriter()
+
+	return newModbus(t.toTX, t.toDemux, t, t.diag), nil
+}
+
+func (t *rtuOverTCP) close() error {
+	if !t.isopen {
+		return nil
+	}
+	t.isopen = false
+	// closing this channel means that anyone reading from the channel is auto-selected in a Select statement
+	close(t.closed)
+	t.conn.Close()
+	return nil
+}
+
+func (t *rtuOverTCP) isPending(unit byte) bool {
+	t.plock.Lock()
+	defer t.plock.Unlock()
+	_, ok := t.pending[unit]
+	return ok
+}
+
+// wireReader takes data off the wire, splits it in to RTU frames, and submits complete frames to the demuxer.
+func (t *rtuOverTCP) wireReader() {
+	noDeadline := time.Time{}
+	buffer := make([]byte, 0, 512)
+	chunk := make([]byte, 256)
+
+	for {
+		n, err := t.conn.Read(chunk)
+		if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.log.Errorf("Shutting down reading: %v", err)
+			t.close()
+			break
+		}
+		if err != nil {
+			// the rest of a partial frame never arrived
+			t.log.Errorf("Timeout in partial frame on %s, discarding %d bytes", t.name, len(buffer))
+			t.diag.commError()
+			buffer = buffer[:0]
+		}
+		buffer = append(buffer, chunk[:n]...)
+
+		for len(buffer) > 0 {
+			size := rtuFrameSize(buffer, t.isPending(buffer[0]))
+			if size < 0 && len(buffer) >= 4 && CRC16(buffer[:len(buffer)-2]) == getWordLE(buffer, len(buffer)-2) {
+				// we cannot tell the size from the content, but the whole buffer is a valid frame.
+				size = len(buffer)
+			}
+			if limit := t.maxPDUSize() + rtuOverhead; size > limit || (size < 0 && len(buffer) > limit) {
+				t.log.Errorf("Too large of a frame on %s, exceeds %d bytes", t.name, limit)
+				t.diag.overrun()
+				buffer = buffer[:0]
+				break
+			}
+			if size < 0 || size > len(buffer) {
+				// need more data
+				break
+			}
+			t.handleFrame(append(make([]byte, 0, size), buffer[:size]...))
+			buffer = append(buffer[:0], buffer[size:]...)
+		}
+
+		// for any partial frame, there is a limit to how long we wait for the rest of it.
+		deadline := noDeadline
+		if len(buffer) > 0 {
+			deadline = time.Now().Add(time.Second)
+		}
+		if err := t.conn.SetReadDeadline(deadline); err != nil {
+			t.log.Errorf("Shutting down reading: %v", err)
+			t.close()
+			break
+		}
+	}
+	t.log.Debugf("Terminating RTU over TCP reader %s: closed", t.name)
+}
+
+func (t *rtuOverTCP) setWireLogger(logger WireLogger) {
+	t.wlog.setLogger(logger, t.closed)
+}
+
+func (t *rtuOverTCP) setLogger(logger Logger) {
+	t.log.set(logger)
+}
+
+func (t *rtuOverTCP) handleFrame(frame rtuFrame) {
+	t.wlog.log(Received, frame)
+	xcrc := CRC16(frame[:len(frame)-2])
+	gcrc := getWordLE(frame, len(frame)-2)
+	if xcrc != gcrc {
+		t.log.Errorf("CRC Mismatch on %s. Expected %d but got %d", t.name, xcrc, gcrc)
+		t.diag.commError()
+		return
+	}
+
+	// OK, we have a frame, send it to the respective client.
+	unit := frame[0]
+	function := frame[1]
+	data := frame[2 : len(frame)-2]
+
+	t.diag.message(unit == 0)
+
+	p := pdu{function, data}
+	a := adu{false, 0, unit, p}
+	t.plock.Lock()
+	if txid, ok := t.pending[unit]; ok {
+		a.txid = txid
+		delete(t.pending, unit)
+	} else {
+		t.txid++
+		a.txid = t.txid
+	}
+	t.plock.Unlock()
+
+	t.toDemux <- a
+}
+
+// wireWriter takes frames that are ready to send and writes them to the TCP connection.
+func (t *rtuOverTCP) wireWriter() {
+	alive := true
+	for alive {
+		select {
+		case <-t.closed:
+			alive = false
+		case f := <-t.toTX:
+			if f.request {
+				// a broadcast to unit 0 gets no response, unless unit 0 is not a broadcast (see SetUnitZeroBroadcast)
+				t.plock.Lock()
+				t.pending[f.unit] = f.txid
+				t.plock.Unlock()
+			} else {
+				t.diag.response(f.pdu)
+			}
+			frame := buildRTUFrame(f)
+			t.wlog.log(Sent, frame)
+			for len(frame) > 0 {
+				if n, err := t.conn.Write(frame); err != nil {
+					frame = frame[:0]
+				} else {
+					frame = frame[n:]
+				}
+			}
+		}
+	}
+	t.log.Debugf("Terminating RTU over TCP writer %s: closed", t.name)
+}
+
+// rtuFrameSize computes the size of the RTU frame (including the CRC) at the start of the data. A response frame is
+// expected when we have sent a request to that unit. It returns -1 if there is not enough data to know the size yet, or
+// if the size cannot be determined from the function code (e.g. diagnostics, which have a variable size echo).
+func rtuFrameSize(data []byte, response bool) int {
+	if len(data) < 2 {
+		return -1
+	}
+	function := data[1]
+	// counted returns the size of a frame with a byte count at the given index
+	counted := func(index int) int {
+		if len(data) <= index {
+			return -1
+		}
+		return index + 1 + int(data[index]) + 2
+	}
+	if response {
+		if function&0x80 != 0 {
+			return 5
+		}
+		switch function {
+		case 0x01, 0x02, 0x03, 0x04, 0x0c, 0x11, 0x14, 0x15, 0x17:
+			return counted(2)
+		case 0x05, 0x06, 0x0b, 0x0f, 0x10:
+			return 8
+		case 0x07:
+			return 5
+		case 0x16:
+			return 10
+		case 0x18:
+			if len(data) < 4 {
+				return -1
+			}
+			return 4 + int(getWord(data, 2)) + 2
+		}
+		return -1
+	}
+	switch function {
+	case 0x01, 0x02, 0x03, 0x04, 0x05, 0x06:
+		return 8
+	case 0x07, 0x0b, 0x0c, 0x11:
+		return 4
+	case 0x0f, 0x10:
+		return counted(6)
+	case 0x14, 0x15:
+		return counted(2)
+	case 0x16:
+		return 10
+	case 0x17:
+		return counted(10)
+	case 0x18:
+		return 6
+	case 0x2b:
+		// only Read Device Identification (MEI type 0x0E) has a fixed size, other MEI types have any payload
+		if len(data) > 2 && data[2] == 0x0e {
+			return 7
+		}
+	}
+	return -1
+}
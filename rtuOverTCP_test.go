@@ -0,0 +1,72 @@
+package modbus
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRTUFrameSizeEncapsulated(t *testing.T) {
+	// Read Device Identification has a fixed size request
+	if size := rtuFrameSize([]byte{1, 0x2b, 0x0e, 0x01, 0x00}, false); size != 7 {
+		t.Fatalf("Expected a Read Device Identification request of 7 bytes, not %v", size)
+	}
+	// other MEI types can have any payload, so the size is found from the CRC
+	if size := rtuFrameSize([]byte{1, 0x2b, 0x0d, 0x01, 0x02, 0x03}, false); size != -1 {
+		t.Fatalf("Expected the size of an MEI 0x0D request to be unknown, not %v", size)
+	}
+	if size := rtuFrameSize([]byte{1, 0x2b}, false); size != -1 {
+		t.Fatalf("Expected the size to be unknown before the MEI type, not %v", size)
+	}
+}
+
+func TestRTUOverTCPConcurrentRequests(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// the remote device takes a while to respond to each Read Holding Registers request, with the address as the value
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		request := make([]byte, 8)
+		for {
+			if _, err := io.ReadFull(conn, request); err != nil {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+			response := adu{false, 0, request[0], pdu{0x03, []byte{0x02, request[2], request[3]}}}
+			conn.Write(buildRTUFrame(response))
+		}
+	}()
+
+	mb, err := NewRTUOverTCP(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mb.Close()
+	client := mb.GetClient(1)
+
+	errs := make(chan error, 2)
+	for _, address := range []int{10, 20} {
+		go func(address int) {
+			got, err := client.ReadHoldings(address, 1, time.Second)
+			if err == nil && got.Values[0] != address {
+				err = fmt.Errorf("Expected the response for address %v, not %v", address, got.Values)
+			}
+			errs <- err
+		}(address)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package modbus
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestRTU returns an rtu without a serial device, with its framer running on characters and timing markers that
+// the test feeds to it
+func newTestRTU(t *testing.T) *rtu {
+	wp := &rtu{}
+	wp.name = "test"
+	wp.rxchar = make(chan byte, 300)
+	wp.rxto = make(chan bool)
+	wp.rxidle = make(chan bool, 1)
+	wp.toDemux = make(chan adu, 5)
+	wp.pending = make(map[byte]uint16)
+	wp.diag = newBusDiagnosticManager()
+	wp.setMaxPDUSize(DefaultMaxPDUSize)
+	go wp.wireFramer()
+	return wp
+}
+
+// feedRTUFrame feeds the characters of a frame to the framer, and ends the frame with a t1.5 pause
+func feedRTUFrame(rtu *rtu, frame []byte) {
+	for _, ch := range frame {
+		rtu.rxchar <- ch
+	}
+	for len(rtu.rxchar) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	rtu.rxto <- true
+}
+
+// feedRTUIdle signals the framer that the bus has been idle for t3.5, once it has handled the frames before it
+func feedRTUIdle(rtu *rtu) {
+	rtu.rxidle <- true
+	for len(rtu.rxidle) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRTUResyncAfterBadCRC(t *testing.T) {
+	wp := newTestRTU(t)
+	valid := buildRTUFrame(adu{false, 0, 1, pdu{0x03, []byte{0x02, 0x12, 0x34}}})
+
+	// garbage with a bad CRC, and then the rest of a collision before the bus is idle
+	feedRTUFrame(wp, []byte{0x01, 0x03, 0x02, 0x55, 0x66, 0x00, 0x00})
+	feedRTUFrame(wp, valid)
+	feedRTUIdle(wp)
+	select {
+	case a := <-wp.toDemux:
+		t.Fatalf("Expected the frame before the bus is idle to be discarded, not %v", a)
+	default:
+	}
+
+	// once the bus is idle, the next frame is decoded
+	feedRTUFrame(wp, valid)
+	select {
+	case a := <-wp.toDemux:
+		if a.unit != 1 || a.pdu.function != 0x03 || len(a.pdu.data) != 3 || getWord(a.pdu.data, 1) != 0x1234 {
+			t.Fatalf("Expected the valid frame to be decoded, not %v", a)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the valid frame to be decoded after the bus is idle")
+	}
+	if errs := wp.diag.getDiagnostics().CommErrors; errs != 1 {
+		t.Fatalf("Expected one comm error for the bad CRC, not %v", errs)
+	}
+}
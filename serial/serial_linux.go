@@ -206,6 +206,35 @@ func (p *Port) ClearDTR() error {
 	return p.maskTIOCM(DTR, false)
 }
 
+// SetRTS sets the RTS on the COM Port
+func (p *Port) SetRTS() error {
+	const RTS = 0x4
+	return p.maskTIOCM(RTS, true)
+}
+
+// ClearRTS clears the RTS on the COM Port
+func (p *Port) ClearRTS() error {
+	const RTS = 0x4
+	return p.maskTIOCM(RTS, false)
+}
+
+// Drain waits until the data written to the port has been transmitted
+func (p *Port) Drain() error {
+	// TCSBRK with a non-zero argument is tcdrain
+	const TCSBRK = 0x5409
+	_, _, errno := unix.Syscall(
+		unix.SYS_IOCTL,
+		uintptr(p.f.Fd()),
+		uintptr(TCSBRK),
+		uintptr(1),
+	)
+
+	if errno == 0 {
+		return nil
+	}
+	return errno
+}
+
 func (p *Port) Close() (err error) {
 	return p.f.Close()
 }
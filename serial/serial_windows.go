@@ -151,6 +151,29 @@ func (p *Port) ClearDTR() error {
 	return nil
 }
 
+// SetRTS sets the RTS on the COM Port
+func (p *Port) SetRTS() error {
+	// Set RTS - code 3 on https://docs.microsoft.com/en-us/windows/win32/api/winbase/nf-winbase-escapecommfunction
+	if err := escapeCommFunction(p.fd, 3); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ClearRTS clears the RTS on the COM Port
+func (p *Port) ClearRTS() error {
+	// Clear RTS - code 4 on https://docs.microsoft.com/en-us/windows/win32/api/winbase/nf-winbase-escapecommfunction
+	if err := escapeCommFunction(p.fd, 4); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Drain waits until the data written to the port has been transmitted
+func (p *Port) Drain() error {
+	return flushFileBuffers(p.fd)
+}
+
 var (
 	nSetCommState,
 	nSetCommTimeouts,
@@ -244,6 +267,14 @@ func escapeCommFunction(h syscall.Handle, dwfunc uint32) error {
 	return nil
 }
 
+func flushFileBuffers(h syscall.Handle) error {
+	r, _, err := syscall.Syscall(nFlushFileBuffers, 1, uintptr(h), 0, 0)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
 func setCommTimeouts(h syscall.Handle, readTimeout time.Duration) error {
 	var timeouts structTimeouts
 	const MAXDWORD = 1<<32 - 1
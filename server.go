@@ -1,7 +1,11 @@
 package modbus
 
 import (
+	"errors"
 	"fmt"
+	"math/rand"
+	"sync"
+	"time"
 )
 
 /*
@@ -21,6 +25,7 @@ type Atomic interface {
 	Complete()
 
 	execute(func())
+	changed(kind RegisterKind, address int, old []int, new []int)
 }
 
 // UpdateCoils is a function called when coils are expected to be written by request from a remote client
@@ -35,6 +40,50 @@ type UpdateHoldings func(server Server, atomic Atomic, address int, values []int
 // Do not Complete the atomic
 type UpdateFile func(server Server, atomic Atomic, file int, address int, values []int, current []int) ([]int, error)
 
+// RegisterKind identifies the type of a value in the server memory model
+type RegisterKind int
+
+const (
+	// KindDiscrete is a discrete (read-only bit)
+	KindDiscrete RegisterKind = iota
+	// KindCoil is a coil (read/write bit)
+	KindCoil
+	// KindInput is an input register (read-only word)
+	KindInput
+	// KindHolding is a holding register (read/write word)
+	KindHolding
+)
+
+func (k RegisterKind) String() string {
+	switch k {
+	case KindDiscrete:
+		return "Discrete"
+	case KindCoil:
+		return "Coil"
+	case KindInput:
+		return "Input"
+	case KindHolding:
+		return "Holding"
+	}
+	return fmt.Sprintf("RegisterKind(%d)", int(k))
+}
+
+// ChangeHandler is a function called for each value that a remote client changed. Coil values are 0 or 1.
+type ChangeHandler func(kind RegisterKind, address int, old int, new int)
+
+// ReadBits is a function called to get the current discrete values when they are read by a remote client. It must
+// return count values. Do not Complete the atomic
+type ReadBits func(atomic Atomic, address int, count int) ([]bool, error)
+
+// ReadWords is a function called to get the current input or holding register values when they are read by a remote
+// client. It must return count values. Do not Complete the atomic
+type ReadWords func(atomic Atomic, address int, count int) ([]int, error)
+
+// FunctionHandler is a function called when a remote client sends a request with a custom function code registered
+// using RegisterFunctionHandler. The req is the request payload (excluding the function code) and the returned
+// slice is the response payload. Return a modbus *Error to send a specific exception code to the client.
+type FunctionHandler func(mb Modbus, req []byte) ([]byte, error)
+
 // Server represents a system that can handle an incoming request from a remote client
 type Server interface {
 	// Diagnostics returns the current diagnostic counts of the server instance
@@ -49,6 +98,9 @@ type Server interface {
 
 	// RegisterDiscretes indicates how many discretes to make available in the server memory model/cache
 	RegisterDiscretes(count int)
+	// RegisterDiscretesReader is like RegisterDiscretes, but when a remote client reads the discretes the reader is
+	// called to get the current values, and the values are stored in the server memory model/cache as well.
+	RegisterDiscretesReader(count int, reader ReadBits)
 	// ReadDiscretes performs a discrete read operation as part of an existing atomic operation from the memory model/cache
 	ReadDiscretes(atomic Atomic, address int, count int) ([]bool, error)
 	// ReadDiscretesAtomic performs an atomic ReadDiscretes
@@ -57,6 +109,9 @@ type Server interface {
 	WriteDiscretes(atomic Atomic, address int, values []bool) error
 	// WriteDiscretesAtomic performs an atomic WriteDiscretes
 	WriteDiscretesAtomic(address int, values []bool) error
+	// SetDiscretesBulk atomically replaces the discretes from the address with the values, adding discretes to the
+	// memory model/cache if needed. It is an efficient way for a simulator to update many discretes at once.
+	SetDiscretesBulk(address int, values []bool) error
 
 	// RegisterCoils indicates how many coils to make available in the server memory model/cache, and which function to call
 	// when a remote client attempts to update the coil settings
@@ -72,6 +127,9 @@ type Server interface {
 
 	// RegisterInputs indicates how many inputs to make available in the server memory model/cache
 	RegisterInputs(count int)
+	// RegisterInputsReader is like RegisterInputs, but when a remote client reads the inputs the reader is called to
+	// get the current values, and the values are stored in the server memory model/cache as well.
+	RegisterInputsReader(count int, reader ReadWords)
 	// ReadInputs performs ain input read operation as part of an existing atomic operation from the memory model/cache
 	ReadInputs(atomic Atomic, address int, count int) ([]int, error)
 	// ReadInputsAtomic performs an atomic ReadInputs
@@ -80,10 +138,22 @@ type Server interface {
 	WriteInputs(atomic Atomic, address int, values []int) error
 	// WriteInputsAtomic performs an atomic WriteInputs
 	WriteInputsAtomic(address int, values []int) error
+	// SetInputsBulk atomically replaces the inputs from the address with the values, adding inputs to the memory
+	// model/cache if needed. It is an efficient way for a simulator to update many inputs at once.
+	SetInputsBulk(address int, values []int) error
 
 	// RegisterHoldings indicates how many coils to make available in the server memory model/cache, and which function to call
 	// when a remote client attempts to update the holding register values
 	RegisterHoldings(count int, handler UpdateHoldings)
+	// RegisterHoldingsReader sets the reader to call to get the current values when a remote client reads the holding
+	// registers, and the values are stored in the server memory model/cache as well. Writes are still handled by the
+	// handler given to RegisterHoldings, so call that too if the holding registers are writable. The reader is also
+	// called for the read of a Write/Read Multiple Registers request (after the write), and for Read FIFO Queue.
+	RegisterHoldingsReader(count int, reader ReadWords)
+	// OnChange sets the function to call for each coil or holding register value that is changed by a remote client.
+	// It is called after the write is committed (and the atomic is complete), once for each address with a
+	// different value. Set a nil handler to stop the calls.
+	OnChange(handler ChangeHandler)
 	// ReadHoldings performs a holding register read operation as part of an existing atomic operation from the memory model/cache
 	ReadHoldings(atomic Atomic, address int, count int) ([]int, error)
 	// ReadHoldingsAtomic performs an atomic ReadHoldings
@@ -96,6 +166,10 @@ type Server interface {
 	// RegisterFiles indicates how many files to make available in the server memory model/cache, and which function to call
 	// when a remote client attempts to update the file records
 	RegisterFiles(count int, handler UpdateFile)
+	// PadFileReads sets whether reads of file records beyond the end of a file return 0 values. By default they do not,
+	// and reads return only the records that have been written, which may be none. Set pad to true to act like devices
+	// that pre-allocate their files, and always return the number of records that are read.
+	PadFileReads(pad bool)
 	// ReadFileRecords performs a file records read operation as part of an existing atomic operation from the memory model/cache
 	ReadFileRecords(atomic Atomic, address int, offset int, count int) ([]int, error)
 	// ReadFileRecordsAtomic performs an atomic ReadFileRecords
@@ -105,6 +179,74 @@ type Server interface {
 	// WriteFileRecordsAtomic performs an atomic WriteFileRecords
 	WriteFileRecordsAtomic(address int, offset int, values []int) error
 
+	// Snapshot returns a copy of the complete memory model/cache, taken in a single atomic operation. Compare snapshots
+	// using DiffServerState.
+	Snapshot() ServerState
+
+	// RegisterFunctionHandler adds support for a custom (typically vendor-specific) function code, replacing any
+	// existing handler for the function. Requests with fewer than minSize bytes of payload are rejected before the
+	// handler is called. Requests for function codes that have no handler get an Illegal Function exception.
+	RegisterFunctionHandler(function int, minSize int, handler FunctionHandler) error
+	// CountsHandler returns a FunctionHandler that reports the number of discretes, coils, inputs, holdings and files
+	// registered in the server. Register it against a custom function code using RegisterFunctionHandler.
+	CountsHandler() FunctionHandler
+	// RegisterMEIHandler adds support for an Encapsulated Interface Transport (0x2B) MEI type, for example 0x0D for
+	// the CANopen General Reference, replacing any existing handler for the MEI type. The handler gets the request
+	// payload after the MEI type, and returns the response payload after the MEI type. MEI type 0x0E (Read Device
+	// Identification) is handled by the server, and cannot be replaced.
+	RegisterMEIHandler(meiType int, handler FunctionHandler) error
+
+	// SetFunctionOffset adds an offset to the addresses in requests for the given function code before the memory
+	// model/cache is accessed, like the "device offset mode" of some gateways. For example, with an offset of 100 for
+	// function 0x03, a remote read of holding registers from address 0 returns the values at address 100. Responses
+	// still contain the address that was requested. Set an offset of 0 to remove it.
+	SetFunctionOffset(function int, offset int)
+
+	// SetUnsupportedDiagnosticException sets the exception code returned to a client that requests a diagnostic (0x08)
+	// sub-function that is not supported. The default is 3 (Illegal Data Value), but some devices return 1 (Illegal Function).
+	SetUnsupportedDiagnosticException(code int) error
+
+	// ProtectHoldings makes count holding registers from the address read-only for remote clients. Remote writes that
+	// include a protected register fail without calling the UpdateHoldings handler. The server can still write them.
+	ProtectHoldings(from int, count int)
+	// ProtectCoils makes count coils from the address read-only for remote clients. Remote writes that include a
+	// protected coil fail without calling the UpdateCoils handler. The server can still write them.
+	ProtectCoils(from int, count int)
+	// SetProtectedException sets the exception code returned to a client that writes to a protected coil or holding
+	// register. The default is 2 (Illegal Data Address), the other choice is 1 (Illegal Function).
+	SetProtectedException(code int) error
+
+	// SetRunIndicator sets the run indicator status that is reported to a client that requests the Report Server ID
+	// (0x11). Servers are running (0xFF) by default, set false to report that the server is stopped (0x00), for
+	// example when the device has a fault.
+	SetRunIndicator(running bool)
+	// SetExceptionStatus sets the 8 exception status bits (0x00 to 0xFF) that are reported to a client that requests
+	// the Read Exception Status (0x07). The meaning of the bits is device specific, for example fault flags. The
+	// status is 0 by default.
+	SetExceptionStatus(bits int) error
+	// SetMaxConcurrentRequests limits how many remote requests are handled at the same time. Further requests get a
+	// Server Busy exception (code 6) immediately, and are counted in the ServerBusy diagnostic. A limit of 0 (the
+	// default) handles any number of requests at once.
+	SetMaxConcurrentRequests(max int)
+	// SetDeviceInfo replaces the basic (0x00 to 0x02) or regular (0x03 to 0x06) Device Identification object at the
+	// index (the object ID), which is initially the deviceInfo given to NewServer. Unset regular objects before the
+	// index are reported as empty strings.
+	SetDeviceInfo(index int, value string) error
+	// SetDeviceInfoExtended replaces the extended Device Identification object with the objectID (0x80 to 0xFF).
+	// Extended objects are private to the device, and unset extended objects before the objectID are reported as empty
+	// strings.
+	SetDeviceInfoExtended(objectID int, value string) error
+	// InjectException makes the next count requests for the function get the exception code (1 to 255) instead of
+	// being handled, so that clients can be tested against exceptions that the server would not normally return. A
+	// count of 0 (or less) removes an injection that has not been used up. The requests are counted and logged as if
+	// the server had returned the exception.
+	InjectException(function int, code int, count int) error
+	// SetResponseDelay is a test aid that makes the server wait a random time from min to max before it sends each
+	// response, to simulate a slow device when testing client timeouts and retries. Requests are still handled in
+	// parallel, and the delay is after the request is handled. There is no delay by default, and SetResponseDelay(0, 0)
+	// removes it. If max is less than min, the delay is always min.
+	SetResponseDelay(min time.Duration, max time.Duration)
+
 	// request is called from the modbus layer and instructs the server to handle a request.
 	request(bus Modbus, unit byte, function byte, data []byte) ([]byte, error)
 }
@@ -120,14 +262,15 @@ type requestHandlerMeta struct {
 	event    bool
 }
 
-func (rhm requestHandlerMeta) notEvent() {
+func (rhm *requestHandlerMeta) notEvent() {
 	rhm.event = false
 }
 
 type server struct {
 	id             []byte
 	deviceInfo     []string
-	rhandlers      map[byte]requestHandlerMeta
+	rhandlers      map[byte]*requestHandlerMeta
+	meiHandlers    map[byte]FunctionHandler
 	discretes      []bool
 	coils          []bool
 	inputs         []int
@@ -138,6 +281,39 @@ type server struct {
 	updateCoils    UpdateCoils
 	updateHoldings UpdateHoldings
 	updateFiles    UpdateFile
+	readDiscretes  ReadBits
+	readInputs     ReadWords
+	readHoldings   ReadWords
+	onChange       ChangeHandler
+	diagException  uint8
+	// dirty is only accessed in the manageCache go-routine
+	dirty       int
+	published   ServerState
+	publishLock sync.RWMutex
+	offsets     map[byte]int
+	offsetLock  sync.Mutex
+	// handlers can be registered while the server is handling requests
+	handlerLock sync.RWMutex
+	slots       chan bool
+	padFiles    bool
+	protected   map[RegisterKind][]AddressRange
+	protectErr  uint8
+	protectLock sync.Mutex
+	// the server identification and status can be changed while the server is handling requests. The deviceInfo slice is
+	// replaced, not modified, when it changes.
+	infoLock        sync.RWMutex
+	stopped         bool
+	exceptionStatus int
+	// the test aids: injected exceptions by function code, and the response delay range
+	injected   map[byte]injection
+	delayMin   time.Duration
+	delayMax   time.Duration
+	injectLock sync.Mutex
+}
+
+type injection struct {
+	code  uint8
+	count int
 }
 
 // NewServer creates a Server instance that can be bound to a Modbus instance using modbus.SetServer(...).
@@ -150,9 +326,15 @@ func NewServer(id []byte, deviceInfo []string) (Server, error) {
 	copy(s.id, id)
 	s.deviceInfo = make([]string, len(deviceInfo))
 	copy(s.deviceInfo, deviceInfo)
-	s.rhandlers = make(map[byte]requestHandlerMeta)
+	s.rhandlers = make(map[byte]*requestHandlerMeta)
+	s.meiHandlers = make(map[byte]FunctionHandler)
+	s.injected = make(map[byte]injection)
 	s.diag = newServerDiagnosticManager()
 	s.atomics = make(chan Atomic, 0)
+	s.diagException = 3
+	s.offsets = make(map[byte]int)
+	s.protected = make(map[RegisterKind][]AddressRange)
+	s.protectErr = 2
 
 	// Set up the discrete handlers
 	s.addRequestHandler(0x02, 4, s.x02ReadDiscretes)
@@ -190,8 +372,10 @@ func NewServer(id []byte, deviceInfo []string) (Server, error) {
 	return s, nil
 }
 
-func (s *server) addRequestHandler(function byte, minsize int, handler requestHandler) requestHandlerMeta {
-	ret := requestHandlerMeta{function, minsize, handler, true}
+func (s *server) addRequestHandler(function byte, minsize int, handler requestHandler) *requestHandlerMeta {
+	ret := &requestHandlerMeta{function, minsize, handler, true}
+	s.handlerLock.Lock()
+	defer s.handlerLock.Unlock()
 	s.rhandlers[function] = ret
 	return ret
 }
@@ -217,12 +401,42 @@ func (s *server) RegisterCoils(count int, handler UpdateCoils) {
 	s.updateCoils = handler
 }
 
+func (s *server) RegisterDiscretesReader(count int, reader ReadBits) {
+	atomic := s.StartAtomic()
+	defer atomic.Complete()
+	s.ensureDiscretes(atomic, count)
+	s.handlerLock.Lock()
+	defer s.handlerLock.Unlock()
+	s.readDiscretes = reader
+}
+
+func (s *server) discretesReader() ReadBits {
+	s.handlerLock.RLock()
+	defer s.handlerLock.RUnlock()
+	return s.readDiscretes
+}
+
 func (s *server) RegisterInputs(count int) {
 	atomic := s.StartAtomic()
 	defer atomic.Complete()
 	s.ensureInputs(atomic, count)
 }
 
+func (s *server) RegisterInputsReader(count int, reader ReadWords) {
+	atomic := s.StartAtomic()
+	defer atomic.Complete()
+	s.ensureInputs(atomic, count)
+	s.handlerLock.Lock()
+	defer s.handlerLock.Unlock()
+	s.readInputs = reader
+}
+
+func (s *server) inputsReader() ReadWords {
+	s.handlerLock.RLock()
+	defer s.handlerLock.RUnlock()
+	return s.readInputs
+}
+
 func (s *server) RegisterHoldings(count int, handler UpdateHoldings) {
 	atomic := s.StartAtomic()
 	defer atomic.Complete()
@@ -230,6 +444,39 @@ func (s *server) RegisterHoldings(count int, handler UpdateHoldings) {
 	s.updateHoldings = handler
 }
 
+func (s *server) OnChange(handler ChangeHandler) {
+	s.handlerLock.Lock()
+	defer s.handlerLock.Unlock()
+	s.onChange = handler
+}
+
+func (s *server) notifyChanges(changes []valueChange) {
+	s.handlerLock.RLock()
+	handler := s.onChange
+	s.handlerLock.RUnlock()
+	if handler == nil {
+		return
+	}
+	for _, c := range changes {
+		handler(c.kind, c.address, c.old, c.new)
+	}
+}
+
+func (s *server) RegisterHoldingsReader(count int, reader ReadWords) {
+	atomic := s.StartAtomic()
+	defer atomic.Complete()
+	s.ensureHoldings(atomic, count)
+	s.handlerLock.Lock()
+	defer s.handlerLock.Unlock()
+	s.readHoldings = reader
+}
+
+func (s *server) holdingsReader() ReadWords {
+	s.handlerLock.RLock()
+	defer s.handlerLock.RUnlock()
+	return s.readHoldings
+}
+
 func (s *server) RegisterFiles(count int, handler UpdateFile) {
 	atomic := s.StartAtomic()
 	defer atomic.Complete()
@@ -237,22 +484,262 @@ func (s *server) RegisterFiles(count int, handler UpdateFile) {
 	s.updateFiles = handler
 }
 
-func (s *server) request(mb Modbus, unit byte, function byte, request []byte) ([]byte, error) {
+func (s *server) PadFileReads(pad bool) {
+	s.handlerLock.Lock()
+	defer s.handlerLock.Unlock()
+	s.padFiles = pad
+}
+
+func (s *server) padFileReads() bool {
+	s.handlerLock.RLock()
+	defer s.handlerLock.RUnlock()
+	return s.padFiles
+}
+
+func (s *server) SetUnsupportedDiagnosticException(code int) error {
+	if code < 1 || code > 0xff {
+		return fmt.Errorf("Exception code %v is not valid: it must be in the range 1 to 255", code)
+	}
+	s.handlerLock.Lock()
+	defer s.handlerLock.Unlock()
+	s.diagException = uint8(code)
+	return nil
+}
+
+func (s *server) unsupportedDiagnosticException() uint8 {
+	s.handlerLock.RLock()
+	defer s.handlerLock.RUnlock()
+	return s.diagException
+}
+
+func (s *server) SetRunIndicator(running bool) {
+	s.infoLock.Lock()
+	defer s.infoLock.Unlock()
+	s.stopped = !running
+}
+
+func (s *server) SetExceptionStatus(bits int) error {
+	if bits < 0 || bits > 0xff {
+		return fmt.Errorf("Exception status %v is not valid: it must be in the range 0x00 to 0xFF", bits)
+	}
+	s.infoLock.Lock()
+	defer s.infoLock.Unlock()
+	s.exceptionStatus = bits
+	return nil
+}
+
+func (s *server) SetMaxConcurrentRequests(max int) {
+	s.handlerLock.Lock()
+	defer s.handlerLock.Unlock()
+	if max > 0 {
+		s.slots = make(chan bool, max)
+	} else {
+		s.slots = nil
+	}
+}
+
+func (s *server) InjectException(function int, code int, count int) error {
+	if function < 1 || function > 0x7f {
+		return fmt.Errorf("Function code %v is not valid: it must be in the range 1 to 127", function)
+	}
+	if code < 1 || code > 0xff {
+		return fmt.Errorf("Exception code %v is not valid: it must be in the range 1 to 255", code)
+	}
+	s.injectLock.Lock()
+	defer s.injectLock.Unlock()
+	if count > 0 {
+		s.injected[byte(function)] = injection{uint8(code), count}
+	} else {
+		delete(s.injected, byte(function))
+	}
+	return nil
+}
+
+func (s *server) SetResponseDelay(min time.Duration, max time.Duration) {
+	if min < 0 {
+		min = 0
+	}
+	if max < min {
+		max = min
+	}
+	s.injectLock.Lock()
+	defer s.injectLock.Unlock()
+	s.delayMin = min
+	s.delayMax = max
+}
+
+// responseDelay returns a random time in the response delay range.
+func (s *server) responseDelay() time.Duration {
+	s.injectLock.Lock()
+	defer s.injectLock.Unlock()
+	delay := s.delayMin
+	if s.delayMax > s.delayMin {
+		delay += time.Duration(rand.Int63n(int64(s.delayMax-s.delayMin) + 1))
+	}
+	return delay
+}
+
+// injectedException returns the exception injected for the function, if there is one, and uses it up.
+func (s *server) injectedException(function byte) (*Error, bool) {
+	s.injectLock.Lock()
+	defer s.injectLock.Unlock()
+	inj, ok := s.injected[function]
+	if !ok {
+		return nil, false
+	}
+	inj.count--
+	if inj.count > 0 {
+		s.injected[function] = inj
+	} else {
+		delete(s.injected, function)
+	}
+	return exceptionError(inj.code), true
+}
+
+func (s *server) SetDeviceInfo(index int, value string) error {
+	if index < 0 || index > 0x06 {
+		return fmt.Errorf("Device Identification object %v is not valid: it must be in the range 0x00 to 0x06", index)
+	}
+	s.setDeviceInfo(index, value)
+	return nil
+}
+
+func (s *server) SetDeviceInfoExtended(objectID int, value string) error {
+	if objectID < 0x80 || objectID > 0xff {
+		return fmt.Errorf("Extended Device Identification object %v is not valid: it must be in the range 0x80 to 0xFF", objectID)
+	}
+	s.setDeviceInfo(deviceInfoIndex(objectID), value)
+	return nil
+}
+
+// deviceInfoIndex maps the Device Identification object ID to the index in the deviceInfo slice. The extended objects
+// follow the 7 basic and regular objects.
+func deviceInfoIndex(oid int) int {
+	if oid >= 0x80 {
+		return oid - 0x80 + 7
+	}
+	return oid
+}
+
+func (s *server) setDeviceInfo(index int, value string) {
+	s.infoLock.Lock()
+	defer s.infoLock.Unlock()
+	size := len(s.deviceInfo)
+	if index >= size {
+		size = index + 1
+	}
+	info := make([]string, size)
+	copy(info, s.deviceInfo)
+	info[index] = value
+	s.deviceInfo = info
+}
+
+func (s *server) SetFunctionOffset(function int, offset int) {
+	s.offsetLock.Lock()
+	defer s.offsetLock.Unlock()
+	if offset == 0 {
+		delete(s.offsets, bytePanic(function))
+	} else {
+		s.offsets[bytePanic(function)] = offset
+	}
+}
+
+// mapAddress applies any offset configured for the function to the address in a remote request
+func (s *server) mapAddress(function byte, address int) (int, error) {
+	s.offsetLock.Lock()
+	offset := s.offsets[function]
+	s.offsetLock.Unlock()
+	mapped := address + offset
+	if mapped < 0 || mapped > 0xffff {
+		return 0, IllegalAddressErrorF("Address %v with offset %v for function 0x%02x is out of range", address, offset, function)
+	}
+	return mapped, nil
+}
+
+// restartComm returns true if the request is for the Restart Communications diagnostic sub-function
+func restartComm(function byte, request []byte) bool {
+	return function == 0x08 && len(request) >= 2 && getWord(request, 0) == 0x01
+}
+
+func (s *server) request(mb Modbus, unit byte, function byte, request []byte) (ret []byte, err error) {
+	// the event log records this request, and the response (or exception) that is sent for it
+	broadcast := mb != nil && mb.broadcast(unit)
+	listening := s.diag.received(broadcast)
+	// the response delay is applied once, while the request still holds its concurrency slot and event, if it has them
+	delayed := false
+	delay := func() {
+		if delayed || broadcast || errors.Is(err, errNoResponse) {
+			return
+		}
+		delayed = true
+		if d := s.responseDelay(); d > 0 {
+			time.Sleep(d)
+		}
+	}
+	defer func() {
+		var lenErr *lengthError
+		if errors.As(err, &lenErr) {
+			// a request with an incorrect length is an illegal value, not a server failure
+			err = IllegalValueErrorF("%v", lenErr.msg)
+		}
+		if broadcast {
+			// broadcasts are handled, but there is never a response
+			ret, err = nil, errNoResponse
+		}
+		if errors.Is(err, errNoResponse) {
+			s.diag.noResponse()
+			return
+		}
+		delay()
+		code := exceptionCode(err)
+		switch code {
+		case 6:
+			s.diag.serverBusy()
+		case 7:
+			s.diag.serverNAKs()
+		}
+		s.diag.sent(code)
+	}()
+
+	if listening && !restartComm(function, request) {
+		// in listen only mode, only a Restart Communications request is handled
+		s.diag.message()
+		return nil, errNoResponse
+	}
+
+	if exc, ok := s.injectedException(function); ok {
+		s.diag.message()
+		return nil, exc
+	}
+
+	s.handlerLock.RLock()
 	h, ok := s.rhandlers[function]
+	slots := s.slots
+	s.handlerLock.RUnlock()
 	if !ok {
-		return nil, fmt.Errorf("Function code 0x%02x not implemented", function)
+		return nil, IllegalFunctionErrorF("Function code 0x%02x not implemented", function)
 	}
 
 	s.diag.message()
+	if slots != nil {
+		select {
+		case slots <- true:
+			defer func() { <-slots }()
+		default:
+			return nil, ServerBusyErrorF("Server is already handling %v requests", cap(slots))
+		}
+	}
 	if h.event {
 		s.diag.eventQueued()
 		defer s.diag.eventComplete()
 	}
+	// deferred last, so it runs before the slot and the event are released
+	defer delay()
 
 	req := getReader(request)
 	res := dataBuilder{}
 
-	err := req.canRead(h.minSize)
+	err = req.canRead(h.minSize)
 	if err != nil {
 		return nil, err
 	}
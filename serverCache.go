@@ -1,17 +1,51 @@
 package modbus
 
+import "fmt"
+
+// dirty flags identify which parts of the cache were changed in an atomic operation
+const (
+	dirtyDiscretes = 1 << iota
+	dirtyCoils
+	dirtyInputs
+	dirtyHoldings
+	dirtyFiles
+)
+
 type atomic struct {
 	todo chan func()
 	done chan bool
+	// changes made by remote clients are only accessed by the go-routine holding the atomic
+	changes []valueChange
+	notify  func([]valueChange)
+}
+
+// valueChange is a value that was changed by a remote client
+type valueChange struct {
+	kind    RegisterKind
+	address int
+	old     int
+	new     int
 }
 
 func (a *atomic) execute(fn func()) {
 	a.todo <- fn
 }
 
+func (a *atomic) changed(kind RegisterKind, address int, old []int, new []int) {
+	for i := 0; i < len(old) && i < len(new); i++ {
+		if old[i] != new[i] {
+			a.changes = append(a.changes, valueChange{kind, address + i, old[i], new[i]})
+		}
+	}
+}
+
 func (a *atomic) Complete() {
 	close(a.todo)
 	<-a.done
+	// changes are reported once they are committed, and the atomic is released
+	if len(a.changes) > 0 {
+		a.notify(a.changes)
+	}
 }
 
 func (s *server) StartAtomic() Atomic {
@@ -24,23 +58,107 @@ func (s *server) manageCache() {
 	for {
 		// seed the channel with a new atomic operation.
 		// the chan supports a buffer of 5 functions to run... we don't expect to ever have more than 1, but whatever
-		a := &atomic{make(chan func(), 5), make(chan bool)}
+		a := &atomic{make(chan func(), 5), make(chan bool), nil, s.notifyChanges}
 		s.atomics <- a
 
 		// while there are atomic operations, handle them.
 		for fn := range a.todo {
 			fn()
 		}
+		// publish the changes before the atomic is complete so that a client that reads after a write sees the write.
+		s.publish()
 		close(a.done)
 		// the channel was closed, no more atomics, get ready to set up another seed.
 	}
 }
 
+// publish makes a copy of the parts of the cache that have changed and makes that copy available to readers that do not
+// want to wait for an atomic (which may be held by a slow write). The published slices are never modified, the unchanged
+// parts of the cache are shared with the previously published state. Only call this from the manageCache go-routine.
+func (s *server) publish() {
+	if s.dirty == 0 {
+		return
+	}
+	s.publishLock.Lock()
+	defer s.publishLock.Unlock()
+	if s.dirty&dirtyDiscretes != 0 {
+		s.published.Discretes = append(make([]bool, 0, len(s.discretes)), s.discretes...)
+	}
+	if s.dirty&dirtyCoils != 0 {
+		s.published.Coils = append(make([]bool, 0, len(s.coils)), s.coils...)
+	}
+	if s.dirty&dirtyInputs != 0 {
+		s.published.Inputs = append(make([]int, 0, len(s.inputs)), s.inputs...)
+	}
+	if s.dirty&dirtyHoldings != 0 {
+		s.published.Holdings = append(make([]int, 0, len(s.holdings)), s.holdings...)
+	}
+	if s.dirty&dirtyFiles != 0 {
+		// each file's records are replaced, not modified, on a write, so they can be shared
+		s.published.Files = append(make([][]int, 0, len(s.files)), s.files...)
+	}
+	s.dirty = 0
+}
+
+// committed returns the state of the cache as of the most recently completed atomic operation. The reads of remote
+// clients are served from the committed state so that they are not blocked by a write in progress, except for the
+// values that are read on demand with a registered reader (see RegisterHoldingsReader).
+func (s *server) committed() ServerState {
+	s.publishLock.RLock()
+	defer s.publishLock.RUnlock()
+	return s.published
+}
+
+func readCommittedBits(name string, bits []bool, address, count int) ([]bool, error) {
+	err := serverCheckAddress(name, address, count, len(bits))
+	if err != nil {
+		return nil, err
+	}
+	return append(make([]bool, 0), bits[address:address+count]...), nil
+}
+
+func readCommittedWords(name string, words []int, address, count int) ([]int, error) {
+	err := serverCheckAddress(name, address, count, len(words))
+	if err != nil {
+		return nil, err
+	}
+	return append(make([]int, 0), words[address:address+count]...), nil
+}
+
+// readFileRecords returns up to count records from the address in the file. Fewer records are returned if the file is
+// short, unless pad is set, then the missing records are returned as 0.
+func readFileRecords(files [][]int, file int, address int, count int, pad bool) ([]int, error) {
+	err := serverCheckAddress("File", file, 1, len(files))
+	if err != nil {
+		return nil, err
+	}
+	err = serverCheckAddress("FileRecord", address, count, fileRecordLimit)
+	if err != nil {
+		return nil, err
+	}
+	want := count
+	toSend := make([]int, 0)
+	f := files[file]
+	if len(f) > address {
+		available := len(f) - address
+		if available < count {
+			count = available
+		}
+		toSend = make([]int, count)
+		copy(toSend, f[address:address+count])
+	}
+	if pad && len(toSend) < want {
+		toSend = append(toSend, make([]int, want-len(toSend))...)
+	}
+	return toSend, nil
+}
+
 func (s *server) ensureDiscretes(atomic Atomic, count int) {
 	done := make(chan bool)
 	atomic.execute(func() {
 		defer close(done)
 		if len(s.discretes) < count {
+			s.dirty |= dirtyDiscretes
 			s.discretes = append(s.discretes, make([]bool, count-len(s.discretes))...)
 		}
 	})
@@ -52,6 +170,7 @@ func (s *server) ensureCoils(atomic Atomic, count int) {
 	atomic.execute(func() {
 		defer close(done)
 		if len(s.coils) < count {
+			s.dirty |= dirtyCoils
 			s.coils = append(s.coils, make([]bool, count-len(s.coils))...)
 		}
 	})
@@ -63,6 +182,7 @@ func (s *server) ensureInputs(atomic Atomic, count int) {
 	atomic.execute(func() {
 		defer close(done)
 		if len(s.inputs) < count {
+			s.dirty |= dirtyInputs
 			s.inputs = append(s.inputs, make([]int, count-len(s.inputs))...)
 		}
 	})
@@ -74,6 +194,7 @@ func (s *server) ensureHoldings(atomic Atomic, count int) {
 	atomic.execute(func() {
 		defer close(done)
 		if len(s.holdings) < count {
+			s.dirty |= dirtyHoldings
 			s.holdings = append(s.holdings, make([]int, count-len(s.holdings))...)
 		}
 	})
@@ -85,6 +206,7 @@ func (s *server) ensureFiles(atomic Atomic, count int) {
 	atomic.execute(func() {
 		defer close(done)
 		if len(s.files) < count {
+			s.dirty |= dirtyFiles
 			s.files = append(s.files, make([][]int, count-len(s.files))...)
 		}
 	})
@@ -93,7 +215,8 @@ func (s *server) ensureFiles(atomic Atomic, count int) {
 
 func (s *server) ReadDiscretes(atomic Atomic, address, count int) ([]bool, error) {
 	cret := make(chan []bool)
-	cerr := make(chan error)
+	// the error is buffered so that it can be sent before cret is closed
+	cerr := make(chan error, 1)
 	atomic.execute(func() {
 		defer close(cret)
 		defer close(cerr)
@@ -119,7 +242,7 @@ func (s *server) ReadDiscretesAtomic(address int, count int) ([]bool, error) {
 
 func (s *server) ReadCoils(atomic Atomic, address, count int) ([]bool, error) {
 	cret := make(chan []bool)
-	cerr := make(chan error)
+	cerr := make(chan error, 1)
 	atomic.execute(func() {
 		defer close(cret)
 		defer close(cerr)
@@ -145,7 +268,7 @@ func (s *server) ReadCoilsAtomic(address int, count int) ([]bool, error) {
 
 func (s *server) ReadInputs(atomic Atomic, address, count int) ([]int, error) {
 	cret := make(chan []int)
-	cerr := make(chan error)
+	cerr := make(chan error, 1)
 	atomic.execute(func() {
 		defer close(cret)
 		defer close(cerr)
@@ -171,7 +294,7 @@ func (s *server) ReadInputsAtomic(address int, count int) ([]int, error) {
 
 func (s *server) ReadHoldings(atomic Atomic, address, count int) ([]int, error) {
 	cret := make(chan []int)
-	cerr := make(chan error)
+	cerr := make(chan error, 1)
 	atomic.execute(func() {
 		defer close(cret)
 		defer close(cerr)
@@ -196,25 +319,14 @@ func (s *server) ReadHoldingsAtomic(address int, count int) ([]int, error) {
 }
 
 func (s *server) ReadFileRecords(atomic Atomic, file int, address int, count int) ([]int, error) {
+	pad := s.padFileReads()
 	cret := make(chan struct {
 		values []int
 		err    error
 	})
 	atomic.execute(func() {
 		defer close(cret)
-		err := serverCheckAddress("File", file, 1, len(s.files))
-		toSend := make([]int, 0)
-		if err == nil {
-			f := s.files[file]
-			if len(f) > address {
-				available := len(f) - address
-				if available < count {
-					count = available
-				}
-				toSend = make([]int, count)
-				copy(toSend, f[address:address+count])
-			}
-		}
+		toSend, err := readFileRecords(s.files, file, address, count, pad)
 		cret <- struct {
 			values []int
 			err    error
@@ -242,6 +354,7 @@ func (s *server) WriteDiscretes(atomic Atomic, address int, values []bool) error
 		if err != nil {
 			cerr <- err
 		} else {
+			s.dirty |= dirtyDiscretes
 			copy(s.discretes[address:address+count], values)
 		}
 	})
@@ -255,6 +368,26 @@ func (s *server) WriteDiscretesAtomic(address int, values []bool) error {
 	return s.WriteDiscretes(atomic, address, values)
 }
 
+func (s *server) SetDiscretesBulk(address int, values []bool) error {
+	if address < 0 {
+		return fmt.Errorf("Discrete address %v is not valid", address)
+	}
+	atomic := s.StartAtomic()
+	defer atomic.Complete()
+	done := make(chan bool)
+	atomic.execute(func() {
+		defer close(done)
+		end := address + len(values)
+		if len(s.discretes) < end {
+			s.discretes = append(s.discretes, make([]bool, end-len(s.discretes))...)
+		}
+		s.dirty |= dirtyDiscretes
+		copy(s.discretes[address:end], values)
+	})
+	<-done
+	return nil
+}
+
 func (s *server) WriteCoils(atomic Atomic, address int, values []bool) error {
 	count := len(values)
 	cerr := make(chan error)
@@ -264,6 +397,7 @@ func (s *server) WriteCoils(atomic Atomic, address int, values []bool) error {
 		if err != nil {
 			cerr <- err
 		} else {
+			s.dirty |= dirtyCoils
 			copy(s.coils[address:address+count], values)
 		}
 	})
@@ -286,6 +420,7 @@ func (s *server) WriteInputs(atomic Atomic, address int, values []int) error {
 		if err != nil {
 			cerr <- err
 		} else {
+			s.dirty |= dirtyInputs
 			copy(s.inputs[address:address+count], values)
 		}
 	})
@@ -299,6 +434,26 @@ func (s *server) WriteInputsAtomic(address int, values []int) error {
 	return s.WriteInputs(atomic, address, values)
 }
 
+func (s *server) SetInputsBulk(address int, values []int) error {
+	if address < 0 {
+		return fmt.Errorf("Input address %v is not valid", address)
+	}
+	atomic := s.StartAtomic()
+	defer atomic.Complete()
+	done := make(chan bool)
+	atomic.execute(func() {
+		defer close(done)
+		end := address + len(values)
+		if len(s.inputs) < end {
+			s.inputs = append(s.inputs, make([]int, end-len(s.inputs))...)
+		}
+		s.dirty |= dirtyInputs
+		copy(s.inputs[address:end], values)
+	})
+	<-done
+	return nil
+}
+
 func (s *server) WriteHoldings(atomic Atomic, address int, values []int) error {
 	count := len(values)
 	cerr := make(chan error)
@@ -308,6 +463,7 @@ func (s *server) WriteHoldings(atomic Atomic, address int, values []int) error {
 		if err != nil {
 			cerr <- err
 		} else {
+			s.dirty |= dirtyHoldings
 			copy(s.holdings[address:address+count], values)
 		}
 	})
@@ -331,7 +487,7 @@ func (s *server) WriteFileRecords(atomic Atomic, file int, address int, values [
 			cerr <- err
 			return
 		}
-		err = serverCheckAddress("FileRecord", address, len(values), 10000)
+		err = serverCheckAddress("FileRecord", address, len(values), fileRecordLimit)
 		if err != nil {
 			cerr <- err
 			return
@@ -360,6 +516,7 @@ func (s *server) WriteFileRecords(atomic Atomic, file int, address int, values [
 		copy(nfile[address:], values)
 		copy(nfile[vlen:], post)
 		s.files[file] = nfile
+		s.dirty |= dirtyFiles
 	})
 	err := <-cerr
 	return err
@@ -0,0 +1,73 @@
+package modbus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExceptionCodes(t *testing.T) {
+	client, server := newTestServer(t)
+	server.RegisterDiscretes(10)
+	server.RegisterCoils(10, acceptCoils)
+	server.RegisterInputs(10)
+	server.RegisterHoldings(10, acceptHoldings)
+	server.RegisterFiles(2, func(server Server, atomic Atomic, file int, address int, values []int, current []int) ([]int, error) {
+		return values, nil
+	})
+
+	tests := []struct {
+		name     string
+		function int
+		payload  []int
+		code     int
+	}{
+		{"read coils", 0x01, []int{0x00, 0x00, 0x00, 0x0a}, 0},
+		{"read no coils", 0x01, []int{0x00, 0x00, 0x00, 0x00}, 3},
+		{"read too many coils", 0x01, []int{0x00, 0x00, 0x07, 0xd1}, 3},
+		{"read coils beyond the end", 0x01, []int{0x00, 0x09, 0x00, 0x02}, 2},
+		{"read discretes", 0x02, []int{0x00, 0x00, 0x00, 0x0a}, 0},
+		{"read no discretes", 0x02, []int{0x00, 0x00, 0x00, 0x00}, 3},
+		{"read too many discretes", 0x02, []int{0x00, 0x00, 0x07, 0xd1}, 3},
+		{"read discretes beyond the end", 0x02, []int{0x00, 0x09, 0x00, 0x02}, 2},
+		{"read holdings", 0x03, []int{0x00, 0x00, 0x00, 0x0a}, 0},
+		{"read no holdings", 0x03, []int{0x00, 0x00, 0x00, 0x00}, 3},
+		{"read too many holdings", 0x03, []int{0x00, 0x00, 0x00, 0x7e}, 3},
+		{"read holdings beyond the end", 0x03, []int{0x00, 0x09, 0x00, 0x02}, 2},
+		{"read inputs", 0x04, []int{0x00, 0x00, 0x00, 0x0a}, 0},
+		{"read no inputs", 0x04, []int{0x00, 0x00, 0x00, 0x00}, 3},
+		{"read too many inputs", 0x04, []int{0x00, 0x00, 0x00, 0x7e}, 3},
+		{"read inputs beyond the end", 0x04, []int{0x00, 0x09, 0x00, 0x02}, 2},
+		{"write coil", 0x05, []int{0x00, 0x09, 0xff, 0x00}, 0},
+		{"write coil bad value", 0x05, []int{0x00, 0x09, 0x12, 0x34}, 3},
+		{"write coil beyond the end", 0x05, []int{0x00, 0x0a, 0xff, 0x00}, 2},
+		{"write holding", 0x06, []int{0x00, 0x09, 0x12, 0x34}, 0},
+		{"write holding beyond the end", 0x06, []int{0x00, 0x0a, 0x12, 0x34}, 2},
+		{"write coils", 0x0f, []int{0x00, 0x08, 0x00, 0x02, 0x01, 0x03}, 0},
+		{"write no coils", 0x0f, []int{0x00, 0x00, 0x00, 0x00, 0x00}, 3},
+		{"write coils beyond the end", 0x0f, []int{0x00, 0x09, 0x00, 0x02, 0x01, 0x03}, 2},
+		{"write holdings", 0x10, []int{0x00, 0x08, 0x00, 0x02, 0x04, 0x00, 0x01, 0x00, 0x02}, 0},
+		{"write no holdings", 0x10, []int{0x00, 0x00, 0x00, 0x00, 0x00}, 3},
+		{"write too many holdings", 0x10, []int{0x00, 0x00, 0x00, 0x7c, 0xf8}, 3},
+		{"write holdings beyond the end", 0x10, []int{0x00, 0x09, 0x00, 0x02, 0x04, 0x00, 0x01, 0x00, 0x02}, 2},
+		{"mask write holding", 0x16, []int{0x00, 0x09, 0xff, 0xff, 0x00, 0x00}, 0},
+		{"mask write holding beyond the end", 0x16, []int{0x00, 0x0a, 0xff, 0xff, 0x00, 0x00}, 2},
+		{"write read holdings", 0x17, []int{0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x02, 0x00, 0x01}, 0},
+		{"write read no holdings", 0x17, []int{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x02, 0x00, 0x01}, 3},
+		{"write read holdings beyond the end", 0x17, []int{0x00, 0x0a, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x02, 0x00, 0x01}, 2},
+		{"read fifo", 0x18, []int{0x00, 0x00}, 0},
+		{"read fifo beyond the end", 0x18, []int{0x00, 0x0a}, 2},
+		{"read file record", 0x14, []int{0x07, 0x06, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01}, 0},
+		{"read file record bad reference", 0x14, []int{0x07, 0x05, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01}, 2},
+		{"read file record beyond the files", 0x14, []int{0x07, 0x06, 0x00, 0x05, 0x00, 0x00, 0x00, 0x01}, 2},
+		{"write file record bad reference", 0x15, []int{0x09, 0x05, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01}, 2},
+		{"read file record beyond the records", 0x14, []int{0x07, 0x06, 0x00, 0x01, 0x27, 0x10, 0x00, 0x01}, 2},
+		{"unsupported diagnostic", 0x08, []int{0x00, 0x99, 0x00, 0x00}, 3},
+		{"unsupported function", 0x41, []int{0x00}, 1},
+	}
+	for _, test := range tests {
+		_, err := client.DebugRaw(test.function, test.payload, time.Second)
+		if code := exceptionCode(err); err == nil && test.code != 0 || err != nil && code != test.code {
+			t.Errorf("Expected %v (0x%02x) to get exception code %v, not %v", test.name, test.function, test.code, err)
+		}
+	}
+}
@@ -3,11 +3,16 @@ package modbus
 func (s *server) x01ReadCoils(mb Modbus, request *dataReader, response *dataBuilder) error {
 	addr, _ := request.word()
 	count, _ := request.word()
+	err := serverCheckQuantity("Read Coils", count, 0x07d0)
+	if err != nil {
+		return err
+	}
+	addr, err = s.mapAddress(0x01, addr)
+	if err != nil {
+		return err
+	}
 
-	atomic := s.StartAtomic()
-	defer atomic.Complete()
-
-	coils, err := s.ReadCoils(atomic, addr, count)
+	coils, err := readCommittedBits("Coil", s.committed().Coils, addr, count)
 	if err != nil {
 		return err
 	}
@@ -18,7 +23,11 @@ func (s *server) x01ReadCoils(mb Modbus, request *dataReader, response *dataBuil
 }
 
 func (s *server) xCoilsCommonWrite(atomic Atomic, addr int, values []bool) ([]bool, error) {
-	current, err := s.ReadCoils(atomic, addr, 1)
+	current, err := s.ReadCoils(atomic, addr, len(values))
+	if err != nil {
+		return nil, err
+	}
+	err = s.checkProtected(KindCoil, addr, len(values))
 	if err != nil {
 		return nil, err
 	}
@@ -33,6 +42,7 @@ func (s *server) xCoilsCommonWrite(atomic Atomic, addr int, values []bool) ([]bo
 	if err != nil {
 		return nil, err
 	}
+	atomic.changed(KindCoil, addr, boolsToInts(current), boolsToInts(replacement))
 	return replacement, nil
 }
 
@@ -40,11 +50,18 @@ func (s *server) xCoilsCommonWrite(atomic Atomic, addr int, values []bool) ([]bo
 func (s *server) x05WriteSingleCoil(mb Modbus, request *dataReader, response *dataBuilder) error {
 	addr, _ := request.word()
 	value, _ := request.word()
+	if value != 0x0000 && value != 0xff00 {
+		return IllegalValueErrorF("Write Single Coil value must be 0x0000 or 0xFF00, not 0x%04x", value)
+	}
+	maddr, err := s.mapAddress(0x05, addr)
+	if err != nil {
+		return err
+	}
 
 	atomic := s.StartAtomic()
 	defer atomic.Complete()
 
-	repl, err := s.xCoilsCommonWrite(atomic, addr, []bool{value != 0})
+	repl, err := s.xCoilsCommonWrite(atomic, maddr, []bool{value != 0})
 	if err != nil {
 		return err
 	}
@@ -62,7 +79,23 @@ func (s *server) x05WriteSingleCoil(mb Modbus, request *dataReader, response *da
 func (s *server) x0fWriteCoils(mb Modbus, request *dataReader, response *dataBuilder) error {
 	addr, _ := request.word()
 	count, _ := request.word()
-	coils, err := request.bits(count)
+	err := serverCheckQuantity("Write Multiple Coils", count, 0x07b0)
+	if err != nil {
+		return err
+	}
+	bcnt, err := request.byte()
+	if err != nil {
+		return err
+	}
+	if bcnt != (count+7)/8 {
+		return IllegalValueErrorF("Expected %v bytes for %v coils, but got %v", (count+7)/8, count, bcnt)
+	}
+	packed, err := request.bytes(bcnt)
+	if err != nil {
+		return err
+	}
+	coils := unpackBits(packed, count)
+	maddr, err := s.mapAddress(0x0f, addr)
 	if err != nil {
 		return err
 	}
@@ -70,7 +103,7 @@ func (s *server) x0fWriteCoils(mb Modbus, request *dataReader, response *dataBui
 	atomic := s.StartAtomic()
 	defer atomic.Complete()
 
-	repl, err := s.xCoilsCommonWrite(atomic, addr, coils)
+	repl, err := s.xCoilsCommonWrite(atomic, maddr, coils)
 	if err != nil {
 		return err
 	}
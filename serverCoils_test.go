@@ -0,0 +1,24 @@
+package modbus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWriteCoilsByteCount(t *testing.T) {
+	client, server := newTestServer(t)
+	server.RegisterCoils(32, acceptCoils)
+	// 10 coils need 2 bytes of values
+	if _, err := client.DebugRaw(0x0f, []int{0x00, 0x00, 0x00, 0x0a, 0x02, 0xff, 0x03}, time.Second); err != nil {
+		t.Fatalf("Expected a consistent byte count to succeed: %v", err)
+	}
+	for _, bcnt := range []int{0x01, 0x03} {
+		payload := []int{0x00, 0x00, 0x00, 0x0a, bcnt}
+		for i := 0; i < bcnt; i++ {
+			payload = append(payload, 0xff)
+		}
+		if _, err := client.DebugRaw(0x0f, payload, time.Second); exceptionCode(err) != 3 {
+			t.Fatalf("Expected an Illegal Data Value exception for byte count %v, not %v", bcnt, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package modbus
+
+import "fmt"
+
+func (s *server) RegisterFunctionHandler(function int, minSize int, handler FunctionHandler) error {
+	if function < 1 || function > 0x7f {
+		return fmt.Errorf("Function code %v is not in the valid range 1 to 127", function)
+	}
+	if minSize < 0 {
+		return fmt.Errorf("Minimum request size %v cannot be negative", minSize)
+	}
+	if handler == nil {
+		return fmt.Errorf("A handler is required for function code 0x%02x", function)
+	}
+	s.addRequestHandler(byte(function), minSize, func(mb Modbus, request *dataReader, response *dataBuilder) error {
+		req, _ := request.bytesRaw(len(request.data) - request.cursor)
+		ret, err := handler(mb, append([]byte{}, req...))
+		if err != nil {
+			return err
+		}
+		if max := mb.MaxPDUSize() - 1; len(ret) > max {
+			return ServerFailureErrorF("Function 0x%02x response of %v bytes exceeds the maximum of %v", function, len(ret), max)
+		}
+		response.data = append(response.data, ret...)
+		return nil
+	})
+	return nil
+}
+
+func (s *server) RegisterMEIHandler(meiType int, handler FunctionHandler) error {
+	if meiType < 0 || meiType > 0xff || meiType == 0x0e {
+		return fmt.Errorf("MEI type %v is not valid: it must be in the range 0 to 255, and not 0x0E", meiType)
+	}
+	if handler == nil {
+		return fmt.Errorf("A handler is required for MEI type 0x%02x", meiType)
+	}
+	s.handlerLock.Lock()
+	defer s.handlerLock.Unlock()
+	s.meiHandlers[byte(meiType)] = handler
+	return nil
+}
+
+// meiRequest handles an Encapsulated Interface Transport request for an MEI type other than Read Device Identification.
+func (s *server) meiRequest(mb Modbus, mei int, request *dataReader, response *dataBuilder) error {
+	s.handlerLock.RLock()
+	handler, ok := s.meiHandlers[byte(mei)]
+	s.handlerLock.RUnlock()
+	if !ok {
+		return IllegalFunctionErrorF("Do not support MEI type 0x%02x", mei)
+	}
+	req, _ := request.bytesRaw(len(request.data) - request.cursor)
+	ret, err := handler(mb, append([]byte{}, req...))
+	if err != nil {
+		return err
+	}
+	if max := mb.MaxPDUSize() - 2; len(ret) > max {
+		return ServerFailureErrorF("MEI type 0x%02x response of %v bytes exceeds the maximum of %v", mei, len(ret), max)
+	}
+	response.byte(mei)
+	response.data = append(response.data, ret...)
+	return nil
+}
+
+func (s *server) CountsHandler() FunctionHandler {
+	return func(mb Modbus, req []byte) ([]byte, error) {
+		if len(req) != 0 {
+			return nil, IllegalValueErrorF("Counts request expects no payload, but got %v bytes", len(req))
+		}
+		counts := make(chan []int)
+		atomic := s.StartAtomic()
+		atomic.execute(func() {
+			counts <- []int{len(s.discretes), len(s.coils), len(s.inputs), len(s.holdings), len(s.files)}
+		})
+		ret := <-counts
+		atomic.Complete()
+		for i, c := range ret {
+			ret[i] = wordClamp(c)
+		}
+		res := dataBuilder{}
+		res.beacon()
+		res.words(ret...)
+		return res.payload(), nil
+	}
+}
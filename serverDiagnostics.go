@@ -14,6 +14,9 @@ type serverDiagnosticManager struct {
 	diagnostics ServerDiagnostics
 	operation   chan func()
 	queue       int
+	logCount    int
+	logEntries  [64]int
+	listen      bool
 }
 
 func newServerDiagnosticManager() *serverDiagnosticManager {
@@ -105,7 +108,7 @@ func (sdm *serverDiagnosticManager) resetEventCounter() {
 func (sdm *serverDiagnosticManager) eventQueued() {
 	done := make(chan bool)
 	sdm.operation <- func() {
-		sdm.queue--
+		sdm.queue++
 		close(done)
 	}
 	<-done
@@ -133,7 +136,104 @@ func (sdm *serverDiagnosticManager) clear() {
 	done := make(chan bool)
 	sdm.operation <- func() {
 		sdm.diagnostics = ServerDiagnostics{}
+		sdm.logCount = 0
+		close(done)
+	}
+	<-done
+}
+
+func (sdm *serverDiagnosticManager) plog(value int) {
+	sdm.logEntries[sdm.logCount%64] = value
+	sdm.logCount++
+}
+
+// received records a receive event in the event log for a request the server is handling, and returns true if the
+// server is in listen only mode
+func (sdm *serverDiagnosticManager) received(broadcast bool) bool {
+	done := make(chan bool)
+	sdm.operation <- func() {
+		log := busIncoming
+		if broadcast {
+			log |= busBroadcast
+		}
+		if sdm.listen {
+			log |= busListenOnly
+		}
+		sdm.plog(log)
+		done <- sdm.listen
+		close(done)
+	}
+	return <-done
+}
+
+// restart clears the counters (and optionally the event log), leaves listen only mode, and records the restart in the
+// event log. It returns true if the server was in listen only mode.
+func (sdm *serverDiagnosticManager) restart(clearLog bool) bool {
+	done := make(chan bool)
+	sdm.operation <- func() {
+		sdm.diagnostics = ServerDiagnostics{}
+		if clearLog {
+			sdm.logCount = 0
+		}
+		sdm.plog(busCommRestart)
+		done <- sdm.listen
+		sdm.listen = false
+		close(done)
+	}
+	return <-done
+}
+
+// listenOnly enters (or leaves) listen only mode, where requests are handled, but not responded to. Entering listen
+// only mode is recorded in the event log.
+func (sdm *serverDiagnosticManager) listenOnly(listen bool) {
+	done := make(chan bool)
+	sdm.operation <- func() {
+		if listen && !sdm.listen {
+			sdm.plog(busEnteredListenOnly)
+		}
+		sdm.listen = listen
 		close(done)
 	}
 	<-done
 }
+
+// sent records a send event in the event log for the response to a request, with the exception code if the response
+// is an exception (0 if it is not)
+func (sdm *serverDiagnosticManager) sent(code int) {
+	done := make(chan bool)
+	sdm.operation <- func() {
+		log := busOutgoing
+		switch {
+		case code == 0:
+		case code <= 3:
+			log |= busReadException
+		case code == 4:
+			log |= busAbortException
+		case code <= 6:
+			log |= busBusyException
+		case code == 7:
+			log |= busNAKException
+		}
+		sdm.plog(log)
+		close(done)
+	}
+	<-done
+}
+
+// getEventLog returns the event log, most recent event first
+func (sdm *serverDiagnosticManager) getEventLog() []int {
+	done := make(chan []int)
+	sdm.operation <- func() {
+		count := sdm.logCount
+		if count > 64 {
+			count = 64
+		}
+		ret := make([]int, count)
+		for i := range ret {
+			ret[i] = sdm.logEntries[(sdm.logCount-i-1)%64]
+		}
+		done <- ret
+		close(done)
+	}
+	return <-done
+}
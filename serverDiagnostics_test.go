@@ -0,0 +1,101 @@
+package modbus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCommEventLogFlags(t *testing.T) {
+	client, server := newTestServer(t)
+	server.RegisterHoldings(10, acceptHoldings)
+	if _, err := client.ReadHoldings(0, 2, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ReadHoldings(20, 2, time.Second); exceptionCode(err) != 2 {
+		t.Fatalf("Expected an Illegal Data Address exception, not %v", err)
+	}
+	log, err := client.CommEventLog(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// most recent first: the receive of the Comm Event Log request, then the exception response and its request,
+	// then the successful response and its request
+	events := log.DecodeEvents()
+	if len(events) != 5 {
+		t.Fatalf("Expected 5 events, not %v", events)
+	}
+	for _, i := range []int{0, 2, 4} {
+		if events[i].Kind != CommEventReceive || events[i].Failed() || events[i].Broadcast || events[i].ListenOnly {
+			t.Fatalf("Expected event %v to be a normal receive, not %v", i, events[i])
+		}
+	}
+	if events[1].Kind != CommEventSend || !events[1].ReadException || events[1].BusyException || events[1].NAKException {
+		t.Fatalf("Expected event 1 to be a send with a read exception, not %v", events[1])
+	}
+	if events[3].Kind != CommEventSend || events[3].Failed() {
+		t.Fatalf("Expected event 3 to be a normal send, not %v", events[3])
+	}
+}
+
+func TestRestartCommClearsLog(t *testing.T) {
+	client, _ := newTestServer(t)
+	for i := 0; i < 3; i++ {
+		client.ReadExceptionStatus(time.Second)
+	}
+	if err := client.RestartComm(true, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	log, err := client.CommEventLog(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// most recent first: the receive of the Comm Event Log request, the restart response, and the restart marker
+	events := log.DecodeEvents()
+	if len(events) != 3 {
+		t.Fatalf("Expected the log to be cleared by the restart, not %v", events)
+	}
+	if events[0].Kind != CommEventReceive || events[1].Kind != CommEventSend || events[2].Kind != CommEventRestart {
+		t.Fatalf("Expected a receive, a send and a restart, not %v", events)
+	}
+}
+
+func TestServerResponseCounters(t *testing.T) {
+	clientSide, serverSide := NewLoopback()
+	defer clientSide.Close()
+	clientSide.SetUnitZeroBroadcast(true)
+	serverSide.SetUnitZeroBroadcast(true)
+	// give the server time to handle each broadcast before the next request
+	clientSide.SetBroadcastDelay(20 * time.Millisecond)
+	server, _ := NewServer([]byte{1}, []string{"a", "b", "c"})
+	server.RegisterHoldings(10, acceptHoldings)
+	// the wildcard server handles the requests for unit 1, and the broadcasts
+	serverSide.SetServer(0xff, server)
+	client := clientSide.GetClient(1)
+
+	server.InjectException(0x03, 6, 2)
+	server.InjectException(0x04, 7, 1)
+	for i := 0; i < 2; i++ {
+		if _, err := client.ReadHoldings(0, 1, time.Second); exceptionCode(err) != 6 {
+			t.Fatalf("Expected a Server Busy exception, not %v", err)
+		}
+	}
+	if _, err := client.ReadInputs(0, 1, time.Second); exceptionCode(err) != 7 {
+		t.Fatalf("Expected a NAK exception, not %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := clientSide.GetClient(0).WriteSingleHolding(0, i, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expect := map[Diagnostic]int{ServerBusies: 2, ServerNAKs: 1, ServerNoResponses: 3}
+	for counter, want := range expect {
+		got, err := client.DiagnosticCount(counter, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Count != want {
+			t.Fatalf("Expected %v to be %v, not %v", counter, want, got.Count)
+		}
+	}
+}
@@ -7,10 +7,21 @@ func (s *server) x02ReadDiscretes(mb Modbus, request *dataReader, response *data
 	}
 	addr, _ := request.word()
 	count, _ := request.word()
+	err = serverCheckQuantity("Read Discretes", count, 0x07d0)
+	if err != nil {
+		return err
+	}
+	addr, err = s.mapAddress(0x02, addr)
+	if err != nil {
+		return err
+	}
 
-	atomic := s.StartAtomic()
-	defer atomic.Complete()
-	discretes, err := s.ReadDiscretes(atomic, addr, count)
+	var discretes []bool
+	if reader := s.discretesReader(); reader != nil {
+		discretes, err = s.sourceDiscretes(reader, addr, count)
+	} else {
+		discretes, err = readCommittedBits("Discrete", s.committed().Discretes, addr, count)
+	}
 	if err != nil {
 		return err
 	}
@@ -19,3 +30,20 @@ func (s *server) x02ReadDiscretes(mb Modbus, request *dataReader, response *data
 	response.bits(discretes...)
 	return nil
 }
+
+// sourceDiscretes gets the current values from the discretes reader, and stores them in the cache
+func (s *server) sourceDiscretes(reader ReadBits, address int, count int) ([]bool, error) {
+	atomic := s.StartAtomic()
+	defer atomic.Complete()
+	if _, err := s.ReadDiscretes(atomic, address, count); err != nil {
+		return nil, err
+	}
+	values, err := reader(atomic, address, count)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != count {
+		return nil, ServerFailureErrorF("Discrete reader returned %v values but %v were requested", len(values), count)
+	}
+	return values, s.WriteDiscretes(atomic, address, values)
+}
@@ -27,7 +27,7 @@ func (s *server) x14ReadFileRecord(mb Modbus, request *dataReader, response *dat
 	for i := range reqs {
 		code, _ := request.byte()
 		if code != 0x06 {
-			return IllegalValueErrorF("Expected SubRequest reference 0x06 but got 0x%02x", code)
+			return IllegalAddressErrorF("Expected SubRequest reference 0x06 but got 0x%02x", code)
 		}
 		file, _ := request.word()
 		addr, _ := request.word()
@@ -36,16 +36,18 @@ func (s *server) x14ReadFileRecord(mb Modbus, request *dataReader, response *dat
 		xsize += 2 + count*2
 	}
 
-	if xsize > 253 { //(PDU limit)
-		return IllegalFunctionErrorF("File Record Requests will exceed limit of payload, max 253, requested %v", xsize)
+	// the response PDU is the function code and the payload, and the byte count is a single byte, even with a larger
+	// maximum PDU size
+	if max := minInt(mb.MaxPDUSize(), 0xff+1); xsize+1 > max {
+		return IllegalValueErrorF("File Record Requests will exceed limit of PDU, max %v, requested %v", max, xsize+1)
 	}
 
-	atomic := s.StartAtomic()
-	defer atomic.Complete()
+	files := s.committed().Files
+	pad := s.padFileReads()
 
 	response.byte(xsize)
 	for _, req := range reqs {
-		recs, err := s.ReadFileRecords(atomic, req.file, req.address, req.count)
+		recs, err := readFileRecords(files, req.file, req.address, req.count, pad)
 		if err != nil {
 			return err
 		}
@@ -72,7 +74,7 @@ func (s *server) x15WriteFileRecord(mb Modbus, request *dataReader, response *da
 		}
 		code, _ := request.byte()
 		if code != 0x06 {
-			return IllegalValueErrorF("Expected SubRequest reference 0x06 but got 0x%02x", code)
+			return IllegalAddressErrorF("Expected SubRequest reference 0x06 but got 0x%02x", code)
 		}
 		file, _ := request.word()
 		addr, _ := request.word()
@@ -96,6 +98,9 @@ func (s *server) x15WriteFileRecord(mb Modbus, request *dataReader, response *da
 		}
 
 		repl, err := s.updateFiles(s, atomic, req.file, req.address, req.values, current)
+		if err != nil {
+			return err
+		}
 		err = s.WriteFileRecords(atomic, req.file, req.address, repl)
 		if err != nil {
 			return err
@@ -0,0 +1,118 @@
+package modbus
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUpdateFileError(t *testing.T) {
+	client, server := newTestServer(t)
+	server.RegisterFiles(2, func(server Server, atomic Atomic, file int, address int, values []int, current []int) ([]int, error) {
+		if file == 1 {
+			return nil, IllegalValueErrorF("File %v is read only", file)
+		}
+		return nil, errors.New("rejected")
+	})
+	if _, err := client.WriteFileRecords(1, 0, []int{1, 2, 3}, time.Second); exceptionCode(err) != 3 {
+		t.Fatalf("Expected an Illegal Data Value exception from the handler, not %v", err)
+	}
+	if _, err := client.WriteFileRecords(0, 0, []int{1, 2, 3}, time.Second); exceptionCode(err) != 4 {
+		t.Fatalf("Expected a Server Failure exception from the handler, not %v", err)
+	}
+	// nothing is written when the handler fails
+	read, err := client.ReadFileRecords(1, 0, 3, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Values) != 0 {
+		t.Fatalf("Expected the rejected records to not be written, not %v", read.Values)
+	}
+}
+
+func TestPadFileReads(t *testing.T) {
+	client, server := newTestServer(t)
+	server.RegisterFiles(2, func(server Server, atomic Atomic, file int, address int, values []int, current []int) ([]int, error) {
+		return values, nil
+	})
+	for _, pad := range []bool{false, true} {
+		server.PadFileReads(pad)
+		read, err := client.ReadFileRecords(1, 0, 15, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := 0
+		if pad {
+			expect = 15
+		}
+		if len(read.Values) != expect {
+			t.Fatalf("Expected %v records with padding %v, not %v", expect, pad, read.Values)
+		}
+		for _, v := range read.Values {
+			if v != 0 {
+				t.Fatalf("Expected the padded records to be 0, not %v", read.Values)
+			}
+		}
+	}
+}
+
+func TestFileRecordPDULimits(t *testing.T) {
+	clientSide, serverSide := NewLoopback()
+	defer clientSide.Close()
+	server, _ := NewServer([]byte{1}, []string{"a", "b", "c"})
+	server.RegisterFiles(2, func(server Server, atomic Atomic, file int, address int, values []int, current []int) ([]int, error) {
+		return values, nil
+	})
+	server.PadFileReads(true)
+	serverSide.SetServer(1, server)
+	client := clientSide.GetClient(1)
+	setLimit := func(size int) {
+		clientSide.SetMaxPDUSize(size)
+		serverSide.SetMaxPDUSize(size)
+	}
+	readRequest := func(length int) []int {
+		return []int{0x07, 0x06, 0x00, 0x01, 0x00, 0x00, length >> 8, length & 0xff}
+	}
+
+	tests := []struct {
+		limit  int
+		length int
+	}{
+		// a response of 4 + 2 * length bytes: exactly the limit of the PDU
+		{252, 124},
+		// and of the byte count, with a larger PDU
+		{1024, 126},
+	}
+	for _, test := range tests {
+		setLimit(test.limit)
+		got, err := client.ReadFileRecords(1, 0, test.length, time.Second)
+		if err != nil {
+			t.Fatalf("Expected a read of %v records with a limit of %v to succeed: %v", test.length, test.limit, err)
+		}
+		if len(got.Values) != test.length {
+			t.Fatalf("Expected %v records, not %v", test.length, len(got.Values))
+		}
+	}
+
+	// one byte over the limit of the PDU, and over the byte count
+	for _, test := range []struct{ limit, length int }{{251, 124}, {1024, 127}} {
+		setLimit(test.limit)
+		var mErr *Error
+		if _, err := client.ReadFileRecords(1, 0, test.length, time.Second); err == nil || errors.As(err, &mErr) {
+			t.Fatalf("Expected the client to reject a read of %v records with a limit of %v, not %v", test.length, test.limit, err)
+		}
+		if _, err := client.DebugRaw(0x14, readRequest(test.length), time.Second); exceptionCode(err) != 3 {
+			t.Fatalf("Expected the server to reject a read of %v records with a limit of %v, not %v", test.length, test.limit, err)
+		}
+	}
+
+	// a write request of 9 + 2 * length bytes, at and one byte over the limit of the PDU
+	setLimit(251)
+	if _, err := client.WriteFileRecords(1, 0, make([]int, 121), time.Second); err != nil {
+		t.Fatalf("Expected a write at the limit to succeed: %v", err)
+	}
+	setLimit(250)
+	if _, err := client.WriteFileRecords(1, 0, make([]int, 121), time.Second); err == nil {
+		t.Fatalf("Expected a write one byte over the limit to be rejected")
+	}
+}
@@ -1,17 +1,25 @@
 package modbus
 
-import (
-	"fmt"
-)
-
 func (s *server) x03ReadHoldingRegisters(mb Modbus, request *dataReader, response *dataBuilder) error {
 	addr, _ := request.word()
 	count, _ := request.word()
+	err := serverCheckQuantity("Read Holding Registers", count, 0x007d)
+	if err != nil {
+		return err
+	}
+	addr, err = s.mapAddress(0x03, addr)
+	if err != nil {
+		return err
+	}
 
-	atomic := s.StartAtomic()
-	defer atomic.Complete()
-
-	registers, err := s.ReadHoldings(atomic, addr, count)
+	var registers []int
+	if reader := s.holdingsReader(); reader != nil {
+		atomic := s.StartAtomic()
+		registers, err = s.sourceHoldings(atomic, reader, addr, count)
+		atomic.Complete()
+	} else {
+		registers, err = readCommittedWords("Holding", s.committed().Holdings, addr, count)
+	}
 	if err != nil {
 		return err
 	}
@@ -22,8 +30,27 @@ func (s *server) x03ReadHoldingRegisters(mb Modbus, request *dataReader, respons
 	return nil
 }
 
+// sourceHoldings gets the current values from the holdings reader, and stores them in the cache
+func (s *server) sourceHoldings(atomic Atomic, reader ReadWords, address int, count int) ([]int, error) {
+	if _, err := s.ReadHoldings(atomic, address, count); err != nil {
+		return nil, err
+	}
+	values, err := reader(atomic, address, count)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != count {
+		return nil, ServerFailureErrorF("Holding reader returned %v values but %v were requested", len(values), count)
+	}
+	return values, s.WriteHoldings(atomic, address, values)
+}
+
 func (s *server) xHoldingCommonWrite(atomic Atomic, addr int, values []int) error {
-	current, err := s.ReadHoldings(atomic, addr, 1)
+	current, err := s.ReadHoldings(atomic, addr, len(values))
+	if err != nil {
+		return err
+	}
+	err = s.checkProtected(KindHolding, addr, len(values))
 	if err != nil {
 		return err
 	}
@@ -35,17 +62,25 @@ func (s *server) xHoldingCommonWrite(atomic Atomic, addr int, values []int) erro
 
 	// Update the cache with the replacement values
 	err = s.WriteHoldings(atomic, addr, replacement)
-	return err
+	if err != nil {
+		return err
+	}
+	atomic.changed(KindHolding, addr, current, replacement)
+	return nil
 }
 
 func (s *server) x06WriteSingleHoldingRegister(mb Modbus, request *dataReader, response *dataBuilder) error {
 	addr, _ := request.word()
 	value, _ := request.word()
+	maddr, err := s.mapAddress(0x06, addr)
+	if err != nil {
+		return err
+	}
 
 	atomic := s.StartAtomic()
 	defer atomic.Complete()
 
-	err := s.xHoldingCommonWrite(atomic, addr, []int{value})
+	err = s.xHoldingCommonWrite(atomic, maddr, []int{value})
 	if err != nil {
 		return err
 	}
@@ -57,22 +92,30 @@ func (s *server) x06WriteSingleHoldingRegister(mb Modbus, request *dataReader, r
 func (s *server) x10WriteHoldingRegisters(mb Modbus, request *dataReader, response *dataBuilder) error {
 	addr, _ := request.word()
 	count, _ := request.word()
+	err := serverCheckQuantity("Write Multiple Registers", count, 0x007b)
+	if err != nil {
+		return err
+	}
 	bcnt, err := request.byte()
 	if err != nil {
 		return err
 	}
 	if bcnt != count*2 {
-		return fmt.Errorf("Expected %v bytes for %v registers, but got %v", count*2, count, bcnt)
+		return IllegalValueErrorF("Expected %v bytes for %v registers, but got %v", count*2, count, bcnt)
 	}
 	words, err := request.words(count)
 	if err != nil {
 		return err
 	}
+	maddr, err := s.mapAddress(0x10, addr)
+	if err != nil {
+		return err
+	}
 
 	atomic := s.StartAtomic()
 	defer atomic.Complete()
 
-	err = s.xHoldingCommonWrite(atomic, addr, words)
+	err = s.xHoldingCommonWrite(atomic, maddr, words)
 	if err != nil {
 		return err
 	}
@@ -85,18 +128,25 @@ func (s *server) x16MaskWriteHoldingRegister(mb Modbus, request *dataReader, res
 	addr, _ := request.word()
 	andMask, _ := request.word()
 	orMask, _ := request.word()
+	maddr, err := s.mapAddress(0x16, addr)
+	if err != nil {
+		return err
+	}
 
 	atomic := s.StartAtomic()
 	defer atomic.Complete()
 
-	value, err := s.ReadHoldings(atomic, addr, 1)
+	value, err := s.ReadHoldings(atomic, maddr, 1)
+	if err != nil {
+		return err
+	}
 	current := value[0]
 
 	// The function’s algorithm is:
 	// Result = (Current Contents AND And_Mask) OR (Or_Mask AND (NOT And_Mask))
 	result := (current & andMask) | (orMask & ^andMask)
 
-	err = s.xHoldingCommonWrite(atomic, addr, []int{result})
+	err = s.xHoldingCommonWrite(atomic, maddr, []int{result})
 	if err != nil {
 		return err
 	}
@@ -110,14 +160,30 @@ func (s *server) x17WriteReadHoldingRegisters(mb Modbus, request *dataReader, re
 	rcount, _ := request.word()
 	waddr, _ := request.word()
 	wcount, _ := request.word()
+	err := serverCheckQuantity("Read/Write Multiple Registers read", rcount, 0x007d)
+	if err != nil {
+		return err
+	}
+	err = serverCheckQuantity("Read/Write Multiple Registers write", wcount, 0x0079)
+	if err != nil {
+		return err
+	}
 	bcnt, _ := request.byte()
 	if bcnt != wcount*2 {
-		return fmt.Errorf("Expected %v bytes for %v registers, but got %v", wcount*2, wcount, bcnt)
+		return IllegalValueErrorF("Expected %v bytes for %v registers, but got %v", wcount*2, wcount, bcnt)
 	}
 	words, err := request.words(wcount)
 	if err != nil {
 		return err
 	}
+	raddr, err = s.mapAddress(0x17, raddr)
+	if err != nil {
+		return err
+	}
+	waddr, err = s.mapAddress(0x17, waddr)
+	if err != nil {
+		return err
+	}
 
 	atomic := s.StartAtomic()
 	defer atomic.Complete()
@@ -127,7 +193,13 @@ func (s *server) x17WriteReadHoldingRegisters(mb Modbus, request *dataReader, re
 		return err
 	}
 
-	registers, err := s.ReadHoldings(atomic, raddr, rcount)
+	// the read happens after the write, and gets the current values from the holdings reader if there is one
+	var registers []int
+	if reader := s.holdingsReader(); reader != nil {
+		registers, err = s.sourceHoldings(atomic, reader, raddr, rcount)
+	} else {
+		registers, err = s.ReadHoldings(atomic, raddr, rcount)
+	}
 	if err != nil {
 		return err
 	}
@@ -140,19 +212,36 @@ func (s *server) x17WriteReadHoldingRegisters(mb Modbus, request *dataReader, re
 
 func (s *server) x18ReadFIFO(mb Modbus, request *dataReader, response *dataBuilder) error {
 	addr, _ := request.word()
+	addr, err := s.mapAddress(0x18, addr)
+	if err != nil {
+		return err
+	}
 
-	atomic := s.StartAtomic()
-	defer atomic.Complete()
+	// read the count and the values from one state so that they are consistent: the committed state, or the current
+	// values from the holdings reader if there is one
+	var read func(address int, count int) ([]int, error)
+	if reader := s.holdingsReader(); reader != nil {
+		atomic := s.StartAtomic()
+		defer atomic.Complete()
+		read = func(address int, count int) ([]int, error) {
+			return s.sourceHoldings(atomic, reader, address, count)
+		}
+	} else {
+		holdings := s.committed().Holdings
+		read = func(address int, count int) ([]int, error) {
+			return readCommittedWords("Holding", holdings, address, count)
+		}
+	}
 
-	values, err := s.ReadHoldings(atomic, addr, 1)
+	values, err := read(addr, 1)
 	if err != nil {
 		return err
 	}
 	count := values[0]
-	if count > 31 {
-		return IllegalValueErrorF("Fifo can have at most 31 values, not %v", count)
+	if count < 0 || count > 31 {
+		return IllegalValueErrorF("Fifo can have 0 to 31 values, not %v", count)
 	}
-	data, err := s.ReadHoldings(atomic, addr+1, count)
+	data, err := read(addr+1, count)
 	if err != nil {
 		return err
 	}
@@ -7,10 +7,21 @@ func (s *server) x04ReadInputRegisters(mb Modbus, request *dataReader, response
 	}
 	addr, _ := request.word()
 	count, _ := request.word()
+	err = serverCheckQuantity("Read Input Registers", count, 0x007d)
+	if err != nil {
+		return err
+	}
+	addr, err = s.mapAddress(0x04, addr)
+	if err != nil {
+		return err
+	}
 
-	atomic := s.StartAtomic()
-	defer atomic.Complete()
-	inputs, err := s.ReadInputs(atomic, addr, count)
+	var inputs []int
+	if reader := s.inputsReader(); reader != nil {
+		inputs, err = s.sourceInputs(reader, addr, count)
+	} else {
+		inputs, err = readCommittedWords("Input", s.committed().Inputs, addr, count)
+	}
 	if err != nil {
 		return err
 	}
@@ -20,3 +31,20 @@ func (s *server) x04ReadInputRegisters(mb Modbus, request *dataReader, response
 	response.words(inputs...)
 	return nil
 }
+
+// sourceInputs gets the current values from the inputs reader, and stores them in the cache
+func (s *server) sourceInputs(reader ReadWords, address int, count int) ([]int, error) {
+	atomic := s.StartAtomic()
+	defer atomic.Complete()
+	if _, err := s.ReadInputs(atomic, address, count); err != nil {
+		return nil, err
+	}
+	values, err := reader(atomic, address, count)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != count {
+		return nil, ServerFailureErrorF("Input reader returned %v values but %v were requested", len(values), count)
+	}
+	return values, s.WriteInputs(atomic, address, values)
+}
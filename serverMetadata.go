@@ -3,13 +3,22 @@ package modbus
 import "fmt"
 
 func (s *server) x07ReadExceptionStatus(mb Modbus, request *dataReader, response *dataBuilder) error {
-	response.byte(0)
+	s.infoLock.RLock()
+	status := s.exceptionStatus
+	s.infoLock.RUnlock()
+	response.byte(status)
 	return nil
 }
 
 func (s *server) x11ReportServerID(mb Modbus, request *dataReader, response *dataBuilder) error {
-	tosend := bytesToInt([]byte(s.id))
-	tosend = append(tosend, 0xff)
+	s.infoLock.RLock()
+	tosend := bytesToInt(s.id)
+	run := 0xff
+	if s.stopped {
+		run = 0x00
+	}
+	s.infoLock.RUnlock()
+	tosend = append(tosend, run)
 	response.nbytes(tosend...)
 	return nil
 }
@@ -17,7 +26,8 @@ func (s *server) x11ReportServerID(mb Modbus, request *dataReader, response *dat
 func (s *server) x2bDeviceIdentification(mb Modbus, request *dataReader, response *dataBuilder) error {
 	sfn, _ := request.byte()
 	if sfn != 0x0e {
-		return IllegalValueErrorF("Do not support subfunction 0x%02x. Only Device Identification 0x0e", sfn)
+		// other MEI types are only supported if a handler is registered
+		return s.meiRequest(mb, sfn, request, response)
 	}
 	err := request.canRead(2)
 	if err != nil {
@@ -33,36 +43,38 @@ func (s *server) x2bDeviceIdentification(mb Modbus, request *dataReader, respons
 		return IllegalValueErrorF("Illegal ObjectId %v for Device Identification", oid)
 	}
 
+	s.infoLock.RLock()
+	deviceInfo := s.deviceInfo
+	s.infoLock.RUnlock()
+
 	origid := oid
-	if oid >= 0x80 {
-		oid = oid - 0x80 + 7
-	}
+	oid = deviceInfoIndex(oid)
 
-	if oid >= len(s.deviceInfo) {
+	if oid >= len(deviceInfo) {
 		return IllegalValueErrorF("No such ObjectId %v for Device Identification", origid)
 	}
 
-	if (code == 1 && oid > 2) || (code == 2 && (oid <= 2 || oid > 7)) || (code == 3 && oid <= 7) {
+	if (code == 1 && oid > 2) || (code == 2 && (oid <= 2 || oid >= 7)) || (code == 3 && oid < 7) {
 		return IllegalValueErrorF("Cannot get object ID %v with code %v", origid, code)
 	}
 
-	limits := []int{0, 3, 7, oid + 1, oid + 1}
+	limits := []int{0, 3, 7, len(deviceInfo), oid + 1}
 	max := limits[code]
-	if max > len(s.deviceInfo) {
-		max = len(s.deviceInfo)
+	if max > len(deviceInfo) {
+		max = len(deviceInfo)
 	}
 
 	conf := 1
-	if len(s.deviceInfo) > 3 {
+	if len(deviceInfo) > 3 {
 		conf = 2
 	}
-	if len(s.deviceInfo) > 7 {
+	if len(deviceInfo) > 7 {
 		conf = 3
 	}
 	conf += 0x80
 
-	tosend := s.deviceInfo[oid:max]
-	remaining := 252
+	tosend := deviceInfo[oid:max]
+	remaining := mb.MaxPDUSize() - 1
 	sent := make([][]byte, 0, len(tosend))
 	for _, di := range tosend {
 		dib := []byte(di)
@@ -100,9 +112,11 @@ func (s *server) x08Diagnostic(mb Modbus, request *dataReader, response *dataBui
 	case 0x00:
 		return s.diagEcho(request, response)
 	case 0x01:
-		return s.diagRestartComm(request, response)
+		return s.diagRestartComm(mb, request, response)
 	case 0x02:
 		return s.diagRegister(request, response)
+	case 0x04:
+		return s.diagListenOnly(mb, request, response)
 	case 0x0a:
 		return s.diagClearCounters(mb, request, response)
 	case 0x0b:
@@ -124,7 +138,7 @@ func (s *server) x08Diagnostic(mb Modbus, request *dataReader, response *dataBui
 	case 0x14:
 		return s.diagClearOverrunCounter(mb, request, response)
 	}
-	return IllegalValueErrorF("Unsupported diagnostic sub function %v", subfn)
+	return &Error{fmt.Sprintf("Unsupported diagnostic sub function %v", subfn), s.unsupportedDiagnosticException()}
 }
 
 func (s *server) diagEcho(request *dataReader, response *dataBuilder) error {
@@ -136,23 +150,45 @@ func (s *server) diagEcho(request *dataReader, response *dataBuilder) error {
 	return nil
 }
 
-func (s *server) diagRestartComm(request *dataReader, response *dataBuilder) error {
+func (s *server) diagRestartComm(mb Modbus, request *dataReader, response *dataBuilder) error {
 	code, err := request.word()
 	if err != nil {
 		return err
 	}
-	// TODO Restart comm - not applicable for this server, just ignore it....
+	if code != 0x0000 && code != 0xff00 {
+		return IllegalValueErrorF("diagRestartComm requires 0x0000 or 0xff00 input, not 0x%04x", code)
+	}
+	// There is no port to restart, but the counters are cleared, and the event log too if requested with 0xff00.
+	mb.clearDiagnostics()
+	mb.logEvent(busCommRestart)
+	if s.diag.restart(code == 0xff00) {
+		// leaving listen only mode, there is no response
+		return errNoResponse
+	}
 	response.word(code)
 	return nil
 }
 
+func (s *server) diagListenOnly(mb Modbus, request *dataReader, response *dataBuilder) error {
+	check, err := request.word()
+	if err != nil {
+		return err
+	}
+	if check != 0 {
+		return IllegalValueErrorF("diagListenOnly requires 0x0000 input, not 0x%04x", check)
+	}
+	s.diag.listenOnly(true)
+	mb.logEvent(busEnteredListenOnly)
+	return errNoResponse
+}
+
 func (s *server) diagRegister(request *dataReader, response *dataBuilder) error {
 	check, err := request.word()
 	if err != nil {
 		return err
 	}
 	if check != 0 {
-		return fmt.Errorf("diagRegister requires 0x0000 input")
+		return IllegalValueErrorF("diagRegister requires 0x0000 input, not 0x%04x", check)
 	}
 	// TODO Restart comm - not applicable for this server, just ignore it....
 	response.word(0)
@@ -165,7 +201,7 @@ func (s *server) diagClearCounters(mb Modbus, request *dataReader, response *dat
 		return err
 	}
 	if check != 0 {
-		return fmt.Errorf("diagClearCounters requires 0x0000 input")
+		return IllegalValueErrorF("diagClearCounters requires 0x0000 input, not 0x%04x", check)
 	}
 	s.diag.clear()
 	mb.clearDiagnostics()
@@ -179,7 +215,7 @@ func (s *server) diagClearOverrunCounter(mb Modbus, request *dataReader, respons
 		return err
 	}
 	if check != 0 {
-		return fmt.Errorf("diagClearOverrunCounter requires 0x0000 input")
+		return IllegalValueErrorF("diagClearOverrunCounter requires 0x0000 input, not 0x%04x", check)
 	}
 	s.diag.clear()
 	mb.clearOverrunCounter()
@@ -193,7 +229,7 @@ func (s *server) diagGenericCount(name string, val int, request *dataReader, res
 		return err
 	}
 	if check != 0 {
-		return fmt.Errorf("%v requires 0x0000 input", name)
+		return IllegalValueErrorF("%v requires 0x0000 input, not 0x%04x", name, check)
 	}
 	cnt := wordClamp(val)
 	response.word(cnt)
@@ -217,7 +253,7 @@ func (s *server) x0cCommEventLog(mb Modbus, request *dataReader, response *dataB
 	if s.Busy() {
 		busy = 0xffff
 	}
-	events := mb.getEventLog()
+	events := s.diag.getEventLog()
 	response.byte(len(events) + 6)
 	response.word(busy)
 	response.word(wordClamp(diag.EventCounter))
@@ -0,0 +1,39 @@
+package modbus
+
+import "fmt"
+
+func (s *server) ProtectHoldings(from int, count int) {
+	s.protect(KindHolding, from, count)
+}
+
+func (s *server) ProtectCoils(from int, count int) {
+	s.protect(KindCoil, from, count)
+}
+
+func (s *server) protect(kind RegisterKind, from int, count int) {
+	s.protectLock.Lock()
+	defer s.protectLock.Unlock()
+	s.protected[kind] = append(s.protected[kind], AddressRange{from, count})
+}
+
+func (s *server) SetProtectedException(code int) error {
+	if code != 1 && code != 2 {
+		return fmt.Errorf("Exception code %v is not valid: it must be 1 (Illegal Function) or 2 (Illegal Data Address)", code)
+	}
+	s.protectLock.Lock()
+	defer s.protectLock.Unlock()
+	s.protectErr = uint8(code)
+	return nil
+}
+
+// checkProtected returns an error if a remote write of count values from the address includes a protected address
+func (s *server) checkProtected(kind RegisterKind, address int, count int) error {
+	s.protectLock.Lock()
+	defer s.protectLock.Unlock()
+	for _, r := range s.protected[kind] {
+		if address < r.Address+r.Count && r.Address < address+count {
+			return &Error{fmt.Sprintf("%v: addresses %v to %v are write protected", kind, r.Address, r.Address+r.Count-1), s.protectErr}
+		}
+	}
+	return nil
+}
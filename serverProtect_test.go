@@ -0,0 +1,36 @@
+package modbus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProtectedWrites(t *testing.T) {
+	client, server := newTestServer(t)
+	server.RegisterHoldings(10, acceptHoldings)
+	server.RegisterCoils(10, acceptCoils)
+	server.ProtectHoldings(2, 3)
+	server.ProtectCoils(5, 1)
+
+	if _, err := client.WriteSingleHolding(3, 1, time.Second); exceptionCode(err) != 2 {
+		t.Fatalf("Expected a write to a protected holding register to get exception 2, not %v", err)
+	}
+	if _, err := client.WriteMultipleHoldings(0, []int{1, 2, 3}, time.Second); exceptionCode(err) != 2 {
+		t.Fatalf("Expected a write that overlaps protected holding registers to get exception 2, not %v", err)
+	}
+	if _, err := client.WriteMultipleCoils(4, []bool{true, true}, time.Second); exceptionCode(err) != 2 {
+		t.Fatalf("Expected a write that overlaps a protected coil to get exception 2, not %v", err)
+	}
+	// the addresses around the protected ranges are still writable
+	if _, err := client.WriteMultipleHoldings(0, []int{1, 2}, time.Second); err != nil {
+		t.Fatalf("Expected a write before the protected range to succeed: %v", err)
+	}
+	if _, err := client.WriteSingleCoil(6, true, time.Second); err != nil {
+		t.Fatalf("Expected a write after the protected coil to succeed: %v", err)
+	}
+	// and the protected values are unchanged
+	got, err := client.ReadHoldings(2, 3, time.Second)
+	if err != nil || got.Values[0] != 0 || got.Values[1] != 0 || got.Values[2] != 0 {
+		t.Fatalf("Expected the protected holding registers to be unchanged, not %v (%v)", got, err)
+	}
+}
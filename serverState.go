@@ -0,0 +1,161 @@
+package modbus
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ServerState is a copy of the complete memory model/cache of a Server at a point in time
+type ServerState struct {
+	Discretes []bool
+	Coils     []bool
+	Inputs    []int
+	Holdings  []int
+	Files     [][]int
+}
+
+// BitChange records a discrete or coil that has a different value in two ServerState snapshots
+type BitChange struct {
+	Address int
+	Before  bool
+	After   bool
+}
+
+func (c BitChange) String() string {
+	return fmt.Sprintf("0x%04x: %v -> %v", c.Address, c.Before, c.After)
+}
+
+// WordChange records an input or holding register that has a different value in two ServerState snapshots
+type WordChange struct {
+	Address int
+	Before  int
+	After   int
+}
+
+func (c WordChange) String() string {
+	return fmt.Sprintf("0x%04x: 0x%04x -> 0x%04x", c.Address, c.Before, c.After)
+}
+
+// RecordChange records a file record that has a different value in two ServerState snapshots
+type RecordChange struct {
+	File   int
+	Record int
+	Before int
+	After  int
+}
+
+func (c RecordChange) String() string {
+	return fmt.Sprintf("0x%04x->0x%04x: 0x%04x -> 0x%04x", c.File, c.Record, c.Before, c.After)
+}
+
+// StateDiff contains just the values that changed between two ServerState snapshots. Values that only exist in one of
+// the snapshots are compared as if they were false (or 0) in the other.
+type StateDiff struct {
+	Discretes []BitChange
+	Coils     []BitChange
+	Inputs    []WordChange
+	Holdings  []WordChange
+	Files     []RecordChange
+}
+
+// Empty returns true if there are no changes in the diff
+func (d StateDiff) Empty() bool {
+	return len(d.Discretes) == 0 && len(d.Coils) == 0 && len(d.Inputs) == 0 && len(d.Holdings) == 0 && len(d.Files) == 0
+}
+
+func (d StateDiff) String() string {
+	parts := make([]string, 0)
+	for _, c := range d.Discretes {
+		parts = append(parts, fmt.Sprintf("  Discrete %v", c))
+	}
+	for _, c := range d.Coils {
+		parts = append(parts, fmt.Sprintf("  Coil %v", c))
+	}
+	for _, c := range d.Inputs {
+		parts = append(parts, fmt.Sprintf("  Input %v", c))
+	}
+	for _, c := range d.Holdings {
+		parts = append(parts, fmt.Sprintf("  Holding %v", c))
+	}
+	for _, c := range d.Files {
+		parts = append(parts, fmt.Sprintf("  File %v", c))
+	}
+	return fmt.Sprintf("StateDiff %v changes\n%v", len(parts), strings.Join(parts, "\n"))
+}
+
+func (s *server) Snapshot() ServerState {
+	cret := make(chan ServerState)
+	atomic := s.StartAtomic()
+	defer atomic.Complete()
+	atomic.execute(func() {
+		defer close(cret)
+		files := make([][]int, len(s.files))
+		for i, f := range s.files {
+			files[i] = append(make([]int, 0), f...)
+		}
+		cret <- ServerState{
+			Discretes: append(make([]bool, 0), s.discretes...),
+			Coils:     append(make([]bool, 0), s.coils...),
+			Inputs:    append(make([]int, 0), s.inputs...),
+			Holdings:  append(make([]int, 0), s.holdings...),
+			Files:     files,
+		}
+	})
+	return <-cret
+}
+
+// DiffServerState compares two snapshots (typically taken before and after some operation) and reports only the
+// values that are different.
+func DiffServerState(a, b ServerState) StateDiff {
+	d := StateDiff{}
+	d.Discretes = diffBits(a.Discretes, b.Discretes)
+	d.Coils = diffBits(a.Coils, b.Coils)
+	d.Inputs = diffWords(a.Inputs, b.Inputs)
+	d.Holdings = diffWords(a.Holdings, b.Holdings)
+	files := len(a.Files)
+	if len(b.Files) > files {
+		files = len(b.Files)
+	}
+	for f := 0; f < files; f++ {
+		var before, after []int
+		if f < len(a.Files) {
+			before = a.Files[f]
+		}
+		if f < len(b.Files) {
+			after = b.Files[f]
+		}
+		for _, c := range diffWords(before, after) {
+			d.Files = append(d.Files, RecordChange{f, c.Address, c.Before, c.After})
+		}
+	}
+	return d
+}
+
+func diffBits(a, b []bool) []BitChange {
+	var ret []BitChange
+	for i := 0; i < len(a) || i < len(b); i++ {
+		before := i < len(a) && a[i]
+		after := i < len(b) && b[i]
+		if before != after {
+			ret = append(ret, BitChange{i, before, after})
+		}
+	}
+	return ret
+}
+
+func diffWords(a, b []int) []WordChange {
+	var ret []WordChange
+	for i := 0; i < len(a) || i < len(b); i++ {
+		before, after := 0, 0
+		if i < len(a) {
+			before = a[i]
+		}
+		if i < len(b) {
+			after = b[i]
+		}
+		if before != after {
+			ret = append(ret, WordChange{i, before, after})
+		}
+	}
+	return ret
+}
@@ -0,0 +1,139 @@
+package modbus
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestServer returns a client for unit 1 of a loopback, and the server that handles unit 1
+func newTestServer(t *testing.T) (Client, Server) {
+	clientSide, serverSide := NewLoopback()
+	t.Cleanup(func() { clientSide.Close() })
+	server, err := NewServer([]byte{1}, []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverSide.SetServer(1, server)
+	return clientSide.GetClient(1), server
+}
+
+// acceptHoldings is an UpdateHoldings handler that accepts all the values that are written
+func acceptHoldings(server Server, atomic Atomic, address int, values []int, current []int) ([]int, error) {
+	return values, nil
+}
+
+// acceptCoils is an UpdateCoils handler that accepts all the values that are written
+func acceptCoils(server Server, atomic Atomic, address int, values []bool, current []bool) ([]bool, error) {
+	return values, nil
+}
+
+func TestResponseDelayHoldsSlot(t *testing.T) {
+	client, server := newTestServer(t)
+	server.SetResponseDelay(100*time.Millisecond, 100*time.Millisecond)
+	server.SetMaxConcurrentRequests(1)
+
+	slow := make(chan error)
+	go func() {
+		_, err := client.ReadExceptionStatus(time.Second)
+		slow <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if _, err := client.ReadExceptionStatus(time.Second); exceptionCode(err) != 6 {
+		t.Fatalf("Expected Server Busy while the first request is delayed, not %v", err)
+	}
+	if err := <-slow; err != nil {
+		t.Fatalf("Expected the delayed request to succeed: %v", err)
+	}
+}
+
+func TestHoldingsReader(t *testing.T) {
+	client, server := newTestServer(t)
+	server.RegisterHoldings(10, acceptHoldings)
+	// the reader adds 100 to the cached values, so the reads through it can be identified
+	server.RegisterHoldingsReader(10, func(atomic Atomic, address int, count int) ([]int, error) {
+		current, err := server.ReadHoldings(atomic, address, count)
+		if err != nil {
+			return nil, err
+		}
+		ret := make([]int, count)
+		for i, v := range current {
+			ret[i] = v + 100
+		}
+		return ret, nil
+	})
+
+	got, err := client.ReadHoldings(0, 2, time.Second)
+	if err != nil || got.Values[0] != 100 || got.Values[1] != 100 {
+		t.Fatalf("Expected the holdings from the reader, not %v (%v)", got, err)
+	}
+	wr, err := client.WriteReadMultipleHoldings(4, 2, 4, []int{1, 2}, time.Second)
+	if err != nil || wr.Values[0] != 101 || wr.Values[1] != 102 {
+		t.Fatalf("Expected the read of Write/Read Multiple to use the reader, not %v (%v)", wr, err)
+	}
+}
+
+func TestRegisterReaderWhileReading(t *testing.T) {
+	client, server := newTestServer(t)
+	server.RegisterInputs(10)
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			client.ReadInputs(0, 2, time.Second)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		server.RegisterInputsReader(10, func(atomic Atomic, address int, count int) ([]int, error) {
+			return make([]int, count), nil
+		})
+	}
+	<-done
+}
+
+func TestUnsupportedDiagnosticException(t *testing.T) {
+	client, server := newTestServer(t)
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		server.SetUnsupportedDiagnosticException(1)
+	}()
+	client.DiagnosticCount(Diagnostic(0x13), time.Second)
+	<-done
+	if _, err := client.DiagnosticCount(Diagnostic(0x13), time.Second); exceptionCode(err) != 1 {
+		t.Fatalf("Expected the unsupported sub-function to get exception 1, not %v", err)
+	}
+}
+
+func TestBusyWhileHandling(t *testing.T) {
+	client, server := newTestServer(t)
+	entered := make(chan bool)
+	release := make(chan bool)
+	server.RegisterHoldings(10, func(server Server, atomic Atomic, address int, values []int, current []int) ([]int, error) {
+		entered <- true
+		<-release
+		return values, nil
+	})
+	if got, err := client.CommEventCounter(time.Second); err != nil || got.Busy {
+		t.Fatalf("Expected the idle server to not be busy, not %v %v", got, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.WriteSingleHolding(0, 1, time.Second)
+		done <- err
+	}()
+	<-entered
+	if !server.Busy() {
+		t.Fatalf("Expected the server to be busy while the write is handled")
+	}
+	if got, err := client.CommEventCounter(time.Second); err != nil || !got.Busy {
+		t.Fatalf("Expected the event counter to report busy while the write is handled, not %v %v", got, err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if server.Busy() {
+		t.Fatalf("Expected the server to not be busy once the write is handled")
+	}
+}
@@ -1,22 +1,58 @@
 package modbus
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type tcpFrame []uint8
 
+// TCPOptions configures the TCP connection that a Modbus instance communicates over. Start from DefaultTCPOptions
+// and change the settings that need to be different. See NewTCPWithOptions
+type TCPOptions struct {
+	// KeepAlivePeriod is the time between TCP keepalive probes, which detect peers that have gone away. A period of 0
+	// (or less) disables keepalive.
+	KeepAlivePeriod time.Duration
+	// NoDelay sends each frame as soon as it is written, instead of waiting to combine it with later data.
+	NoDelay bool
+	// DialTimeout limits how long it takes to establish the connection. A timeout of 0 waits until the operating
+	// system gives up.
+	DialTimeout time.Duration
+	// ReadTimeout is how long to wait for the rest of a frame once the start of it is received, after that the partial
+	// frame is discarded. A timeout of 0 (or less) uses the default of 1 second.
+	ReadTimeout time.Duration
+}
+
+// DefaultTCPOptions are the options used by NewTCP, NewTCPConn, and the connections that a TCPServer accepts.
+var DefaultTCPOptions = TCPOptions{
+	KeepAlivePeriod: 60 * time.Second,
+	NoDelay:         true,
+	ReadTimeout:     time.Second,
+}
+
+// readTimeout is the partial frame timeout, with the default applied.
+func (o TCPOptions) readTimeout() time.Duration {
+	if o.ReadTimeout <= 0 {
+		return time.Second
+	}
+	return o.ReadTimeout
+}
+
 type tcp struct {
 	name string
+	// the largest PDU that is framed
+	pduLimit
 	host string
 	port int
-	conn *net.TCPConn
+	conn net.Conn
+	opts TCPOptions
 	// Write to this channel to queue frames to send
 	toTX chan adu
 	// Frames off the wire will be readable from this channel
@@ -26,21 +62,60 @@ type tcp struct {
 	// a channel that is closed if we are not open ;)
 	closed chan bool
 	diag   *busDiagnosticManager
+	// when retry is set, the connection to hostport is re-established after a failure
+	hostport string
+	retry    time.Duration
+	// conn is replaced when a connection is re-established
+	lock sync.Mutex
+	bus  *modbus
+	wlog wireLog
+	log  logSink
+	// onClose is called when the reader terminates, with the error that failed the connection, if any
+	onClose func(err error)
 }
 
 // NewTCPConn establishes a Modbus transceiver based on a TCP connection
 func NewTCPConn(conn *net.TCPConn) (Modbus, error) {
-	err := conn.SetKeepAlivePeriod(time.Second * 60)
+	return NewConn(conn)
+}
+
+/*
+NewConn establishes a Modbus transceiver that sends and receives Modbus/TCP frames (with the MBAP header) on any
+connection, for example a TLS connection, a Unix socket, or a net.Pipe in tests. The DefaultTCPOptions are applied if
+the connection is a TCP connection (or a TLS connection over TCP).
+*/
+func NewConn(conn net.Conn) (Modbus, error) {
+	t, err := newTCP(conn, DefaultTCPOptions)
 	if err != nil {
-		conn.Close()
 		return nil, err
 	}
-	err = conn.SetKeepAlive(true)
+	return t.start(nil), nil
+}
+
+// configureTCPConn applies the options to the TCP connection, which may be under a TLS connection.
+func configureTCPConn(conn net.Conn, opts TCPOptions) error {
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if opts.KeepAlivePeriod > 0 {
+		err := tc.SetKeepAlivePeriod(opts.KeepAlivePeriod)
+		if err != nil {
+			return err
+		}
+	}
+	err := tc.SetKeepAlive(opts.KeepAlivePeriod > 0)
 	if err != nil {
-		conn.Close()
-		return nil, err
+		return err
 	}
-	err = conn.SetNoDelay(true)
+	return tc.SetNoDelay(opts.NoDelay)
+}
+
+func newTCP(conn net.Conn, opts TCPOptions) (*tcp, error) {
+	err := configureTCPConn(conn, opts)
 	if err != nil {
 		conn.Close()
 		return nil, err
@@ -48,26 +123,42 @@ func NewTCPConn(conn *net.TCPConn) (Modbus, error) {
 
 	t := &tcp{}
 	t.conn = conn
+	t.opts = opts
 	t.name = conn.RemoteAddr().String()
-	pos := strings.LastIndex(t.name, ":")
-	t.port, _ = strconv.Atoi(t.name[pos+1:])
-	t.host = t.name[:pos]
+	// not all connections have a host and port, a pipe for example
+	if pos := strings.LastIndex(t.name, ":"); pos >= 0 {
+		t.port, _ = strconv.Atoi(t.name[pos+1:])
+		t.host = t.name[:pos]
+	}
 	t.isopen = true
 	t.closed = make(chan bool, 0)
 	t.toDemux = make(chan adu, 0)
 	t.toTX = make(chan adu, 0)
 	t.diag = newBusDiagnosticManager()
+	return t, nil
+}
+
+// start begins communicating on the connection. The servers are set before any requests are read, so that the first
+// requests are routed to the right server.
+func (t *tcp) start(servers map[byte]Server) Modbus {
+	t.bus = newModbus(t.toTX, t.toDemux, t, t.diag)
+	t.bus.log.set(t.log.get())
+	for u, s := range servers {
+		t.bus.SetServer(int(u), s)
+	}
 
 	// start a go routine that reads bytes off the serial device
 	go t.wireReader()
 	// start a go routine that writes bytes to the serial device
 	go t.wireWriter()
 
-	closer := func() error {
-		return t.close()
-	}
+	return t.bus
+}
 
-	return newModbus(t.toTX, t.toDemux, closer, t.diag), nil
+func (t *tcp) connection() net.Conn {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.conn
 }
 
 // Close shuts down all communication over the given wires
@@ -78,21 +169,93 @@ func (t *tcp) close() error {
 	t.isopen = false
 	// closing this channel means that anyone readong from the channel is auto-selected in a Select statement
 	close(t.closed)
-	t.conn.Close()
+	t.connection().Close()
 	return nil
 }
 
-// wireRead takes data off the wire, and submits complete frames to the RTU.rx channel.
-// It manages the TX idle timer as well, so that we cannot send data until the bus is idle.
+func (t *tcp) setWireLogger(logger WireLogger) {
+	t.wlog.setLogger(logger, t.closed)
+}
+
+func (t *tcp) setLogger(logger Logger) {
+	t.log.set(logger)
+}
+
+// reconnect replaces a failed connection with a new connection to the same remote host, retrying until it succeeds
+// or the tcp is closed. It returns false if the tcp is closed.
+func (t *tcp) reconnect() bool {
+	t.connection().Close()
+	for {
+		select {
+		case <-t.closed:
+			return false
+		case <-time.After(t.retry):
+		}
+		conn, err := dialTCP(t.hostport, t.opts.DialTimeout)
+		if err == nil {
+			err = configureTCPConn(conn, t.opts)
+			if err != nil {
+				conn.Close()
+			}
+		}
+		if err != nil {
+			t.log.Errorf("Unable to reconnect to %v: %v", t.hostport, err)
+			continue
+		}
+		t.lock.Lock()
+		t.conn = conn
+		t.lock.Unlock()
+		select {
+		case <-t.closed:
+			// closed while we were connecting
+			conn.Close()
+			return false
+		default:
+		}
+		t.log.Debugf("Reconnected to %v", t.hostport)
+		return true
+	}
+}
+
+// wireReader reads frames from the connection. If the connection fails, it is either re-established (and pending
+// requests fail immediately), or the tcp is closed.
 func (t *tcp) wireReader() {
+	var failure error
+	for {
+		err := t.readFrames(t.connection())
+		select {
+		case <-t.closed:
+			err = nil
+		default:
+		}
+		if err == nil || t.retry <= 0 {
+			if err != nil {
+				t.log.Errorf("Shutting down reading: %v", err)
+			}
+			failure = err
+			t.close()
+			break
+		}
+		t.log.Errorf("Connection to %v failed, retrying: %v", t.name, err)
+		t.bus.failPending(fmt.Errorf("Connection to %v reset, retrying: %w", t.name, err))
+		if !t.reconnect() {
+			break
+		}
+	}
+	t.log.Debugf("Terminating tcp reader %s: closed", t.name)
+	if t.onClose != nil {
+		t.onClose(failure)
+	}
+}
+
+// readFrames takes data off the connection, and submits complete frames to the demuxer until the connection fails.
+func (t *tcp) readFrames(conn net.Conn) error {
 	noDeadline := time.Time{}
-	buffer := make([]uint8, 300)
+	buffer := make([]uint8, mbapOverhead+maxPDUSizeLimit)
 
-	err := t.conn.SetReadDeadline(noDeadline)
+	err := conn.SetReadDeadline(noDeadline)
 	if err != nil {
-		fmt.Printf("Shutting down reading: %v\n", err)
-		t.close()
-		return
+		return err
 	}
 
 	/*
@@ -101,40 +264,51 @@ func (t *tcp) wireReader() {
 	*/
 
 	got := 0
-	expect := 7
+	expect := mbapOverhead
 	ok := true
 	for {
 		n := 0
 		if got < expect {
 			// there may be a delay set on this read if there's more data needed to read a frame.
-			n, err = t.conn.Read(buffer[got:])
+			n, err = conn.Read(buffer[got:])
 			if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
-				fmt.Printf("Shutting down reading: %v\n", err)
-				t.close()
-				break
+				return err
 			}
+			timedOut := err != nil
 			// if there was a deadline, we remove it.
-			err := t.conn.SetReadDeadline(noDeadline)
+			err := conn.SetReadDeadline(noDeadline)
 			if err != nil {
-				fmt.Printf("Shutting down reading: %v\n", err)
-				t.close()
-				break
+				return err
+			}
+			if timedOut {
+				// the rest of the frame never arrived, discard the partial frame and start again with the next one
+				t.log.Errorf("Timeout in partial frame on %s, discarding %d bytes", t.name, got+n)
+				t.diag.commError()
+				got = 0
+				expect = mbapOverhead
+				continue
 			}
 		}
 		got += n
-		if got >= 7 {
+		if got >= mbapOverhead {
 			// we have enough data for some initial checks.
 			if ck := getWord(buffer, 2); ck != 0 {
-				fmt.Printf("Expect MODBUS protocol 0 top be set. Not 0x%04x\n", ck)
+				t.log.Errorf("Expect MODBUS protocol 0 top be set. Not 0x%04x", ck)
 				ok = false
 				t.diag.commError()
 			}
-			if pduszp := getWord(buffer, 4) - 1; pduszp > 253 {
-				fmt.Printf("Expect PDU Payload to not exceed 253 bytes. Not 0x%04x\n", pduszp)
+			// the length in the header includes the unit ID
+			pduszp := int(getWord(buffer, 4)) - 1
+			if max := t.maxPDUSize(); pduszp > max {
+				t.log.Errorf("Expect PDU Payload to not exceed %d bytes. Not 0x%04x", max, pduszp)
 				ok = false
 				t.diag.overrun()
+			} else if pduszp < 1 {
+				t.log.Errorf("Expect PDU Payload to have a function code. Not 0x%04x", pduszp)
+				ok = false
+				t.diag.commError()
 			} else {
-				expect = int(pduszp) + 7
+				expect = pduszp + mbapOverhead
 			}
 		}
 		if ok {
@@ -142,8 +316,9 @@ func (t *tcp) wireReader() {
 				// we have a full frame of data.... perhaps more.
 				frame := make([]uint8, expect)
 				copy(frame, buffer)
+				t.wlog.log(Received, frame)
 				// frame is populated, let's send it to the handler.
-				if validFrame(t.name, frame) {
+				if t.validFrame(frame) {
 					f := decodeTCPFrame(frame)
 					t.diag.message(f.unit == 0)
 					t.toDemux <- f
@@ -152,20 +327,19 @@ func (t *tcp) wireReader() {
 				copy(buffer, buffer[expect:got])
 				// reset our counters to read the next frame
 				got = got - expect
-				expect = 7
+				expect = mbapOverhead
 			} else {
 				// we expect more data.......
 				// for the remaining data, we have a read timeout.
-				t.conn.SetReadDeadline(time.Now().Add(time.Second))
+				conn.SetReadDeadline(time.Now().Add(t.opts.readTimeout()))
 			}
 		} else {
-			// problem with the frame
-			n = 0
+			// problem with the frame, discard what we have and start again with the next one
 			got = 0
-			expect = 7
+			expect = mbapOverhead
+			ok = true
 		}
 	}
-	fmt.Printf("Terminating tcp reader %s: closed\n", t.name)
 }
 
 // wireWriter takes data off the wire, and submits complete frames to the RTU.rx channel.
@@ -184,29 +358,35 @@ func (t *tcp) wireWriter() {
 				t.diag.response(ta.pdu)
 			}
 			f := buildTCPFrame(ta)
+			t.wlog.log(Sent, f)
+			conn := t.connection()
 			for len(f) > 0 {
-				if n, err := t.conn.Write(f); err != nil {
+				if n, err := conn.Write(f); err != nil {
 					// fmt.Printf("Unable to send bytes to %s: %s\n", rtu.name, err)
 					f = f[:0]
+					if t.retry > 0 {
+						// the reader will re-establish the connection, and in the mean time the request cannot succeed.
+						conn.Close()
+					}
 				} else {
 					f = f[n:]
 				}
 			}
 		}
 	}
-	fmt.Printf("Terminating TCP writer %s: closed\n", t.name)
+	t.log.Debugf("Terminating TCP writer %s: closed", t.name)
 }
 
-func validFrame(name string, tdata []byte) bool {
+func (t *tcp) validFrame(tdata []byte) bool {
 	if len(tdata) == 0 {
 		return false
 	}
-	if len(tdata) < 7 {
-		fmt.Printf("Too small of a frame on %s, just %d bytes\n", name, len(tdata))
+	if len(tdata) < mbapOverhead+1 {
+		t.log.Errorf("Too small of a frame on %s, just %d bytes", t.name, len(tdata))
 		return false
 	}
-	if len(tdata) > 260 {
-		fmt.Printf("Too large of a frame on %s, %d exceeds 260 bytes\n", name, len(tdata))
+	if limit := mbapOverhead + t.maxPDUSize(); len(tdata) > limit {
+		t.log.Errorf("Too large of a frame on %s, %d exceeds %d bytes", t.name, len(tdata), limit)
 		return false
 	}
 	return true
@@ -1,7 +1,9 @@
 package modbus
 
 import (
+	"crypto/tls"
 	"net"
+	"time"
 )
 
 // NewTCP establishes a connection to a remote IP and port using TCP then returns a Modbus instance on that TCP channel
@@ -9,16 +11,71 @@ import (
 //
 // e.g. NewTCP("192.168.1.10:502")
 func NewTCP(hostport string) (Modbus, error) {
-	addr, err := net.ResolveTCPAddr("tcp", hostport)
+	return NewTCPWithOptions(hostport, DefaultTCPOptions)
+}
+
+// NewTCPWithOptions establishes a connection to a remote IP and port using TCP like NewTCP, but with the given
+// keepalive, delay, and timeout options instead of DefaultTCPOptions.
+func NewTCPWithOptions(hostport string, opts TCPOptions) (Modbus, error) {
+	conn, err := dialTCP(hostport, opts.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	t, err := newTCP(conn, opts)
 	if err != nil {
 		return nil, err
 	}
+	return t.start(nil), nil
+}
 
-	// dial from any local interface to the remote address
-	conn, err := net.DialTCP("tcp", nil, addr)
+/*
+NewTCPReconnecting establishes a connection to a remote IP and port using TCP like NewTCP, but if the connection fails
+(for example the remote gateway reboots), a new connection is established (retrying every retry period) without the
+need to recreate the Modbus instance or its clients. Requests that are waiting for a response when the connection fails
+return an error immediately instead of waiting for their timeout.
+
+e.g. NewTCPReconnecting("192.168.1.10:502", 5*time.Second)
+*/
+func NewTCPReconnecting(hostport string, retry time.Duration) (Modbus, error) {
+	if retry <= 0 {
+		retry = time.Second
+	}
+	conn, err := dialTCP(hostport, DefaultTCPOptions.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	t, err := newTCP(conn, DefaultTCPOptions)
 	if err != nil {
 		return nil, err
 	}
+	t.hostport = hostport
+	t.retry = retry
+	return t.start(nil), nil
+}
+
+/*
+NewTCPTLS establishes a TLS connection to a remote IP and port for devices that implement the Modbus/TCP Security
+protocol (normally on port 802), then returns a Modbus instance on that connection. The Modbus/TCP Security protocol
+requires TLS 1.2 or later, and that both sides authenticate with certificates, so the cfg would normally have the client
+certificate set, and the certificate authority for the remote device in RootCAs.
 
-	return NewTCPConn(conn)
+e.g. NewTCPTLS("192.168.1.10:802", cfg)
+*/
+func NewTCPTLS(hostport string, cfg *tls.Config) (Modbus, error) {
+	dialer := &net.Dialer{Timeout: DefaultTCPOptions.DialTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", hostport, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(conn)
+}
+
+func dialTCP(hostport string, timeout time.Duration) (*net.TCPConn, error) {
+	// dial from any local interface to the remote address
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.Dial("tcp", hostport)
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.TCPConn), nil
 }
@@ -1,9 +1,10 @@
 package modbus
 
 import (
-	"fmt"
+	"crypto/tls"
 	"io"
 	"net"
+	"sync"
 )
 
 // TCPServer represents a mechanism for receiving connections from remote clients.
@@ -14,13 +15,41 @@ type TCPServer interface {
 	// WaitClosed will simply wait until the TCP server is closed. This is useful for creating
 	// programs that don't exit until the listener is terminated.
 	WaitClosed()
+	// SetLogger sets the Logger that the diagnostic messages from the TCP service, and from the Modbus instances of the
+	// connections it accepts after the call, are sent to. By default nothing is logged.
+	SetLogger(logger Logger)
+	// Connections returns the number of connections that are currently open.
+	Connections() int
+}
+
+// TCPServerOptions controls which connections a TCPServer accepts, and reports the connections that start and end. See
+// NewTCPServerWithOptions
+type TCPServerOptions struct {
+	// Allow is called with the remote address of each new connection, and the connection is closed immediately if it
+	// returns false. A nil Allow accepts connections from any address.
+	Allow func(remote net.Addr) bool
+	// MaxConnections is the most connections that can be open at once, further connections are closed immediately
+	// until an open connection ends. A limit of 0 (or less) allows any number of connections.
+	MaxConnections int
+	// OnConnect is called with the remote address of each connection that is accepted, before it handles requests.
+	OnConnect func(remote net.Addr)
+	// OnDisconnect is called with the remote address of each accepted connection when it ends. The err is why it
+	// ended: io.EOF if the remote client closed it, or nil if it was closed locally.
+	OnDisconnect func(remote net.Addr, err error)
+	// OnConnectModbus is called with the Modbus instance of each connection that is accepted, once it has started.
+	// Use it to act as a client to the remote device too (with mb.GetClient), or to inspect mb.Diagnostics().
+	OnConnectModbus func(remote net.Addr, mb Modbus)
 }
 
 type tcpServer struct {
-	tcpl    *net.TCPListener
+	tcpl    net.Listener
 	host    string
 	servers map[byte]Server
+	opts    TCPServerOptions
 	closed  chan bool
+	log     logSink
+	lock    sync.Mutex
+	active  int
 }
 
 // ServeAllUnits is a convenience function to map a Modbus Server instance on to all unitID addresses.
@@ -41,12 +70,50 @@ Example bind to just localhost: NewModbusTCPListener("localhost:502", demux)
 Note that this function accepts a UnitID to Server mapping. Any connections to this server will be initialized
 with the supplied servers serving requests to the matching UnitID. It's normal for Modbus-TCP to have 1 server
 instance hosting ALL the UnitID addresses on the bus. The standard is to listen on UnitID 0xff. This is made
-more convenient with the ServeAllUnits(server) function.const
+more convenient with the ServeAllUnits(server) function. If servers are given for specific UnitIDs as well as 0xff,
+the specific server handles requests for its UnitID, and the 0xff server handles the rest.
 
 	tcpserv, _ := modbus.NewTCPServer(":502", modbus.ServeAllUnits(server))
 
 */
 func NewTCPServer(host string, servers map[int]Server) (TCPServer, error) {
+	return NewTCPServerWithOptions(host, servers, TCPServerOptions{})
+}
+
+/*
+NewTCPServerWithOptions establishes a listening socket like NewTCPServer, but only accepts the connections that the
+opts allow. For example, to accept at most 4 connections, and only from the local network:
+
+	_, local, _ := net.ParseCIDR("192.168.1.0/24")
+	opts := modbus.TCPServerOptions{
+		Allow: func(remote net.Addr) bool {
+			return local.Contains(remote.(*net.TCPAddr).IP)
+		},
+		MaxConnections: 4,
+	}
+	tcpserv, _ := modbus.NewTCPServerWithOptions(":502", modbus.ServeAllUnits(server), opts)
+*/
+func NewTCPServerWithOptions(host string, servers map[int]Server, opts TCPServerOptions) (TCPServer, error) {
+	laddr, err := net.ResolveTCPAddr("tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	tcpl, err := net.ListenTCP("tcp", laddr)
+	if err != nil {
+		return nil, err
+	}
+	return newTCPServer(tcpl, host, servers, opts), nil
+}
+
+/*
+NewTCPTLSServer establishes a listening socket like NewTCPServer, but for the Modbus/TCP Security protocol: the
+connections are secured with TLS using the cfg (the standard port is 802). The Modbus/TCP Security protocol requires
+that clients authenticate with certificates, so the cfg would normally set ClientAuth to
+tls.RequireAndVerifyClientCert, with the certificate authority for the clients in ClientCAs.
+
+	tlsserv, _ := modbus.NewTCPTLSServer(":802", cfg, modbus.ServeAllUnits(server))
+*/
+func NewTCPTLSServer(host string, cfg *tls.Config, servers map[int]Server) (TCPServer, error) {
 	laddr, err := net.ResolveTCPAddr("tcp", host)
 	if err != nil {
 		return nil, err
@@ -55,13 +122,17 @@ func NewTCPServer(host string, servers map[int]Server) (TCPServer, error) {
 	if err != nil {
 		return nil, err
 	}
+	return newTCPServer(tls.NewListener(tcpl, cfg), host, servers, TCPServerOptions{}), nil
+}
+
+func newTCPServer(listener net.Listener, host string, servers map[int]Server, opts TCPServerOptions) *tcpServer {
 	mservers := make(map[byte]Server)
 	for u, s := range servers {
 		mservers[bytePanic(u)] = s
 	}
-	tlistener := &tcpServer{tcpl, host, mservers, make(chan bool)}
+	tlistener := &tcpServer{tcpl: listener, host: host, servers: mservers, opts: opts, closed: make(chan bool)}
 	go tlistener.monitor()
-	return tlistener, nil
+	return tlistener
 }
 
 func (t *tcpServer) Close() error {
@@ -72,21 +143,71 @@ func (t *tcpServer) WaitClosed() {
 	<-t.closed
 }
 
+func (t *tcpServer) SetLogger(logger Logger) {
+	t.log.set(logger)
+}
+
+func (t *tcpServer) Connections() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.active
+}
+
+// admit checks whether a new connection is allowed, and counts it as active if it is.
+func (t *tcpServer) admit(remote net.Addr) bool {
+	if t.opts.Allow != nil && !t.opts.Allow(remote) {
+		t.log.Errorf("Rejected connection from remote %v to local %v: not allowed", remote, t.host)
+		return false
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.opts.MaxConnections > 0 && t.active >= t.opts.MaxConnections {
+		t.log.Errorf("Rejected connection from remote %v to local %v: %v connections are open", remote, t.host, t.active)
+		return false
+	}
+	t.active++
+	return true
+}
+
+func (t *tcpServer) release() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.active--
+}
+
 func (t *tcpServer) monitor() {
 	// defer tcpl.Close()
 	for {
-		conn, err := t.tcpl.AcceptTCP()
+		conn, err := t.tcpl.Accept()
 		if err != nil {
-			fmt.Printf("Error awaiting connections on %v: %v\n", t.host, err)
+			t.log.Errorf("Error awaiting connections on %v: %v", t.host, err)
 			close(t.closed)
 			break
 		}
-		m, err := NewTCPConn(conn)
+		if !t.admit(conn.RemoteAddr()) {
+			conn.Close()
+			continue
+		}
+		tc, err := newTCP(conn, DefaultTCPOptions)
 		if err != nil {
-			fmt.Printf("Error establishing Modbus connection from remote %v to local %v: %v\n", conn.RemoteAddr(), t.host, err)
+			t.log.Errorf("Error establishing Modbus connection from remote %v to local %v: %v", conn.RemoteAddr(), t.host, err)
+			t.release()
 		} else {
-			for u, s := range t.servers {
-				m.SetServer(int(u), s)
+			remote := conn.RemoteAddr()
+			tc.log.set(t.log.get())
+			tc.onClose = func(err error) {
+				t.release()
+				if t.opts.OnDisconnect != nil {
+					t.opts.OnDisconnect(remote, err)
+				}
+			}
+			// report the connection before it starts, so that it is reported before it ends
+			if t.opts.OnConnect != nil {
+				t.opts.OnConnect(remote)
+			}
+			mb := tc.start(t.servers)
+			if t.opts.OnConnectModbus != nil {
+				t.opts.OnConnectModbus(remote, mb)
 			}
 		}
 	}
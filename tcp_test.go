@@ -0,0 +1,40 @@
+package modbus
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTCPTruncatedFrame(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+	trans, err := newTCP(local, TCPOptions{ReadTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mb := trans.start(nil)
+	defer mb.Close()
+
+	// the remote device sends the start of a frame and goes silent, before it responds to the request
+	go func() {
+		request := make([]byte, 64)
+		if _, err := remote.Read(request); err != nil {
+			return
+		}
+		remote.Write([]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x07, 0x01, 0x03})
+		time.Sleep(200 * time.Millisecond)
+		remote.Write([]byte{request[0], request[1], 0x00, 0x00, 0x00, 0x05, 0x01, 0x03, 0x02, 0x12, 0x34})
+	}()
+
+	got, err := mb.GetClient(1).ReadHoldings(0, 1, 2*time.Second)
+	if err != nil {
+		t.Fatalf("Expected the frame after the truncated one to be read: %v", err)
+	}
+	if len(got.Values) != 1 || got.Values[0] != 0x1234 {
+		t.Fatalf("Expected the value 0x1234, not %v", got)
+	}
+	if errs := mb.Diagnostics().CommErrors; errs != 1 {
+		t.Fatalf("Expected the truncated frame to be a comm error, not %v errors", errs)
+	}
+}
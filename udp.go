@@ -0,0 +1,155 @@
+package modbus
+
+import (
+	"errors"
+	"net"
+)
+
+type udp struct {
+	name string
+	// the largest PDU that is framed
+	pduLimit
+	conn *net.UDPConn
+	// Write to this channel to queue frames to send
+	toTX chan adu
+	// Frames off the wire will be readable from this channel
+	toDemux chan adu
+	// whether this is open or not.
+	isopen bool
+	// a channel that is closed if we are not open ;)
+	closed chan bool
+	diag   *busDiagnosticManager
+	wlog   wireLog
+	log    logSink
+}
+
+/*
+NewUDP returns a Modbus instance that sends and receives Modbus/TCP frames (with the MBAP header) as UDP datagrams to
+and from a remote IP and port, for devices that support Modbus over UDP. Each datagram is one frame.
+
+UDP does not guarantee delivery, so a request or response that is lost is reported as a timeout, and a response is only
+matched to its request by the transaction ID, so a late response to an earlier request is never mistaken for the
+response to a later one. Use WithRetry to repeat requests that time out.
+
+e.g. NewUDP("192.168.1.10:502")
+*/
+func NewUDP(hostport string) (Modbus, error) {
+	addr, err := net.ResolveUDPAddr("udp", hostport)
+	if err != nil {
+		return nil, err
+	}
+
+	// dial from any local interface to the remote address, datagrams from other addresses are not received
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &udp{}
+	t.conn = conn
+	t.name = conn.RemoteAddr().String()
+	t.isopen = true
+	t.closed = make(chan bool)
+	t.toDemux = make(chan adu, 5)
+	t.toTX = make(chan adu, 5)
+	t.diag = newBusDiagnosticManager()
+
+	// start a go routine that reads datagrams off the UDP connection
+	go t.wireReader()
+	// start a go routine that writes datagrams to the UDP connection
+	go t.wireWriter()
+
+	return newModbus(t.toTX, t.toDemux, t, t.diag), nil
+}
+
+func (t *udp) close() error {
+	if !t.isopen {
+		return nil
+	}
+	t.isopen = false
+	// closing this channel means that anyone reading from the channel is auto-selected in a Select statement
+	close(t.closed)
+	t.conn.Close()
+	return nil
+}
+
+func (t *udp) setWireLogger(logger WireLogger) {
+	t.wlog.setLogger(logger, t.closed)
+}
+
+func (t *udp) setLogger(logger Logger) {
+	t.log.set(logger)
+}
+
+// wireReader reads datagrams off the connection, and submits the valid frames to the demuxer.
+func (t *udp) wireReader() {
+	// larger than the largest frame, so that a datagram that is too large is not silently truncated to fit
+	buffer := make([]byte, 2*(mbapOverhead+maxPDUSizeLimit))
+	for {
+		n, err := t.conn.Read(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				break
+			}
+			// for example, the remote port is not (yet) listening. The request times out, but the socket is still good.
+			t.log.Errorf("Error reading from %s: %v", t.name, err)
+			continue
+		}
+		frame := make([]byte, n)
+		copy(frame, buffer)
+		t.wlog.log(Received, frame)
+		if t.validFrame(frame) {
+			f := decodeTCPFrame(frame)
+			t.diag.message(f.unit == 0)
+			t.toDemux <- f
+		}
+	}
+	t.log.Debugf("Terminating UDP reader %s: closed", t.name)
+}
+
+// validFrame checks that the datagram is a single complete frame.
+func (t *udp) validFrame(frame []byte) bool {
+	if limit := mbapOverhead + t.maxPDUSize(); len(frame) > limit {
+		t.log.Errorf("Too large of a frame on %s, %d exceeds %d bytes", t.name, len(frame), limit)
+		t.diag.overrun()
+		return false
+	}
+	if len(frame) < mbapOverhead+1 {
+		t.log.Errorf("Too small of a frame on %s, just %d bytes", t.name, len(frame))
+		t.diag.commError()
+		return false
+	}
+	if ck := getWord(frame, 2); ck != 0 {
+		t.log.Errorf("Expect MODBUS protocol 0 to be set. Not 0x%04x", ck)
+		t.diag.commError()
+		return false
+	}
+	if size := int(getWord(frame, 4)) + 6; size != len(frame) {
+		t.log.Errorf("Expect the frame size from the header, %d, to match the datagram size %d on %s", size, len(frame), t.name)
+		t.diag.commError()
+		return false
+	}
+	return true
+}
+
+// wireWriter takes frames that are ready to send and writes each of them to the UDP connection as one datagram.
+func (t *udp) wireWriter() {
+	alive := true
+	for alive {
+		select {
+		case <-t.closed:
+			alive = false
+		case f := <-t.toTX:
+			if !f.request {
+				t.diag.response(f.pdu)
+			}
+			frame := buildTCPFrame(f)
+			t.wlog.log(Sent, frame)
+			if _, err := t.conn.Write(frame); err != nil {
+				// the request will time out
+				t.log.Errorf("Unable to send %d bytes to %s: %v", len(frame), t.name, err)
+			}
+		}
+	}
+	t.log.Debugf("Terminating UDP writer %s: closed", t.name)
+}
@@ -0,0 +1,85 @@
+package modbus
+
+import (
+	"sync"
+	"time"
+)
+
+// Direction identifies whether a frame was received from, or sent to, the wire
+type Direction int
+
+const (
+	// Received frames were read from the wire
+	Received Direction = iota
+	// Sent frames were written to the wire
+	Sent
+)
+
+func (d Direction) String() string {
+	if d == Sent {
+		return "TX"
+	}
+	return "RX"
+}
+
+// WireLogger is called with the raw bytes of each frame read from, or written to the wire, including the framing
+// (MBAP header, CRC, LRC, etc.), and the time it was read or written.
+type WireLogger func(dir Direction, at time.Time, data []byte)
+
+type wirelog struct {
+	dir   Direction
+	at    time.Time
+	bytes []byte
+}
+
+// wireLog passes frames to a WireLogger on a separate go-routine so that a slow logger cannot block the wire. If the
+// logger does not keep up, frames are dropped.
+type wireLog struct {
+	lock   sync.Mutex
+	logger WireLogger
+	logs   chan wirelog
+}
+
+func (w *wireLog) setLogger(logger WireLogger, closed chan bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.logs == nil && logger != nil {
+		w.logs = make(chan wirelog, 100)
+		go w.deliver(closed)
+	}
+	w.logger = logger
+}
+
+func (w *wireLog) getLogger() WireLogger {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.logger
+}
+
+func (w *wireLog) log(dir Direction, data []byte) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.logger == nil {
+		return
+	}
+	cp := make([]byte, len(data))
+	copy(cp, data)
+	select {
+	case w.logs <- wirelog{dir, time.Now(), cp}:
+	default:
+		// the logger is not keeping up.
+	}
+}
+
+func (w *wireLog) deliver(closed chan bool) {
+	for {
+		select {
+		case <-closed:
+			return
+		case l := <-w.logs:
+			if logger := w.getLogger(); logger != nil {
+				logger(l.dir, l.at, l.bytes)
+			}
+		}
+	}
+}